@@ -10,12 +10,18 @@ import (
 	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
 	"github.com/jalopez/go-monkey-interpreter/pkg/object"
 	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+	"github.com/jalopez/go-monkey-interpreter/pkg/regvm"
 	"github.com/jalopez/go-monkey-interpreter/pkg/vm"
 )
 
-var engine = flag.String("engine", "vm", "use 'vm' or 'eval'")
+var (
+	engine            = flag.String("engine", "vm", "use 'vm', 'regvm' or 'eval'")
+	workload          = flag.String("workload", "fibonacci", "use 'fibonacci' or 'array'")
+	superinstructions = flag.Bool("superinstructions", true, "emit superinstructions for the 'vm' engine")
+)
 
-var input = `
+var workloads = map[string]string{
+	"fibonacci": `
 let fibonacci = fn(x) {
   if (x == 0) {
     0
@@ -28,7 +34,24 @@ let fibonacci = fn(x) {
   }
 };
 fibonacci(35);
-`
+`,
+	"array": `
+let range = fn(n) {
+  let iter = fn(i, acc) {
+    if (i == n) { acc } else { iter(i + 1, push(acc, i)) }
+  };
+  iter(0, [])
+};
+let sum = fn(arr, i, acc) {
+  if (i == len(arr)) { acc } else { sum(arr, i + 1, acc + arr[i] * 2) }
+};
+let numbers = range(200);
+let repeat = fn(n) {
+  if (n == 0) { sum(numbers, 0, 0) } else { repeat(n - 1) + repeat(n - 1) }
+};
+repeat(13);
+`,
+}
 
 func main() {
 	flag.Parse()
@@ -36,12 +59,22 @@ func main() {
 	var duration time.Duration
 	var result object.Object
 
+	input, ok := workloads[*workload]
+	if !ok {
+		fmt.Printf("unknown workload: %s\n", *workload)
+		return
+	}
+
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
 
-	if *engine == "vm" {
+	switch *engine {
+	case "vm":
 		comp := compiler.New()
+		if *superinstructions {
+			comp.EnableSuperinstructions()
+		}
 		err := comp.Compile(program)
 		if err != nil {
 			fmt.Printf("compiler error: %s", err)
@@ -60,7 +93,27 @@ func main() {
 
 		duration = time.Since(start)
 		result = machine.LastPoppedStackElem()
-	} else {
+	case "regvm":
+		comp := regvm.NewCompiler()
+		err := comp.Compile(program)
+		if err != nil {
+			fmt.Printf("compiler error: %s", err)
+			return
+		}
+
+		machine := regvm.New(comp.Bytecode())
+
+		start := time.Now()
+
+		err = machine.Run()
+		if err != nil {
+			fmt.Printf("vm error: %s", err)
+			return
+		}
+
+		duration = time.Since(start)
+		result = machine.LastPoppedStackElem()
+	default:
 		env := object.NewEnvironment()
 		start := time.Now()
 		result = eval.Eval(program, env)
@@ -68,8 +121,9 @@ func main() {
 	}
 
 	fmt.Printf(
-		"engine=%s, result=%s, duration=%s\n",
+		"engine=%s, workload=%s, result=%s, duration=%s\n",
 		*engine,
+		*workload,
 		result.Inspect(),
 		duration)
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/format"
+	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
+	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+)
+
+// exportAST runs the ast command, which prints the AST of a script as JSON,
+// or the script of an AST encoded as JSON. It reads the standard input when
+// no file is given.
+func exportAST(args []string) {
+	flags := flag.NewFlagSet("monkey ast", flag.ExitOnError)
+	decode := flags.Bool("decode", false, "read an AST encoded as JSON and print its script")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: monkey ast [-decode] [file]")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	var (
+		content []byte
+		err     error
+	)
+	switch flags.NArg() {
+	case 0:
+		content, err = io.ReadAll(os.Stdin)
+	case 1:
+		content, err = os.ReadFile(flags.Arg(0))
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if err == nil {
+		if *decode {
+			err = printScript(content)
+		} else {
+			err = printAST(string(content))
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func printAST(source string) error {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return fmt.Errorf("%s", strings.Join(p.Errors(), "\n"))
+	}
+
+	fmt.Println(program.ToJSON())
+	return nil
+}
+
+func printScript(content []byte) error {
+	var program ast.Program
+	if err := json.Unmarshal(content, &program); err != nil {
+		return err
+	}
+
+	fmt.Print(format.Node(&program))
+	return nil
+}
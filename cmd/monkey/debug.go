@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/akamensky/argparse"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/repl"
+)
+
+// debug runs the debug command, which debugs a script from an interactive
+// prompt
+func debug(args []string) {
+	argparser := argparse.NewParser("monkey debug", "Debug a Monkey script with breakpoints and steps")
+	engine := argparser.Selector("e", "engine", []string{repl.StackEngine, "eval"}, &argparse.Options{Required: false, Default: repl.StackEngine, Help: "Engine that runs the program: stack VM or evaluator"})
+	file := argparser.StringPositional(&argparse.Options{Required: true, Help: "File to debug"})
+
+	err := argparser.Parse(args)
+	if err != nil || *file == "" {
+		_, err = fmt.Print(argparser.Usage(err))
+		if err != nil {
+			panic(err)
+		}
+		os.Exit(1)
+	}
+
+	repl.Debug(*file, os.Stdin, os.Stdout, repl.Options{CompileEnabled: *engine != "eval"})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/format"
+)
+
+// formatFiles runs the fmt command, which formats scripts, or the standard
+// input when no files are given
+func formatFiles(args []string) {
+	flags := flag.NewFlagSet("monkey fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the formatted scripts to their files instead of the standard output")
+	check := flags.Bool("check", false, "list the scripts that are not formatted, failing when there are any")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: monkey fmt [-w] [-check] [files...]")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	files := flags.Args()
+	if len(files) == 0 {
+		content, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			var formatted string
+			formatted, err = format.Source(string(content))
+			fmt.Print(formatted)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	failed := false
+	for _, file := range files {
+		if err := formatFile(file, *write, *check); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// formatFile prints a formatted file, or writes it back, or only checks
+// whether it is formatted
+func formatFile(file string, write, check bool) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	formatted, err := format.Source(string(content))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case check:
+		if formatted != string(content) {
+			return fmt.Errorf("not formatted")
+		}
+	case write:
+		if formatted != string(content) {
+			return os.WriteFile(file, []byte(formatted), info.Mode().Perm())
+		}
+	default:
+		fmt.Print(formatted)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
+	"github.com/jalopez/go-monkey-interpreter/pkg/lint"
+	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+)
+
+// lintResult is the JSON output of linting a file
+type lintResult struct {
+	File        string            `json:"file"`
+	Diagnostics []lint.Diagnostic `json:"diagnostics"`
+	Errors      []string          `json:"errors,omitempty"`
+}
+
+// lintFiles runs the lint command, which reports the problems found in
+// scripts, failing when there are any
+func lintFiles(args []string) {
+	flags := flag.NewFlagSet("monkey lint", flag.ExitOnError)
+	jsonOutput := flags.Bool("json", false, "print the problems as JSON")
+	enable := flags.String("enable", "", "comma separated rules to run, instead of every rule")
+	disable := flags.String("disable", "", "comma separated rules not to run")
+	list := flags.Bool("list", false, "list the rules")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: monkey lint [-json] [-enable rules] [-disable rules] [-list] files...")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	if *list {
+		for _, r := range lint.Rules {
+			fmt.Printf("%-20s %s\n", r.Name(), r.Description())
+		}
+		return
+	}
+
+	linter, err := lint.New(lint.Rules, lint.Config{Enable: ruleNames(*enable), Disable: ruleNames(*disable)})
+	if err != nil || flags.NArg() == 0 {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	results := []lintResult{}
+	for _, file := range flags.Args() {
+		result := lintFile(linter, file)
+		results = append(results, result)
+		failed = failed || len(result.Diagnostics) != 0 || len(result.Errors) != 0
+
+		if *jsonOutput {
+			continue
+		}
+		for _, e := range result.Errors {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, e)
+		}
+		for _, d := range result.Diagnostics {
+			fmt.Printf("%s:%s\n", file, d)
+		}
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			panic(err)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func lintFile(linter *lint.Linter, file string) lintResult {
+	result := lintResult{File: file, Diagnostics: []lint.Diagnostic{}}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		result.Errors = []string{err.Error()}
+		return result
+	}
+
+	p := parser.New(lexer.New(string(content)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		result.Errors = p.Errors()
+		return result
+	}
+
+	result.Diagnostics = linter.Lint(program)
+	return result
+}
+
+func ruleNames(names string) []string {
+	if names == "" {
+		return nil
+	}
+	return strings.Split(names, ",")
+}
@@ -8,13 +8,51 @@ import (
 
 	"github.com/akamensky/argparse"
 
+	"github.com/jalopez/go-monkey-interpreter/pkg/dap"
+	"github.com/jalopez/go-monkey-interpreter/pkg/lsp"
 	"github.com/jalopez/go-monkey-interpreter/pkg/repl"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "debug":
+			debug(os.Args[1:])
+			return
+		case "fmt":
+			formatFiles(os.Args[2:])
+			return
+		case "lint":
+			lintFiles(os.Args[2:])
+			return
+		case "ast":
+			exportAST(os.Args[2:])
+			return
+		case "dap":
+			err := dap.NewServer(os.Stdin, os.Stdout).Serve()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		case "lsp":
+			err := lsp.NewServer(os.Stdin, os.Stdout).Serve()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	argparser := argparse.NewParser("monkey", "Monkey programming language interpreter")
-	verbose := argparser.Flag("v", "verbose", &argparse.Options{Required: false, Help: "Show verbose output (lexer tokens and AST)"})
+	verbose := argparser.Flag("v", "verbose", &argparse.Options{Required: false, Help: "Show verbose output (lexer tokens, and the AST after expanding macros)"})
 	disableCompiler := argparser.Flag("d", "disable-compiler", &argparse.Options{Required: false, Help: "Do not compile but interpret directly"})
+	engine := argparser.Selector("e", "engine", []string{repl.StackEngine, repl.RegisterEngine, "eval"}, &argparse.Options{Required: false, Default: repl.StackEngine, Help: "Engine that runs the program: stack VM, register VM or evaluator"})
+	superinstructions := argparser.Flag("s", "superinstructions", &argparse.Options{Required: false, Help: "Fuse common sequences of instructions of the stack VM, which run faster"})
+	trace := argparser.Flag("t", "trace", &argparse.Options{Required: false, Help: "Print the instructions run by the stack VM to stderr"})
+	profileFile := argparser.String("p", "profile", &argparse.Options{Required: false, Help: "Profile the script and write a pprof profile to this file"})
+	coverageFile := argparser.String("c", "coverage", &argparse.Options{Required: false, Help: "Record the statements and branches run and write their LCOV coverage to this file"})
 	file := argparser.StringPositional(&argparse.Options{Required: false, Help: "File to execute"})
 	// Parse input
 	err := argparser.Parse(os.Args)
@@ -30,7 +68,13 @@ func main() {
 
 	options := repl.Options{
 		Verbose:        *verbose,
-		CompileEnabled: !*disableCompiler,
+		CompileEnabled: !*disableCompiler && *engine != "eval",
+		Engine:         *engine,
+		Trace:          *trace,
+		Profile:        *profileFile,
+		Coverage:       *coverageFile,
+
+		Superinstructions: *superinstructions,
 	}
 
 	if *file != "" {
@@ -1,6 +1,10 @@
 package ast
 
-import "github.com/jalopez/go-monkey-interpreter/pkg/token"
+import (
+	"encoding/json"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
 
 // ArrayLiteral literal with array value
 type ArrayLiteral struct {
@@ -26,13 +30,13 @@ func (al *ArrayLiteral) String() string {
 }
 
 // ToJSON to json
-func (al *ArrayLiteral) ToJSON() string {
-	out := `{"type":"array","value":[`
-	for _, e := range al.Elements {
-		out += e.ToJSON()
-		out += ","
-	}
-	out = out[:len(out)-1]
-	out += `]}`
-	return out
+func (al *ArrayLiteral) ToJSON() string { return toJSON(al) }
+
+// MarshalJSON encodes the expression, with its tokens
+func (al *ArrayLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type     string       `json:"type"`
+		Token    token.Token  `json:"token"`
+		Elements []Expression `json:"elements"`
+	}{"array", al.Token, al.Elements})
 }
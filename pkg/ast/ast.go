@@ -1,5 +1,7 @@
 package ast
 
+import "encoding/json"
+
 // Node node
 type Node interface {
 	TokenLiteral() string
@@ -44,15 +46,17 @@ func (p *Program) String() string {
 }
 
 // ToJSON to json
-func (p *Program) ToJSON() string {
-	out := "["
+func (p *Program) ToJSON() string { return toJSON(p) }
 
-	for _, s := range p.Statements {
-		out += s.ToJSON()
-		out += ","
+// MarshalJSON encodes the program
+func (p *Program) MarshalJSON() ([]byte, error) {
+	statements := p.Statements
+	if statements == nil {
+		statements = []Statement{}
 	}
-	out = out[:len(out)-1]
-	out += "]"
 
-	return out
+	return json.Marshal(struct {
+		Type       string      `json:"type"`
+		Statements []Statement `json:"statements"`
+	}{"program", statements})
 }
@@ -0,0 +1,36 @@
+package ast
+
+import (
+	"encoding/json"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
+
+// BadStatement is a statement that failed to parse, kept in the program so
+// the statements around it can still be used
+type BadStatement struct {
+	Token token.Token // the first token of the statement
+	End   token.Token // the last token of the statement
+}
+
+func (*BadStatement) statementNode() {} //nolint:golint,unused
+
+// TokenLiteral token literal
+func (bs *BadStatement) TokenLiteral() string { return bs.Token.Literal }
+
+// String string representation
+func (bs *BadStatement) String() string {
+	return "<bad statement>"
+}
+
+// ToJSON to json
+func (bs *BadStatement) ToJSON() string { return toJSON(bs) }
+
+// MarshalJSON encodes the statement, with its tokens
+func (bs *BadStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string      `json:"type"`
+		Token token.Token `json:"token"`
+		End   token.Token `json:"end"`
+	}{"bad", bs.Token, bs.End})
+}
@@ -1,11 +1,16 @@
 package ast
 
-import "github.com/jalopez/go-monkey-interpreter/pkg/token"
+import (
+	"encoding/json"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
 
 // BlockStatement is a block statement
 type BlockStatement struct {
 	Token      token.Token // the { token
 	Statements []Statement
+	End        token.Token // the } token
 }
 
 func (*BlockStatement) statementNode() {} //nolint:golint,unused
@@ -25,12 +30,14 @@ func (bs *BlockStatement) String() string {
 }
 
 // ToJSON to json
-func (bs *BlockStatement) ToJSON() string {
-	var out string
-
-	for _, s := range bs.Statements {
-		out += s.ToJSON()
-	}
-
-	return `{"type":"block","value":[` + out + `]}`
+func (bs *BlockStatement) ToJSON() string { return toJSON(bs) }
+
+// MarshalJSON encodes the block, with its braces
+func (bs *BlockStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type       string      `json:"type"`
+		Token      token.Token `json:"token"`
+		Statements []Statement `json:"statements"`
+		End        token.Token `json:"end"`
+	}{"block", bs.Token, bs.Statements, bs.End})
 }
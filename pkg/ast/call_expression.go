@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"encoding/json"
 	"strings"
 
 	"github.com/jalopez/go-monkey-interpreter/pkg/token"
@@ -35,16 +36,14 @@ func (ce *CallExpression) String() string {
 }
 
 // ToJSON to json
-func (ce *CallExpression) ToJSON() string {
-	var out string
-
-	arguments := []string{}
-	for _, a := range ce.Arguments {
-		arguments = append(arguments, a.ToJSON())
-	}
-
-	out += `{"type":"call","value":{`
-	out += `"function":` + ce.Function.ToJSON() + ","
-	out += `"arguments":[` + strings.Join(arguments, ",") + "]}}"
-	return out
+func (ce *CallExpression) ToJSON() string { return toJSON(ce) }
+
+// MarshalJSON encodes the expression, with its tokens
+func (ce *CallExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type      string       `json:"type"`
+		Token     token.Token  `json:"token"`
+		Function  Expression   `json:"function"`
+		Arguments []Expression `json:"arguments"`
+	}{"call", ce.Token, ce.Function, ce.Arguments})
 }
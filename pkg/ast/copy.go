@@ -0,0 +1,121 @@
+package ast
+
+import "fmt"
+
+// Copy returns a deep copy of a node, sharing nothing with it, so one of
+// them can be modified without changing the other
+func Copy(node Node) Node {
+	switch node := node.(type) {
+	case nil:
+		return nil
+	case *Program:
+		return &Program{Statements: copyStatements(node.Statements)}
+	case *BlockStatement:
+		return copyBlock(node)
+	case *LetStatement:
+		return &LetStatement{Token: node.Token, Name: copyIdentifier(node.Name), Value: copyExpression(node.Value)}
+	case *ReturnStatement:
+		return &ReturnStatement{Token: node.Token, ReturnValue: copyExpression(node.ReturnValue)}
+	case *ExpressionStatement:
+		return &ExpressionStatement{Token: node.Token, Expression: copyExpression(node.Expression)}
+	case *BadStatement:
+		copied := *node
+		return &copied
+	case *Identifier:
+		return copyIdentifier(node)
+	case *IntegerLiteral:
+		copied := *node
+		return &copied
+	case *StringLiteral:
+		copied := *node
+		return &copied
+	case *Boolean:
+		copied := *node
+		return &copied
+	case *PrefixExpression:
+		return &PrefixExpression{Token: node.Token, Operator: node.Operator, Right: copyExpression(node.Right)}
+	case *InfixExpression:
+		return &InfixExpression{Token: node.Token, Operator: node.Operator, Left: copyExpression(node.Left), Right: copyExpression(node.Right)}
+	case *IfExpression:
+		return &IfExpression{
+			Token:       node.Token,
+			Condition:   copyExpression(node.Condition),
+			Consequence: copyBlock(node.Consequence),
+			Alternative: copyBlock(node.Alternative),
+		}
+	case *FunctionLiteral:
+		return &FunctionLiteral{Token: node.Token, Parameters: copyParameters(node.Parameters), Body: copyBlock(node.Body), Name: node.Name}
+	case *MacroLiteral:
+		return &MacroLiteral{Token: node.Token, Parameters: copyParameters(node.Parameters), Body: copyBlock(node.Body)}
+	case *CallExpression:
+		return &CallExpression{Token: node.Token, Function: copyExpression(node.Function), Arguments: copyExpressions(node.Arguments)}
+	case *ArrayLiteral:
+		return &ArrayLiteral{Token: node.Token, Elements: copyExpressions(node.Elements)}
+	case *IndexExpression:
+		return &IndexExpression{Token: node.Token, Left: copyExpression(node.Left), Index: copyExpression(node.Index)}
+	default:
+		panic(fmt.Sprintf("ast.Copy: unexpected node type %T", node))
+	}
+}
+
+func copyExpression(e Expression) Expression {
+	if e == nil {
+		return nil
+	}
+	return Copy(e).(Expression)
+}
+
+func copyIdentifier(ident *Identifier) *Identifier {
+	if ident == nil {
+		return nil
+	}
+	copied := *ident
+	return &copied
+}
+
+func copyBlock(block *BlockStatement) *BlockStatement {
+	if block == nil {
+		return nil
+	}
+	return &BlockStatement{Token: block.Token, Statements: copyStatements(block.Statements), End: block.End}
+}
+
+// copyStatements copies a list of statements, keeping nil lists nil
+func copyStatements(statements []Statement) []Statement {
+	if statements == nil {
+		return nil
+	}
+
+	copied := make([]Statement, len(statements))
+	for i, s := range statements {
+		if s != nil {
+			copied[i] = Copy(s).(Statement)
+		}
+	}
+	return copied
+}
+
+// copyExpressions copies a list of expressions, keeping nil lists nil
+func copyExpressions(expressions []Expression) []Expression {
+	if expressions == nil {
+		return nil
+	}
+
+	copied := make([]Expression, len(expressions))
+	for i, e := range expressions {
+		copied[i] = copyExpression(e)
+	}
+	return copied
+}
+
+func copyParameters(parameters []*Identifier) []*Identifier {
+	if parameters == nil {
+		return nil
+	}
+
+	copied := make([]*Identifier, len(parameters))
+	for i, p := range parameters {
+		copied[i] = copyIdentifier(p)
+	}
+	return copied
+}
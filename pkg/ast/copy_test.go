@@ -0,0 +1,56 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
+
+func TestCopy(t *testing.T) {
+	// let f = fn(a) { if (!a) { return [a][1] } else { f(a + "b") } }; macro(x) { x }; let = ;
+	program := &Program{Statements: []Statement{
+		&LetStatement{Token: token.Token{Type: token.LET, Literal: "let", Line: 1, Column: 1}, Name: ident("f"), Value: &FunctionLiteral{
+			Name:       "f",
+			Parameters: []*Identifier{ident("a")},
+			Body: block(expression(&IfExpression{
+				Condition:   &PrefixExpression{Operator: "!", Right: ident("a")},
+				Consequence: block(&ReturnStatement{ReturnValue: &IndexExpression{Left: &ArrayLiteral{Elements: []Expression{ident("a")}}, Index: integer(1)}}),
+				Alternative: block(expression(&CallExpression{
+					Function:  ident("f"),
+					Arguments: []Expression{&InfixExpression{Left: ident("a"), Operator: "+", Right: &StringLiteral{Value: "b"}}},
+				})),
+			})),
+		}},
+		expression(&MacroLiteral{Parameters: []*Identifier{ident("x")}, Body: block(expression(&Boolean{Value: true}))}),
+		&BadStatement{Token: token.Token{Type: token.LET, Literal: "let"}},
+	}}
+
+	copied := Copy(program)
+	if !reflect.DeepEqual(copied, program) {
+		t.Fatalf("wrong copy.\nwant=%#v\ngot=%#v", program, copied)
+	}
+
+	// the copy shares no node with the program
+	nodes := map[Node]bool{}
+	Inspect(program, func(node Node) bool {
+		nodes[node] = true
+		return true
+	})
+	Inspect(copied, func(node Node) bool {
+		if node != nil && nodes[node] {
+			t.Errorf("node shared by the copy: %#v", node)
+		}
+		return true
+	})
+
+	Modify(copied, func(node Node) Node {
+		if ident, ok := node.(*Identifier); ok {
+			ident.Value = "z"
+		}
+		return node
+	})
+	if program.Statements[0].(*LetStatement).Name.Value != "f" {
+		t.Errorf("modifying the copy modified the program")
+	}
+}
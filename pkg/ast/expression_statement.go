@@ -1,6 +1,10 @@
 package ast
 
-import "github.com/jalopez/go-monkey-interpreter/pkg/token"
+import (
+	"encoding/json"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
 
 // ExpressionStatement statement
 type ExpressionStatement struct {
@@ -23,6 +27,13 @@ func (es *ExpressionStatement) String() string {
 }
 
 // ToJSON to json
-func (es *ExpressionStatement) ToJSON() string {
-	return `{"type":"expression","value":` + es.Expression.ToJSON() + `}`
+func (es *ExpressionStatement) ToJSON() string { return toJSON(es) }
+
+// MarshalJSON encodes the statement, with its tokens
+func (es *ExpressionStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string      `json:"type"`
+		Token token.Token `json:"token"`
+		Value Expression  `json:"value"`
+	}{"expression", es.Token, es.Expression})
 }
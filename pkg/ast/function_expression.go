@@ -1,6 +1,10 @@
 package ast
 
-import "github.com/jalopez/go-monkey-interpreter/pkg/token"
+import (
+	"encoding/json"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
 
 // FunctionLiteral function literal
 type FunctionLiteral struct {
@@ -39,19 +43,15 @@ func (fl *FunctionLiteral) String() string {
 }
 
 // ToJSON to json
-func (fl *FunctionLiteral) ToJSON() string {
-	out := `{"type":"function","value":`
-	out += `{"parameters":[`
-
-	for i, p := range fl.Parameters {
-		if i != 0 {
-			out += ","
-		}
-
-		out += p.ToJSON()
-	}
-
-	out += `],"body":` + fl.Body.ToJSON() + "}}"
-
-	return out
+func (fl *FunctionLiteral) ToJSON() string { return toJSON(fl) }
+
+// MarshalJSON encodes the expression, with its tokens
+func (fl *FunctionLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type       string          `json:"type"`
+		Token      token.Token     `json:"token"`
+		Name       string          `json:"name"`
+		Parameters []*Identifier   `json:"parameters"`
+		Body       *BlockStatement `json:"body"`
+	}{"function", fl.Token, fl.Name, fl.Parameters, fl.Body})
 }
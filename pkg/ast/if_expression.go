@@ -1,6 +1,10 @@
 package ast
 
-import "github.com/jalopez/go-monkey-interpreter/pkg/token"
+import (
+	"encoding/json"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
 
 type IfExpression struct {
 	Token       token.Token // The 'if' token
@@ -30,12 +34,15 @@ func (ie *IfExpression) String() string {
 }
 
 // ToJSON to json
-func (ie *IfExpression) ToJSON() string {
-	out := `{"type":"if","condition":` + ie.Condition.ToJSON() + `,"consequence":` + ie.Consequence.ToJSON()
-
-	if ie.Alternative != nil {
-		out += `,"alternative":` + ie.Alternative.ToJSON()
-	}
-
-	return out + `}`
+func (ie *IfExpression) ToJSON() string { return toJSON(ie) }
+
+// MarshalJSON encodes the expression, with its tokens
+func (ie *IfExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type        string          `json:"type"`
+		Token       token.Token     `json:"token"`
+		Condition   Expression      `json:"condition"`
+		Consequence *BlockStatement `json:"consequence"`
+		Alternative *BlockStatement `json:"alternative"`
+	}{"if", ie.Token, ie.Condition, ie.Consequence, ie.Alternative})
 }
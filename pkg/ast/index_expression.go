@@ -1,6 +1,10 @@
 package ast
 
-import "github.com/jalopez/go-monkey-interpreter/pkg/token"
+import (
+	"encoding/json"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
 
 // IndexExpression literal with index value
 type IndexExpression struct {
@@ -20,6 +24,14 @@ func (ie *IndexExpression) String() string {
 }
 
 // ToJSON to json
-func (ie *IndexExpression) ToJSON() string {
-	return `{"type":"index", "left":` + ie.Left.ToJSON() + `, "index":` + ie.Index.ToJSON() + `}`
+func (ie *IndexExpression) ToJSON() string { return toJSON(ie) }
+
+// MarshalJSON encodes the expression, with its tokens
+func (ie *IndexExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string      `json:"type"`
+		Token token.Token `json:"token"`
+		Left  Expression  `json:"left"`
+		Index Expression  `json:"index"`
+	}{"index", ie.Token, ie.Left, ie.Index})
 }
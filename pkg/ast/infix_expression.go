@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"encoding/json"
 	"github.com/jalopez/go-monkey-interpreter/pkg/token"
 )
 
@@ -23,6 +24,15 @@ func (ie *InfixExpression) String() string {
 }
 
 // ToJSON to json
-func (ie *InfixExpression) ToJSON() string {
-	return `{"type":"` + ie.Operator + `","left":` + ie.Left.ToJSON() + `,"right":` + ie.Right.ToJSON() + `}`
+func (ie *InfixExpression) ToJSON() string { return toJSON(ie) }
+
+// MarshalJSON encodes the expression, with its tokens
+func (ie *InfixExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type     string      `json:"type"`
+		Token    token.Token `json:"token"`
+		Operator string      `json:"operator"`
+		Left     Expression  `json:"left"`
+		Right    Expression  `json:"right"`
+	}{"infix", ie.Token, ie.Operator, ie.Left, ie.Right})
 }
@@ -0,0 +1,280 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
+
+// toJSON encodes a node, which never fails as nodes hold no values JSON
+// cannot encode
+func toJSON(node Node) string {
+	data, err := json.Marshal(node)
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// UnmarshalJSON decodes a program encoded by MarshalJSON
+func (p *Program) UnmarshalJSON(data []byte) error {
+	node, err := Decode(data)
+	if err != nil {
+		return err
+	}
+
+	program, ok := node.(*Program)
+	if !ok {
+		return fmt.Errorf("expected program, got %T", node)
+	}
+	*p = *program
+	return nil
+}
+
+// Decode decodes a node encoded by its MarshalJSON method, or nil for null
+func Decode(data []byte) (Node, error) {
+	d := &decoder{}
+	node := d.node(data)
+	if d.err != nil {
+		return nil, d.err
+	}
+	return node, nil
+}
+
+// jsonNode has the fields of the encodings of every node, decoded according
+// to its type
+type jsonNode struct {
+	Type  string      `json:"type"`
+	Token token.Token `json:"token"`
+	End   token.Token `json:"end"`
+
+	Name        json.RawMessage   `json:"name"`
+	Value       json.RawMessage   `json:"value"`
+	Operator    string            `json:"operator"`
+	Left        json.RawMessage   `json:"left"`
+	Right       json.RawMessage   `json:"right"`
+	Index       json.RawMessage   `json:"index"`
+	Condition   json.RawMessage   `json:"condition"`
+	Consequence json.RawMessage   `json:"consequence"`
+	Alternative json.RawMessage   `json:"alternative"`
+	Parameters  []json.RawMessage `json:"parameters"`
+	Body        json.RawMessage   `json:"body"`
+	Function    json.RawMessage   `json:"function"`
+	Arguments   []json.RawMessage `json:"arguments"`
+	Elements    []json.RawMessage `json:"elements"`
+	Statements  []json.RawMessage `json:"statements"`
+}
+
+// decoder decodes nodes, keeping the first error found
+type decoder struct {
+	err error
+}
+
+func (d *decoder) fail(format string, args ...any) {
+	if d.err == nil {
+		d.err = fmt.Errorf(format, args...)
+	}
+}
+
+func (d *decoder) decode(data []byte, v any) {
+	if err := json.Unmarshal(data, v); err != nil {
+		d.fail("%s", err)
+	}
+}
+
+// require fails when a child a node cannot miss is null or missing
+func (d *decoder) require(nodeType, child string, data []byte) {
+	if isNull(data) {
+		d.fail("%s without %s", nodeType, child)
+	}
+}
+
+func (d *decoder) node(data []byte) Node {
+	if d.err != nil || isNull(data) {
+		return nil
+	}
+
+	var n jsonNode
+	d.decode(data, &n)
+	if d.err != nil {
+		return nil
+	}
+
+	switch n.Type {
+	case "program":
+		return &Program{Statements: d.statements(n.Statements)}
+	case "let":
+		d.require(n.Type, "name", n.Name)
+		d.require(n.Type, "value", n.Value)
+		return &LetStatement{Token: n.Token, Name: d.identifier(n.Name), Value: d.expression(n.Value)}
+	case "return":
+		d.require(n.Type, "value", n.Value)
+		return &ReturnStatement{Token: n.Token, ReturnValue: d.expression(n.Value)}
+	case "expression":
+		d.require(n.Type, "value", n.Value)
+		return &ExpressionStatement{Token: n.Token, Expression: d.expression(n.Value)}
+	case "block":
+		return &BlockStatement{Token: n.Token, Statements: d.statements(n.Statements), End: n.End}
+	case "bad":
+		return &BadStatement{Token: n.Token, End: n.End}
+	case "identifier":
+		ident := &Identifier{Token: n.Token}
+		d.decode(n.Value, &ident.Value)
+		return ident
+	case "integer":
+		lit := &IntegerLiteral{Token: n.Token}
+		d.decode(n.Value, &lit.Value)
+		return lit
+	case "boolean":
+		lit := &Boolean{Token: n.Token}
+		d.decode(n.Value, &lit.Value)
+		return lit
+	case "string":
+		lit := &StringLiteral{Token: n.Token}
+		d.decode(n.Value, &lit.Value)
+		return lit
+	case "prefix":
+		d.require(n.Type, "right", n.Right)
+		return &PrefixExpression{Token: n.Token, Operator: n.Operator, Right: d.expression(n.Right)}
+	case "infix":
+		d.require(n.Type, "left", n.Left)
+		d.require(n.Type, "right", n.Right)
+		return &InfixExpression{Token: n.Token, Operator: n.Operator, Left: d.expression(n.Left), Right: d.expression(n.Right)}
+	case "if":
+		d.require(n.Type, "condition", n.Condition)
+		d.require(n.Type, "consequence", n.Consequence)
+		return &IfExpression{
+			Token:       n.Token,
+			Condition:   d.expression(n.Condition),
+			Consequence: d.block(n.Consequence),
+			Alternative: d.block(n.Alternative),
+		}
+	case "function":
+		d.require(n.Type, "body", n.Body)
+		fn := &FunctionLiteral{Token: n.Token, Parameters: d.parameters(n.Parameters), Body: d.block(n.Body)}
+		if n.Name != nil {
+			d.decode(n.Name, &fn.Name)
+		}
+		return fn
+	case "macro":
+		d.require(n.Type, "body", n.Body)
+		return &MacroLiteral{Token: n.Token, Parameters: d.parameters(n.Parameters), Body: d.block(n.Body)}
+	case "call":
+		d.require(n.Type, "function", n.Function)
+		return &CallExpression{Token: n.Token, Function: d.expression(n.Function), Arguments: d.expressions(n.Arguments)}
+	case "array":
+		return &ArrayLiteral{Token: n.Token, Elements: d.expressions(n.Elements)}
+	case "index":
+		d.require(n.Type, "left", n.Left)
+		d.require(n.Type, "index", n.Index)
+		return &IndexExpression{Token: n.Token, Left: d.expression(n.Left), Index: d.expression(n.Index)}
+	default:
+		d.fail("unknown node type %q", n.Type)
+		return nil
+	}
+}
+
+func (d *decoder) statement(data []byte) Statement {
+	node := d.node(data)
+	if node == nil {
+		return nil
+	}
+
+	s, ok := node.(Statement)
+	if !ok {
+		d.fail("expected statement, got %T", node)
+	}
+	return s
+}
+
+func (d *decoder) expression(data []byte) Expression {
+	node := d.node(data)
+	if node == nil {
+		return nil
+	}
+
+	e, ok := node.(Expression)
+	if !ok {
+		d.fail("expected expression, got %T", node)
+	}
+	return e
+}
+
+func (d *decoder) identifier(data []byte) *Identifier {
+	node := d.node(data)
+	if node == nil {
+		return nil
+	}
+
+	ident, ok := node.(*Identifier)
+	if !ok {
+		d.fail("expected identifier, got %T", node)
+	}
+	return ident
+}
+
+func (d *decoder) block(data []byte) *BlockStatement {
+	node := d.node(data)
+	if node == nil {
+		return nil
+	}
+
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		d.fail("expected block, got %T", node)
+	}
+	return block
+}
+
+// statements decodes a list of statements, keeping nil lists nil
+func (d *decoder) statements(list []json.RawMessage) []Statement {
+	if list == nil {
+		return nil
+	}
+
+	statements := make([]Statement, len(list))
+	for i, data := range list {
+		if isNull(data) {
+			d.fail("null statement in a list")
+		}
+		statements[i] = d.statement(data)
+	}
+	return statements
+}
+
+// expressions decodes a list of expressions, keeping nil lists nil
+func (d *decoder) expressions(list []json.RawMessage) []Expression {
+	if list == nil {
+		return nil
+	}
+
+	expressions := make([]Expression, len(list))
+	for i, data := range list {
+		if isNull(data) {
+			d.fail("null expression in a list")
+		}
+		expressions[i] = d.expression(data)
+	}
+	return expressions
+}
+
+func isNull(data []byte) bool {
+	return len(data) == 0 || bytes.Equal(bytes.TrimSpace(data), []byte("null"))
+}
+
+func (d *decoder) parameters(list []json.RawMessage) []*Identifier {
+	if list == nil {
+		return nil
+	}
+
+	parameters := make([]*Identifier, len(list))
+	for i, data := range list {
+		if isNull(data) {
+			d.fail("null parameter in a list")
+		}
+		parameters[i] = d.identifier(data)
+	}
+	return parameters
+}
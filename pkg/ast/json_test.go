@@ -0,0 +1,122 @@
+package ast
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
+
+func TestToJSON(t *testing.T) {
+	tests := []struct {
+		node     Node
+		expected string
+	}{
+		{&Program{}, `{"type":"program","statements":[]}`},
+		{
+			&StringLiteral{Token: token.Token{Type: token.STRING, Literal: `say "hi"`, Line: 1, Column: 3}, Value: `say "hi"`},
+			`{"type":"string","token":{"type":"STRING","literal":"say \"hi\"","line":1,"column":3},"value":"say \"hi\""}`,
+		},
+		{
+			&IfExpression{
+				Token:       token.Token{Type: token.IF, Literal: "if", Line: 1, Column: 1},
+				Condition:   &Boolean{Token: token.Token{Type: token.TRUE, Literal: "true", Line: 1, Column: 5}, Value: true},
+				Consequence: &BlockStatement{Token: token.Token{Type: token.LBRACE, Literal: "{", Line: 1, Column: 11}},
+			},
+			`{"type":"if","token":{"type":"IF","literal":"if","line":1,"column":1},` +
+				`"condition":{"type":"boolean","token":{"type":"TRUE","literal":"true","line":1,"column":5},"value":true},` +
+				`"consequence":{"type":"block","token":{"type":"{","literal":"{","line":1,"column":11},"statements":null,` +
+				`"end":{"type":"","literal":"","line":0,"column":0}},"alternative":null}`,
+		},
+	}
+
+	for _, tt := range tests {
+		got := tt.node.ToJSON()
+		if got != tt.expected {
+			t.Errorf("wrong JSON.\nwant=%s\ngot=%s", tt.expected, got)
+		}
+
+		decoded, err := Decode([]byte(got))
+		if err != nil {
+			t.Fatalf("decoding %s: %s", got, err)
+		}
+		if decoded.ToJSON() != got {
+			t.Errorf("wrong decoded node.\nwant=%s\ngot=%s", got, decoded.ToJSON())
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	let := &LetStatement{
+		Token: token.Token{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+		Name:  &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 5}, Value: "x"},
+		Value: &PrefixExpression{
+			Token:    token.Token{Type: token.MINUS, Literal: "-", Line: 1, Column: 9},
+			Operator: "-",
+			Right:    &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "5", Line: 1, Column: 10}, Value: 5},
+		},
+	}
+	program := &Program{Statements: []Statement{let}}
+
+	data, err := json.Marshal(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Program
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, program) {
+		t.Errorf("wrong program. want=%s, got=%s", program.ToJSON(), decoded.ToJSON())
+	}
+
+	node, err := Decode([]byte("null"))
+	if node != nil || err != nil {
+		t.Errorf("wrong decoding of null. got=%v, %v", node, err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"type":"loop"}`, `unknown node type "loop"`},
+		{`{"type":"let","name":{"type":"integer","value":1},"value":{"type":"integer","value":1}}`, "expected identifier, got *ast.IntegerLiteral"},
+		{`{"type":"expression","value":{"type":"bad"}}`, "expected expression, got *ast.BadStatement"},
+		{`{"type":"program","statements":[{"type":"identifier","value":"x"}]}`, "expected statement, got *ast.Identifier"},
+		{`{"type":"if","condition":{"type":"boolean","value":true},"consequence":{"type":"bad"}}`, "expected block, got *ast.BadStatement"},
+		{`{"type":"program","statements":[{"type":"let"}]}`, "let without name"},
+		{`{"type":"let","name":{"type":"identifier","value":"x"},"value":null}`, "let without value"},
+		{`{"type":"return"}`, "return without value"},
+		{`{"type":"expression"}`, "expression without value"},
+		{`{"type":"prefix","operator":"-"}`, "prefix without right"},
+		{`{"type":"infix","operator":"+","right":{"type":"integer","value":1}}`, "infix without left"},
+		{`{"type":"if","condition":{"type":"boolean","value":true}}`, "if without consequence"},
+		{`{"type":"function","parameters":[]}`, "function without body"},
+		{`{"type":"macro","parameters":[]}`, "macro without body"},
+		{`{"type":"call","arguments":[]}`, "call without function"},
+		{`{"type":"index","left":{"type":"identifier","value":"a"}}`, "index without index"},
+		{`{"type":"program","statements":[null]}`, "null statement in a list"},
+		{`{"type":"array","elements":[null]}`, "null expression in a list"},
+		{`{"type":"function","parameters":[null],"body":{"type":"block"}}`, "null parameter in a list"},
+		{`{"type":"integer","value":"1"}`, "cannot unmarshal string"},
+		{`{"type":`, "unexpected end of JSON input"},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %s. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	var program Program
+	err := json.Unmarshal([]byte(`{"type":"identifier","value":"x"}`), &program)
+	if err == nil || err.Error() != "expected program, got *ast.Identifier" {
+		t.Errorf("wrong error decoding a program. got=%v", err)
+	}
+}
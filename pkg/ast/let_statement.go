@@ -1,6 +1,10 @@
 package ast
 
-import "github.com/jalopez/go-monkey-interpreter/pkg/token"
+import (
+	"encoding/json"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
 
 // LetStatement "let" statement
 type LetStatement struct {
@@ -22,8 +26,17 @@ func (ls *LetStatement) String() string {
 		ls.Value.String() + ";"
 }
 
-func (ls *LetStatement) ToJSON() string {
-	return `{"type":"let","name":` + ls.Name.ToJSON() + `,"value":` + ls.Value.ToJSON() + `}`
+// ToJSON to json
+func (ls *LetStatement) ToJSON() string { return toJSON(ls) }
+
+// MarshalJSON encodes the statement, with its tokens
+func (ls *LetStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string      `json:"type"`
+		Token token.Token `json:"token"`
+		Name  *Identifier `json:"name"`
+		Value Expression  `json:"value"`
+	}{"let", ls.Token, ls.Name, ls.Value})
 }
 
 // Identifier IDENT token
@@ -44,6 +57,13 @@ func (i *Identifier) String() string {
 }
 
 // ToJSON to json
-func (i *Identifier) ToJSON() string {
-	return `{"type":"identifier","value":"` + i.Value + `"}`
+func (i *Identifier) ToJSON() string { return toJSON(i) }
+
+// MarshalJSON encodes the identifier, with its token
+func (i *Identifier) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string      `json:"type"`
+		Token token.Token `json:"token"`
+		Value string      `json:"value"`
+	}{"identifier", i.Token, i.Value})
 }
@@ -1,6 +1,10 @@
 package ast
 
-import "github.com/jalopez/go-monkey-interpreter/pkg/token"
+import (
+	"encoding/json"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
 
 // IntegerLiteral literal with integer value
 type IntegerLiteral struct {
@@ -17,8 +21,15 @@ func (il *IntegerLiteral) TokenLiteral() string { return il.Token.Literal }
 func (il *IntegerLiteral) String() string { return il.Token.Literal }
 
 // ToJSON to json
-func (il *IntegerLiteral) ToJSON() string {
-	return `{"type":"integer","value":` + il.Token.Literal + `}`
+func (il *IntegerLiteral) ToJSON() string { return toJSON(il) }
+
+// MarshalJSON encodes the literal, with its token
+func (il *IntegerLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string      `json:"type"`
+		Token token.Token `json:"token"`
+		Value int64       `json:"value"`
+	}{"integer", il.Token, il.Value})
 }
 
 // Boolean literal with boolean value
@@ -36,8 +47,15 @@ func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
 func (b *Boolean) String() string { return b.Token.Literal }
 
 // ToJSON to json
-func (b *Boolean) ToJSON() string {
-	return `{"type":"boolean","value":` + b.Token.Literal + `}`
+func (b *Boolean) ToJSON() string { return toJSON(b) }
+
+// MarshalJSON encodes the literal, with its token
+func (b *Boolean) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string      `json:"type"`
+		Token token.Token `json:"token"`
+		Value bool        `json:"value"`
+	}{"boolean", b.Token, b.Value})
 }
 
 // StringLiteral literal with string value
@@ -55,6 +73,13 @@ func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 func (sl *StringLiteral) String() string { return sl.Token.Literal }
 
 // ToJSON to json
-func (sl *StringLiteral) ToJSON() string {
-	return `{"type":"string","value":` + sl.Token.Literal + `}`
+func (sl *StringLiteral) ToJSON() string { return toJSON(sl) }
+
+// MarshalJSON encodes the literal, with its token
+func (sl *StringLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string      `json:"type"`
+		Token token.Token `json:"token"`
+		Value string      `json:"value"`
+	}{"string", sl.Token, sl.Value})
 }
@@ -0,0 +1,52 @@
+package ast
+
+import (
+	"encoding/json"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
+
+// MacroLiteral macro literal, which is bound to a name by a let statement
+// at the top level and expanded before the program runs
+type MacroLiteral struct {
+	Token      token.Token // The 'macro' token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (*MacroLiteral) expressionNode() {} //nolint:golint,unused
+
+// TokenLiteral token literal
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+
+// String string representation
+func (ml *MacroLiteral) String() string {
+	out := ml.TokenLiteral()
+	out += "("
+
+	for i, p := range ml.Parameters {
+		if i != 0 {
+			out += ", "
+		}
+
+		out += p.String()
+	}
+
+	out += ") "
+	out += ml.Body.String()
+
+	return out
+}
+
+// ToJSON to json
+func (ml *MacroLiteral) ToJSON() string { return toJSON(ml) }
+
+// MarshalJSON encodes the expression, with its tokens
+func (ml *MacroLiteral) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type       string          `json:"type"`
+		Token      token.Token     `json:"token"`
+		Parameters []*Identifier   `json:"parameters"`
+		Body       *BlockStatement `json:"body"`
+	}{"macro", ml.Token, ml.Parameters, ml.Body})
+}
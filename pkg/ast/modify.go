@@ -0,0 +1,109 @@
+package ast
+
+import "fmt"
+
+// ModifierFunc returns the node replacing a node, which may be the node
+// itself
+type ModifierFunc func(Node) Node
+
+// Modify rewrites a tree in place, bottom-up: the children of a node are
+// replaced by the nodes returned for them, and then the node itself.
+// Statements replaced by nil are removed from their program or block. It
+// returns the node replacing the root, and panics when a node is replaced by
+// one of another kind, like an expression by a statement.
+func Modify(node Node, modifier ModifierFunc) Node {
+	switch node := node.(type) {
+	case *Program:
+		node.Statements = modifyStatements(node.Statements, modifier)
+	case *BlockStatement:
+		node.Statements = modifyStatements(node.Statements, modifier)
+	case *LetStatement:
+		if node.Name != nil {
+			node.Name = modify(node.Name, modifier)
+		}
+		node.Value = modify(node.Value, modifier)
+	case *ReturnStatement:
+		node.ReturnValue = modify(node.ReturnValue, modifier)
+	case *ExpressionStatement:
+		node.Expression = modify(node.Expression, modifier)
+	case *PrefixExpression:
+		node.Right = modify(node.Right, modifier)
+	case *InfixExpression:
+		node.Left = modify(node.Left, modifier)
+		node.Right = modify(node.Right, modifier)
+	case *IfExpression:
+		node.Condition = modify(node.Condition, modifier)
+		if node.Consequence != nil {
+			node.Consequence = modify(node.Consequence, modifier)
+		}
+		if node.Alternative != nil {
+			node.Alternative = modify(node.Alternative, modifier)
+		}
+	case *FunctionLiteral:
+		node.Parameters = modifyParameters(node.Parameters, modifier)
+		if node.Body != nil {
+			node.Body = modify(node.Body, modifier)
+		}
+	case *MacroLiteral:
+		node.Parameters = modifyParameters(node.Parameters, modifier)
+		if node.Body != nil {
+			node.Body = modify(node.Body, modifier)
+		}
+	case *CallExpression:
+		node.Function = modify(node.Function, modifier)
+		for i, a := range node.Arguments {
+			node.Arguments[i] = modify(a, modifier)
+		}
+	case *ArrayLiteral:
+		for i, e := range node.Elements {
+			node.Elements[i] = modify(e, modifier)
+		}
+	case *IndexExpression:
+		node.Left = modify(node.Left, modifier)
+		node.Index = modify(node.Index, modifier)
+	}
+
+	return modifier(node)
+}
+
+// modify modifies a child, which must be replaced by a node of its kind.
+// Missing children are nil interfaces, or nil pointers the callers skip.
+func modify[T Node](node T, modifier ModifierFunc) T {
+	if any(node) == nil {
+		return node
+	}
+
+	replacement := Modify(node, modifier)
+	modified, ok := replacement.(T)
+	if !ok {
+		panic(fmt.Sprintf("ast.Modify: %T replaced by %T", node, replacement))
+	}
+	return modified
+}
+
+func modifyStatements(statements []Statement, modifier ModifierFunc) []Statement {
+	if statements == nil {
+		return nil
+	}
+
+	modified := statements[:0]
+	for _, s := range statements {
+		switch replacement := Modify(s, modifier).(type) {
+		case nil:
+		case Statement:
+			modified = append(modified, replacement)
+		default:
+			panic(fmt.Sprintf("ast.Modify: %T replaced by %T", s, replacement))
+		}
+	}
+	return modified
+}
+
+func modifyParameters(parameters []*Identifier, modifier ModifierFunc) []*Identifier {
+	for i, p := range parameters {
+		if p != nil {
+			parameters[i] = modify(p, modifier)
+		}
+	}
+	return parameters
+}
@@ -0,0 +1,53 @@
+package ast
+
+import "github.com/jalopez/go-monkey-interpreter/pkg/token"
+
+// Position returns the line and column of the token of a node, which is
+// the operator for infix expressions, or 0, 0 when it is unknown
+func Position(node Node) (line, column int) {
+	var t token.Token
+
+	switch node := node.(type) {
+	case *Program:
+		if len(node.Statements) == 0 {
+			return 0, 0
+		}
+		return Position(node.Statements[0])
+	case *LetStatement:
+		t = node.Token
+	case *ReturnStatement:
+		t = node.Token
+	case *ExpressionStatement:
+		t = node.Token
+	case *BlockStatement:
+		t = node.Token
+	case *BadStatement:
+		t = node.Token
+	case *Identifier:
+		t = node.Token
+	case *IntegerLiteral:
+		t = node.Token
+	case *StringLiteral:
+		t = node.Token
+	case *Boolean:
+		t = node.Token
+	case *PrefixExpression:
+		t = node.Token
+	case *InfixExpression:
+		t = node.Token
+	case *IfExpression:
+		t = node.Token
+	case *FunctionLiteral:
+		t = node.Token
+	case *MacroLiteral:
+		t = node.Token
+	case *CallExpression:
+		t = node.Token
+	case *ArrayLiteral:
+		t = node.Token
+	case *IndexExpression:
+		t = node.Token
+	}
+
+	return t.Line, t.Column
+}
@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"encoding/json"
 	"github.com/jalopez/go-monkey-interpreter/pkg/token"
 )
 
@@ -22,6 +23,14 @@ func (pe *PrefixExpression) String() string {
 }
 
 // ToJSON to json
-func (pe *PrefixExpression) ToJSON() string {
-	return `{"type":"` + pe.Operator + `","value":` + pe.Right.ToJSON() + `}`
+func (pe *PrefixExpression) ToJSON() string { return toJSON(pe) }
+
+// MarshalJSON encodes the expression, with its tokens
+func (pe *PrefixExpression) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type     string      `json:"type"`
+		Token    token.Token `json:"token"`
+		Operator string      `json:"operator"`
+		Right    Expression  `json:"right"`
+	}{"prefix", pe.Token, pe.Operator, pe.Right})
 }
@@ -1,6 +1,10 @@
 package ast
 
-import "github.com/jalopez/go-monkey-interpreter/pkg/token"
+import (
+	"encoding/json"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
 
 // ReturnStatement "return" statement
 type ReturnStatement struct {
@@ -20,6 +24,13 @@ func (rs *ReturnStatement) String() string {
 }
 
 // ToJSON to json
-func (rs *ReturnStatement) ToJSON() string {
-	return `{"type":"return","value":` + rs.ReturnValue.ToJSON() + `}`
+func (rs *ReturnStatement) ToJSON() string { return toJSON(rs) }
+
+// MarshalJSON encodes the statement, with its tokens
+func (rs *ReturnStatement) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Type  string      `json:"type"`
+		Token token.Token `json:"token"`
+		Value Expression  `json:"value"`
+	}{"return", rs.Token, rs.ReturnValue})
 }
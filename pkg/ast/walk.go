@@ -0,0 +1,113 @@
+package ast
+
+import "fmt"
+
+// Visitor visits the nodes of a tree with Walk
+type Visitor interface {
+	// Visit visits a node. Unless the visitor returned is nil, Walk visits
+	// the children of the node with it, and then calls its Visit with nil.
+	Visit(node Node) (w Visitor)
+}
+
+// Walk visits a node and its descendants with a visitor, in depth-first
+// source order. Missing children, like the alternative of an if expression
+// without else, are not visited.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		walkStatements(v, node.Statements)
+	case *BlockStatement:
+		walkStatements(v, node.Statements)
+	case *LetStatement:
+		if node.Name != nil {
+			Walk(v, node.Name)
+		}
+		walk(v, node.Value)
+	case *ReturnStatement:
+		walk(v, node.ReturnValue)
+	case *ExpressionStatement:
+		walk(v, node.Expression)
+	case *PrefixExpression:
+		walk(v, node.Right)
+	case *InfixExpression:
+		walk(v, node.Left)
+		walk(v, node.Right)
+	case *IfExpression:
+		walk(v, node.Condition)
+		if node.Consequence != nil {
+			Walk(v, node.Consequence)
+		}
+		if node.Alternative != nil {
+			Walk(v, node.Alternative)
+		}
+	case *FunctionLiteral:
+		walkParameters(v, node.Parameters)
+		if node.Body != nil {
+			Walk(v, node.Body)
+		}
+	case *MacroLiteral:
+		walkParameters(v, node.Parameters)
+		if node.Body != nil {
+			Walk(v, node.Body)
+		}
+	case *CallExpression:
+		walk(v, node.Function)
+		for _, a := range node.Arguments {
+			walk(v, a)
+		}
+	case *ArrayLiteral:
+		for _, e := range node.Elements {
+			walk(v, e)
+		}
+	case *IndexExpression:
+		walk(v, node.Left)
+		walk(v, node.Index)
+	case *Identifier, *IntegerLiteral, *StringLiteral, *Boolean, *BadStatement:
+		// no children
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", node))
+	}
+
+	v.Visit(nil)
+}
+
+// walk walks a child, if any
+func walk(v Visitor, node Node) {
+	if node != nil {
+		Walk(v, node)
+	}
+}
+
+func walkStatements(v Visitor, statements []Statement) {
+	for _, s := range statements {
+		walk(v, s)
+	}
+}
+
+func walkParameters(v Visitor, parameters []*Identifier) {
+	for _, p := range parameters {
+		if p != nil {
+			Walk(v, p)
+		}
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect calls f on a node and its descendants, in depth-first source
+// order, skipping the descendants of the nodes f returns false for. After
+// the descendants of a node, f is called with nil.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,210 @@
+package ast
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func ident(name string) *Identifier { return &Identifier{Value: name} }
+
+func integer(value int64) *IntegerLiteral { return &IntegerLiteral{Value: value} }
+
+func block(statements ...Statement) *BlockStatement {
+	return &BlockStatement{Statements: statements}
+}
+
+func expression(e Expression) *ExpressionStatement { return &ExpressionStatement{Expression: e} }
+
+func TestInspect(t *testing.T) {
+	// let f = fn(a) { if (!a) { return [a][1] } else { f(a + 2) } };
+	program := &Program{Statements: []Statement{
+		&LetStatement{Name: ident("f"), Value: &FunctionLiteral{
+			Parameters: []*Identifier{ident("a")},
+			Body: block(expression(&IfExpression{
+				Condition:   &PrefixExpression{Operator: "!", Right: ident("a")},
+				Consequence: block(&ReturnStatement{ReturnValue: &IndexExpression{Left: &ArrayLiteral{Elements: []Expression{ident("a")}}, Index: integer(1)}}),
+				Alternative: block(expression(&CallExpression{
+					Function:  ident("f"),
+					Arguments: []Expression{&InfixExpression{Left: ident("a"), Operator: "+", Right: integer(2)}},
+				})),
+			})),
+		}},
+	}}
+
+	var visited []string
+	Inspect(program, func(node Node) bool {
+		switch node := node.(type) {
+		case nil:
+			visited = append(visited, ")")
+		case *Identifier:
+			visited = append(visited, node.Value)
+		case *IntegerLiteral:
+			visited = append(visited, strconv.FormatInt(node.Value, 10))
+		default:
+			visited = append(visited, strings.TrimPrefix(reflect.TypeOf(node).String(), "*ast."))
+		}
+		return true
+	})
+
+	expected := "Program LetStatement f ) FunctionLiteral a ) BlockStatement ExpressionStatement IfExpression " +
+		"PrefixExpression a ) ) BlockStatement ReturnStatement IndexExpression ArrayLiteral a ) ) 1 ) ) ) ) " +
+		"BlockStatement ExpressionStatement CallExpression f ) InfixExpression a ) 2 ) ) ) ) ) ) ) ) ) ) )"
+	if got := strings.Join(visited, " "); got != expected {
+		t.Errorf("wrong nodes visited.\nwant=%s\ngot=%s", expected, got)
+	}
+}
+
+func TestInspectSkip(t *testing.T) {
+	// fn(a) { a }; if (b) { b }
+	program := &Program{Statements: []Statement{
+		expression(&FunctionLiteral{Parameters: []*Identifier{ident("a")}, Body: block(expression(ident("a")))}),
+		expression(&IfExpression{Condition: ident("b"), Consequence: block(expression(ident("b")))}),
+	}}
+
+	var names []string
+	Inspect(program, func(node Node) bool {
+		if i, ok := node.(*Identifier); ok {
+			names = append(names, i.Value)
+		}
+		_, ok := node.(*FunctionLiteral)
+		return !ok
+	})
+
+	if !reflect.DeepEqual(names, []string{"b", "b"}) {
+		t.Errorf("wrong identifiers visited. got=%v", names)
+	}
+}
+
+func TestModify(t *testing.T) {
+	// one becomes two, and a becomes b
+	modifier := func(node Node) Node {
+		switch node := node.(type) {
+		case *IntegerLiteral:
+			if node.Value == 1 {
+				return integer(2)
+			}
+		case *Identifier:
+			if node.Value == "a" {
+				return ident("b")
+			}
+		}
+		return node
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{integer(1), integer(2)},
+		{&Program{Statements: []Statement{expression(integer(1))}}, &Program{Statements: []Statement{expression(integer(2))}}},
+		{&InfixExpression{Left: integer(1), Operator: "+", Right: integer(1)}, &InfixExpression{Left: integer(2), Operator: "+", Right: integer(2)}},
+		{&PrefixExpression{Operator: "-", Right: integer(1)}, &PrefixExpression{Operator: "-", Right: integer(2)}},
+		{&IndexExpression{Left: integer(1), Index: integer(1)}, &IndexExpression{Left: integer(2), Index: integer(2)}},
+		{
+			&IfExpression{Condition: integer(1), Consequence: block(expression(integer(1))), Alternative: block(expression(integer(1)))},
+			&IfExpression{Condition: integer(2), Consequence: block(expression(integer(2))), Alternative: block(expression(integer(2)))},
+		},
+		{
+			&IfExpression{Condition: integer(1), Consequence: block(expression(integer(1)))},
+			&IfExpression{Condition: integer(2), Consequence: block(expression(integer(2)))},
+		},
+		{&ReturnStatement{ReturnValue: integer(1)}, &ReturnStatement{ReturnValue: integer(2)}},
+		{&LetStatement{Name: ident("a"), Value: integer(1)}, &LetStatement{Name: ident("b"), Value: integer(2)}},
+		{
+			&FunctionLiteral{Parameters: []*Identifier{ident("a"), ident("c")}, Body: block(expression(ident("a")))},
+			&FunctionLiteral{Parameters: []*Identifier{ident("b"), ident("c")}, Body: block(expression(ident("b")))},
+		},
+		{
+			&MacroLiteral{Parameters: []*Identifier{ident("a")}, Body: block(expression(integer(1)))},
+			&MacroLiteral{Parameters: []*Identifier{ident("b")}, Body: block(expression(integer(2)))},
+		},
+		{&CallExpression{Function: ident("a"), Arguments: []Expression{integer(1)}}, &CallExpression{Function: ident("b"), Arguments: []Expression{integer(2)}}},
+		{&ArrayLiteral{Elements: []Expression{integer(1), integer(3)}}, &ArrayLiteral{Elements: []Expression{integer(2), integer(3)}}},
+	}
+
+	for _, tt := range tests {
+		modified := Modify(tt.input, modifier)
+		if !reflect.DeepEqual(modified, tt.expected) {
+			t.Errorf("wrong modification.\nwant=%#v\ngot=%#v", tt.expected, modified)
+		}
+	}
+}
+
+func TestMissingChildren(t *testing.T) {
+	// nodes built by hand or decoded may miss children
+	tests := []struct {
+		node    Node
+		visited int
+	}{
+		{&FunctionLiteral{}, 1},
+		{&FunctionLiteral{Parameters: []*Identifier{nil, ident("a")}}, 2},
+		{&MacroLiteral{}, 1},
+		{&IfExpression{Condition: integer(1)}, 2},
+		{&LetStatement{Value: integer(1)}, 2},
+		{&LetStatement{}, 1},
+		{&ReturnStatement{}, 1},
+		{&ExpressionStatement{}, 1},
+		{&PrefixExpression{}, 1},
+		{&InfixExpression{}, 1},
+		{&CallExpression{}, 1},
+		{&IndexExpression{}, 1},
+	}
+
+	for _, tt := range tests {
+		node := tt.node
+
+		var visited int
+		Inspect(node, func(n Node) bool {
+			if n != nil {
+				visited++
+			}
+			return true
+		})
+		if visited != tt.visited {
+			t.Errorf("wrong nodes visited in %#v. want=%d, got=%d", node, tt.visited, visited)
+		}
+
+		if modified := Modify(node, func(n Node) Node { return n }); modified != node {
+			t.Errorf("wrong modification of %#v. got=%#v", node, modified)
+		}
+	}
+}
+
+func TestModifyRemovesStatements(t *testing.T) {
+	program := &Program{Statements: []Statement{
+		expression(integer(1)),
+		expression(&FunctionLiteral{Body: block(expression(integer(2)), expression(integer(1)))}),
+	}}
+
+	Modify(program, func(node Node) Node {
+		if s, ok := node.(*ExpressionStatement); ok && reflect.DeepEqual(s.Expression, integer(1)) {
+			return nil
+		}
+		return node
+	})
+
+	expected := &Program{Statements: []Statement{
+		expression(&FunctionLiteral{Body: block(expression(integer(2)))}),
+	}}
+	if !reflect.DeepEqual(program, expected) {
+		t.Errorf("wrong program.\nwant=%#v\ngot=%#v", expected, program)
+	}
+}
+
+func TestModifyWrongKind(t *testing.T) {
+	defer func() {
+		r := recover()
+		if r != "ast.Modify: *ast.Identifier replaced by *ast.IntegerLiteral" {
+			t.Errorf("wrong panic. got=%v", r)
+		}
+	}()
+
+	Modify(&FunctionLiteral{Parameters: []*Identifier{ident("a")}, Body: block()}, func(node Node) Node {
+		if _, ok := node.(*Identifier); ok {
+			return integer(1)
+		}
+		return node
+	})
+}
@@ -42,6 +42,16 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+
+	// Superinstructions, each one replaces a sequence of the instructions
+	// above, as named, and is only emitted by the peephole optimizer.
+	OpGetLocalConstantAdd
+	OpGetLocalConstantSub
+	OpGetLocalGetLocal
+	OpEqualJumpNotTruthy
+	OpNotEqualJumpNotTruthy
+	OpGreaterThanJumpNotTruthy
+	OpGetBuiltinGetLocalCall
 )
 
 // Definition is a struct that holds the name and the number of operands for an opcode.
@@ -81,6 +91,14 @@ var Definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}},
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+
+	OpGetLocalConstantAdd:      {"OpGetLocalConstantAdd", []int{1, 2}},
+	OpGetLocalConstantSub:      {"OpGetLocalConstantSub", []int{1, 2}},
+	OpGetLocalGetLocal:         {"OpGetLocalGetLocal", []int{1, 1}},
+	OpEqualJumpNotTruthy:       {"OpEqualJumpNotTruthy", []int{2}},
+	OpNotEqualJumpNotTruthy:    {"OpNotEqualJumpNotTruthy", []int{2}},
+	OpGreaterThanJumpNotTruthy: {"OpGreaterThanJumpNotTruthy", []int{2}},
+	OpGetBuiltinGetLocalCall:   {"OpGetBuiltinGetLocalCall", []int{1, 1}},
 }
 
 // Lookup returns the definition for the given opcode.
@@ -135,7 +153,7 @@ func (ins Instructions) String() string {
 			return fmt.Sprintf("ERROR: %s\n", err)
 		}
 
-		operands, read := readOperands(def, ins[i+1:])
+		operands, read := ReadOperands(def, ins[i+1:])
 
 		out += fmt.Sprintf("%04d %s\n", i, formatInstruction(def, operands))
 
@@ -145,8 +163,22 @@ func (ins Instructions) String() string {
 	return out
 }
 
-// readOperands reads the operands from the bytecode instructions.
-func readOperands(def *Definition, ins Instructions) ([]int, int) {
+// InstructionAt returns the instruction at position ip formatted as String
+// does, without the position.
+func (ins Instructions) InstructionAt(ip int) string {
+	def, err := Lookup(ins[ip])
+	if err != nil {
+		return fmt.Sprintf("ERROR: %s", err)
+	}
+
+	operands, _ := ReadOperands(def, ins[ip+1:])
+
+	return formatInstruction(def, operands)
+}
+
+// ReadOperands reads the operands of an instruction and returns them with the
+// number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
 	operands := make([]int, len(def.OperandWidths))
 
 	offset := 0
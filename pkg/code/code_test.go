@@ -56,6 +56,10 @@ func TestInstructionsString(t *testing.T) {
 		t.Errorf("instructions wrongly formatted.\nwant=%q\ngot=%q",
 			expected, concatted.String())
 	}
+
+	if concatted.InstructionAt(9) != "OpClosure 65535 255" {
+		t.Errorf("instruction wrongly formatted. got=%q", concatted.InstructionAt(9))
+	}
 }
 
 func TestReadOperands(t *testing.T) {
@@ -77,7 +81,7 @@ func TestReadOperands(t *testing.T) {
 			t.Fatalf("definition not found: %q\n", err)
 		}
 
-		operandsRead, n := readOperands(def, instruction[1:])
+		operandsRead, n := ReadOperands(def, instruction[1:])
 		if n != tt.bytesRead {
 			t.Fatalf("n wrong. want=%d, got=%d", tt.bytesRead, n)
 		}
@@ -0,0 +1,50 @@
+package code
+
+import "sort"
+
+// SourceMapEntry is the source position of the instructions starting at
+// Position, up to the next entry.
+type SourceMapEntry struct {
+	Position int
+	Line     int
+	Column   int
+}
+
+// SourceMap maps instructions to the source positions they were compiled
+// from. Entries are sorted by position.
+type SourceMap []SourceMapEntry
+
+// Add maps the instructions from position on to a source position, unless
+// they already are.
+func (m SourceMap) Add(position, line, column int) SourceMap {
+	if len(m) > 0 {
+		last := &m[len(m)-1]
+		if last.Line == line && last.Column == column {
+			return m
+		}
+		if last.Position == position {
+			last.Line, last.Column = line, column
+			return m
+		}
+	}
+
+	return append(m, SourceMapEntry{Position: position, Line: line, Column: column})
+}
+
+// Truncate drops the entries of the instructions from position on, after
+// they are removed.
+func (m SourceMap) Truncate(position int) SourceMap {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Position >= position })
+	return m[:i]
+}
+
+// Lookup returns the source position of the instruction at ip, or 0, 0 when
+// it is unknown.
+func (m SourceMap) Lookup(ip int) (line, column int) {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Position > ip })
+	if i == 0 {
+		return 0, 0
+	}
+
+	return m[i-1].Line, m[i-1].Column
+}
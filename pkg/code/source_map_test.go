@@ -0,0 +1,44 @@
+package code
+
+import "testing"
+
+func TestSourceMap(t *testing.T) {
+	m := SourceMap{}
+	m = m.Add(0, 1, 1)
+	m = m.Add(3, 1, 1)
+	m = m.Add(3, 2, 5)
+	m = m.Add(4, 2, 7)
+	m = m.Add(9, 4, 1)
+
+	if len(m) != 4 {
+		t.Fatalf("wrong number of entries. want=4, got=%d: %v", len(m), m)
+	}
+
+	tests := []struct {
+		ip     int
+		line   int
+		column int
+	}{
+		{0, 1, 1},
+		{2, 1, 1},
+		{3, 2, 5},
+		{8, 2, 7},
+		{20, 4, 1},
+	}
+
+	for _, tt := range tests {
+		line, column := m.Lookup(tt.ip)
+		if line != tt.line || column != tt.column {
+			t.Errorf("wrong position of %d. want=%d:%d, got=%d:%d", tt.ip, tt.line, tt.column, line, column)
+		}
+	}
+
+	m = m.Truncate(4)
+	if line, _ := m.Lookup(20); line != 2 {
+		t.Errorf("wrong line after truncating. want=2, got=%d", line)
+	}
+
+	if line, column := (SourceMap{}).Lookup(0); line != 0 || column != 0 {
+		t.Errorf("wrong position in empty map. got=%d:%d", line, column)
+	}
+}
@@ -1,10 +1,9 @@
 package compiler
 
 import (
-	"fmt"
-
 	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
 	"github.com/jalopez/go-monkey-interpreter/pkg/code"
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
 	"github.com/jalopez/go-monkey-interpreter/pkg/object"
 	"github.com/jalopez/go-monkey-interpreter/pkg/token"
 )
@@ -18,10 +17,17 @@ type EmittedInstruction struct {
 // CompilationScope holds the compilation scope.
 type CompilationScope struct {
 	instructions        code.Instructions
+	sourceMap           code.SourceMap
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
 }
 
+// sourcePosition is a line and column of the source
+type sourcePosition struct {
+	line   int
+	column int
+}
+
 // Compiler compiles the AST into bytecode.
 type Compiler struct {
 	constants   []object.Object
@@ -29,12 +35,22 @@ type Compiler struct {
 
 	scopes     []CompilationScope
 	scopeIndex int
+
+	// position is the source position of the node being compiled, which
+	// the instructions emitted are mapped to
+	position sourcePosition
+
+	superinstructions bool
 }
 
 // Bytecode holds the compiled bytecode.
 type Bytecode struct {
 	Instructions code.Instructions
+	SourceMap    code.SourceMap
 	Constants    []object.Object
+	NumGlobals   int
+	// GlobalNames are the names of the globals, by index
+	GlobalNames []string
 }
 
 // New creates a new compiler.
@@ -67,8 +83,20 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 	return compiler
 }
 
+// EnableSuperinstructions makes the compiler replace common sequences of
+// instructions by superinstructions, which run faster in the VM.
+func (c *Compiler) EnableSuperinstructions() {
+	c.superinstructions = true
+}
+
 // Compile compiles the AST into bytecode.
 func (c *Compiler) Compile(node ast.Node) error {
+	if line, column := ast.Position(node); line > 0 {
+		previous := c.position
+		c.position = sourcePosition{line: line, column: column}
+		defer func() { c.position = previous }()
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
 		for _, s := range node.Statements {
@@ -102,7 +130,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 
 		if !ok {
-			return fmt.Errorf("undefined variable %s", node.Value)
+			return diagnostic.New(diagnostic.UndefinedVariable, node.Token, "undefined variable %s", node.Value)
 		}
 
 		c.loadSymbol(symbol)
@@ -166,7 +194,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case token.BANG:
 			c.emit(code.OpBang)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return diagnostic.New(diagnostic.UnknownOperator, node.Token, "unknown operator %s", node.Operator)
 		}
 
 	case *ast.ArrayLiteral:
@@ -234,7 +262,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case token.GT:
 			c.emit(code.OpGreaterThan)
 		default:
-			return fmt.Errorf("unknown operator %s", node.Operator)
+			return diagnostic.New(diagnostic.UnknownOperator, node.Token, "unknown operator %s", node.Operator)
 		}
 
 	case *ast.ReturnStatement:
@@ -245,6 +273,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		c.emit(code.OpReturnValue)
 
+	case *ast.MacroLiteral:
+		return diagnostic.New(diagnostic.InvalidMacro, node.Token, "macros can only be bound by let statements at the top level")
+
 	case *ast.FunctionLiteral:
 		c.enterScope()
 
@@ -270,16 +301,24 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
-		instructions := c.leaveScope()
+		localNames := c.symbolTable.Names()
+		instructions, sourceMap := c.leaveScope()
 
-		for _, s := range freeSymbols {
+		freeNames := make([]string, len(freeSymbols))
+		for i, s := range freeSymbols {
 			c.loadSymbol(s)
+			freeNames[i] = s.Name
 		}
 
 		compiledFn := &object.CompiledFunction{
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			Line:          c.position.line,
+			SourceMap:     sourceMap,
+			LocalNames:    localNames,
+			FreeNames:     freeNames,
 		}
 		fnIndex := c.addConstant(compiledFn)
 		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
@@ -300,7 +339,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpCall, len(node.Arguments))
 
 	case *ast.IntegerLiteral:
-		integer := &object.Integer{Value: node.Value}
+		integer := object.NewInteger(node.Value)
 		c.emit(code.OpConstant, c.addConstant(integer))
 
 	case *ast.StringLiteral:
@@ -320,9 +359,18 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 // Bytecode returns the compiled bytecode.
 func (c *Compiler) Bytecode() *Bytecode {
+	instructions := c.currentInstructions()
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	if c.superinstructions {
+		instructions, sourceMap = optimize(instructions, sourceMap)
+	}
+
 	return &Bytecode{
-		Instructions: c.currentInstructions(),
+		Instructions: instructions,
+		SourceMap:    sourceMap,
 		Constants:    c.constants,
+		NumGlobals:   c.symbolTable.numDefinitions,
+		GlobalNames:  c.symbolTable.Names(),
 	}
 }
 
@@ -357,15 +405,20 @@ func (c *Compiler) enterScope() {
 	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
 }
 
-func (c *Compiler) leaveScope() code.Instructions {
+func (c *Compiler) leaveScope() (code.Instructions, code.SourceMap) {
 	instructions := c.currentInstructions()
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
 
 	c.scopes = c.scopes[:len(c.scopes)-1]
 	c.scopeIndex--
 
 	c.symbolTable = c.symbolTable.outer
 
-	return instructions
+	if c.superinstructions {
+		instructions, sourceMap = optimize(instructions, sourceMap)
+	}
+
+	return instructions, sourceMap
 }
 
 func (c *Compiler) addConstant(obj object.Object) int {
@@ -378,6 +431,11 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
 
+	if c.position.line > 0 {
+		scope := &c.scopes[c.scopeIndex]
+		scope.sourceMap = scope.sourceMap.Add(pos, c.position.line, c.position.column)
+	}
+
 	c.setLastInstruction(op, pos)
 
 	return pos
@@ -415,6 +473,7 @@ func (c *Compiler) removeLastPop() {
 	newInstructions := old[:last.Position]
 
 	c.scopes[c.scopeIndex].instructions = newInstructions
+	c.scopes[c.scopeIndex].sourceMap = c.scopes[c.scopeIndex].sourceMap.Truncate(last.Position)
 	c.scopes[c.scopeIndex].lastInstruction = previous
 }
 
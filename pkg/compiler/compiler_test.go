@@ -8,6 +8,7 @@ import (
 
 	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
 	"github.com/jalopez/go-monkey-interpreter/pkg/code"
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
 	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
 	"github.com/jalopez/go-monkey-interpreter/pkg/object"
 	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
@@ -948,6 +949,90 @@ func TestCompilerScopes(t *testing.T) {
 	}
 }
 
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input   string
+		code    string
+		line    int
+		start   int // columns of the span
+		end     int
+		message string
+	}{
+		{"let x = 1;\nx + foo;", diagnostic.UndefinedVariable, 2, 5, 8, "undefined variable foo"},
+		{"fn(a) {\n  fn() { b }\n}", diagnostic.UndefinedVariable, 2, 10, 11, "undefined variable b"},
+		{"let m = fn() { macro(x) { x } };", diagnostic.InvalidMacro, 1, 16, 21, "macros can only be bound by let statements at the top level"},
+	}
+
+	for _, tt := range tests {
+		err := New().Compile(parse(tt.input))
+
+		d, ok := err.(*diagnostic.Diagnostic)
+		if !ok {
+			t.Fatalf("error of %q is not a diagnostic. got=%T (%v)", tt.input, err, err)
+		}
+
+		start := diagnostic.Position{Line: tt.line, Column: tt.start}
+		end := diagnostic.Position{Line: tt.line, Column: tt.end}
+		if d.Code != tt.code || d.Start != start || d.End != end || d.Message != tt.message {
+			t.Errorf("wrong diagnostic for %q. want=%s %v-%v %q, got=%s %v-%v %q",
+				tt.input, tt.code, start, end, tt.message, d.Code, d.Start, d.End, d.Message)
+		}
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	input := `let f = fn(x) {
+  x + 1
+};
+f(2);`
+
+	for _, superinstructions := range []bool{false, true} {
+		compiler := New()
+		if superinstructions {
+			compiler.EnableSuperinstructions()
+		}
+		err := compiler.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+		fn := bytecode.Constants[1].(*object.CompiledFunction)
+		if fn.Name != "f" {
+			t.Errorf("wrong function name. want=%q, got=%q", "f", fn.Name)
+		}
+
+		tests := []struct {
+			instructions code.Instructions
+			sourceMap    code.SourceMap
+			expected     []int
+		}{
+			{bytecode.Instructions, bytecode.SourceMap, []int{1, 1, 4, 4, 4, 4}},
+			{fn.Instructions, fn.SourceMap, []int{2, 2, 2, 2}},
+		}
+
+		for _, tt := range tests {
+			lines := []int{}
+			for ip := 0; ip < len(tt.instructions); {
+				line, _ := tt.sourceMap.Lookup(ip)
+				lines = append(lines, line)
+
+				def, _ := code.Lookup(tt.instructions[ip])
+				_, read := code.ReadOperands(def, tt.instructions[ip+1:])
+				ip += 1 + read
+			}
+
+			if superinstructions && len(lines) < len(tt.expected) {
+				tt.expected = tt.expected[:len(lines)]
+			}
+			if fmt.Sprint(lines) != fmt.Sprint(tt.expected) {
+				t.Errorf("wrong lines (superinstructions=%t). want=%v, got=%v\n%s",
+					superinstructions, tt.expected, lines, tt.instructions)
+			}
+		}
+	}
+}
+
 func testConstants(
 	t *testing.T,
 	expected []interface{},
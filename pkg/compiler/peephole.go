@@ -0,0 +1,201 @@
+package compiler
+
+import (
+	"github.com/jalopez/go-monkey-interpreter/pkg/code"
+)
+
+// superinstruction is a sequence of instructions replaced by a single one,
+// whose operands are the operands of the sequence in order
+type superinstruction struct {
+	pattern []code.Opcode
+	fused   code.Opcode
+	// matchOperands checks the operands of the sequence, when not all of
+	// them can be fused
+	matchOperands func(ins []decodedInstruction) bool
+}
+
+var superinstructions = []superinstruction{
+	{
+		pattern: []code.Opcode{code.OpGetLocal, code.OpConstant, code.OpAdd},
+		fused:   code.OpGetLocalConstantAdd,
+	},
+	{
+		pattern: []code.Opcode{code.OpGetLocal, code.OpConstant, code.OpSub},
+		fused:   code.OpGetLocalConstantSub,
+	},
+	{
+		pattern: []code.Opcode{code.OpGetBuiltin, code.OpGetLocal, code.OpCall},
+		fused:   code.OpGetBuiltinGetLocalCall,
+		// only calls with the local as their single argument
+		matchOperands: func(ins []decodedInstruction) bool { return ins[2].operands[0] == 1 },
+	},
+	{
+		pattern: []code.Opcode{code.OpEqual, code.OpJumpNotTruthy},
+		fused:   code.OpEqualJumpNotTruthy,
+	},
+	{
+		pattern: []code.Opcode{code.OpNotEqual, code.OpJumpNotTruthy},
+		fused:   code.OpNotEqualJumpNotTruthy,
+	},
+	{
+		pattern: []code.Opcode{code.OpGreaterThan, code.OpJumpNotTruthy},
+		fused:   code.OpGreaterThanJumpNotTruthy,
+	},
+	{
+		pattern: []code.Opcode{code.OpGetLocal, code.OpGetLocal},
+		fused:   code.OpGetLocalGetLocal,
+	},
+}
+
+type decodedInstruction struct {
+	op       code.Opcode
+	operands []int
+	position int
+}
+
+// optimize replaces sequences of instructions by superinstructions, which
+// save the dispatch and the stack traffic between them. Sequences jumped
+// into are left untouched, and jumps and the source map are relocated to
+// the new positions.
+func optimize(ins code.Instructions, sourceMap code.SourceMap) (code.Instructions, code.SourceMap) {
+	decoded := decodeInstructions(ins)
+
+	jumpTargets := map[int]bool{}
+	for _, d := range decoded {
+		if isJump(d.op) {
+			jumpTargets[d.operands[0]] = true
+		}
+	}
+
+	// superinstructions may overlap, so choose the ones leaving the fewest
+	// instructions, from the end: remaining[i] is the number of instructions
+	// left for decoded[i:] and choices[i] the superinstruction starting at i
+	remaining := make([]int, len(decoded)+1)
+	choices := make([]*superinstruction, len(decoded))
+	for i := len(decoded) - 1; i >= 0; i-- {
+		remaining[i] = 1 + remaining[i+1]
+
+		for j := range superinstructions {
+			s := &superinstructions[j]
+			n := len(s.pattern)
+			if s.matches(decoded[i:], jumpTargets) && 1+remaining[i+n] < remaining[i] {
+				remaining[i] = 1 + remaining[i+n]
+				choices[i] = s
+			}
+		}
+	}
+
+	// replacements maps the old position of every instruction to the index
+	// of the optimized instruction replacing it
+	replacements := map[int]int{}
+	optimized := make([]decodedInstruction, 0, remaining[0])
+	for i := 0; i < len(decoded); {
+		n := 1
+		if choices[i] == nil {
+			optimized = append(optimized, decoded[i])
+		} else {
+			optimized = append(optimized, choices[i].fuse(decoded[i:]))
+			n = len(choices[i].pattern)
+		}
+
+		for _, d := range decoded[i : i+n] {
+			replacements[d.position] = len(optimized) - 1
+		}
+		i += n
+	}
+
+	// old positions of the fused instructions are never jump targets, so
+	// only the first instruction of each one needs to be mapped
+	positions := map[int]int{}
+	newPositions := make([]int, len(optimized))
+	result := code.Instructions{}
+	for i, d := range optimized {
+		positions[d.position] = len(result)
+		newPositions[i] = len(result)
+		result = append(result, code.Make(d.op, d.operands...)...)
+	}
+	positions[len(ins)] = len(result)
+
+	for _, d := range optimized {
+		if isJump(d.op) {
+			pos := positions[d.position]
+			copy(result[pos:], code.Make(d.op, positions[d.operands[0]]))
+		}
+	}
+
+	// superinstructions keep the source position of their last instruction
+	var newSourceMap code.SourceMap
+	for _, entry := range sourceMap {
+		position := newPositions[replacements[entry.Position]]
+		newSourceMap = newSourceMap.Add(position, entry.Line, entry.Column)
+	}
+
+	return result, newSourceMap
+}
+
+// matches reports whether the first instructions can be replaced by the
+// superinstruction. Only the first of them can be a jump target.
+func (s *superinstruction) matches(ins []decodedInstruction, jumpTargets map[int]bool) bool {
+	if len(ins) < len(s.pattern) {
+		return false
+	}
+
+	for i, op := range s.pattern {
+		if ins[i].op != op {
+			return false
+		}
+		if i > 0 && jumpTargets[ins[i].position] {
+			return false
+		}
+	}
+
+	return s.matchOperands == nil || s.matchOperands(ins)
+}
+
+// fuse returns the superinstruction replacing the first instructions
+func (s *superinstruction) fuse(ins []decodedInstruction) decodedInstruction {
+	operands := []int{}
+	for _, d := range ins[:len(s.pattern)] {
+		operands = append(operands, d.operands...)
+	}
+
+	def := code.Definitions[s.fused]
+
+	return decodedInstruction{
+		op:       s.fused,
+		operands: operands[:len(def.OperandWidths)],
+		position: ins[0].position,
+	}
+}
+
+func decodeInstructions(ins code.Instructions) []decodedInstruction {
+	decoded := []decodedInstruction{}
+
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			panic(err)
+		}
+
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		decoded = append(decoded, decodedInstruction{
+			op:       code.Opcode(ins[i]),
+			operands: operands,
+			position: i,
+		})
+
+		i += 1 + read
+	}
+
+	return decoded
+}
+
+func isJump(op code.Opcode) bool {
+	switch op {
+	case code.OpJump, code.OpJumpNotTruthy,
+		code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy, code.OpGreaterThanJumpNotTruthy:
+		return true
+	default:
+		return false
+	}
+}
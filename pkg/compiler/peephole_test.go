@@ -0,0 +1,154 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/code"
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []code.Instructions
+		expected []code.Instructions
+	}{
+		{
+			name: "local plus constant",
+			input: []code.Instructions{
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+				code.Make(code.OpReturnValue),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetLocalConstantAdd, 1, 2),
+				code.Make(code.OpReturnValue),
+			},
+		},
+		{
+			name: "overlapping superinstructions",
+			input: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpAdd),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpGetLocalConstantAdd, 1, 2),
+			},
+		},
+		{
+			name: "builtin called with a local",
+			input: []code.Instructions{
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpCall, 1),
+				code.Make(code.OpPop),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetBuiltinGetLocalCall, 0, 1),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			name: "builtin called with more arguments",
+			input: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpCall, 2),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpGetBuiltin, 0),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpCall, 2),
+			},
+		},
+		{
+			name: "jump into a sequence",
+			input: []code.Instructions{
+				code.Make(code.OpJump, 5),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpAdd),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpJump, 5),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpAdd),
+			},
+		},
+		{
+			name: "jumps are relocated",
+			input: []code.Instructions{
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpGreaterThan),
+				code.Make(code.OpJumpNotTruthy, 13),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpJump, 15),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpReturnValue),
+			},
+			expected: []code.Instructions{
+				code.Make(code.OpGetLocalGetLocal, 0, 1),
+				code.Make(code.OpGreaterThanJumpNotTruthy, 11),
+				code.Make(code.OpGetLocal, 0),
+				code.Make(code.OpJump, 13),
+				code.Make(code.OpGetLocal, 1),
+				code.Make(code.OpReturnValue),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		optimized, _ := optimize(concatInstructions(tt.input), nil)
+
+		err := testInstructions(tt.expected, optimized)
+		if err != nil {
+			t.Errorf("%s: %s\ngot=\n%s", tt.name, err, optimized)
+		}
+	}
+}
+
+func TestCompileWithSuperinstructions(t *testing.T) {
+	program := parse(`fn(x) { if (x == 0) { 1 } else { x - 2 } }`)
+
+	compiler := New()
+	compiler.EnableSuperinstructions()
+	err := compiler.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+
+	err = testConstants(t, []interface{}{
+		0,
+		1,
+		2,
+		[]code.Instructions{
+			code.Make(code.OpGetLocal, 0),
+			code.Make(code.OpConstant, 0),
+			code.Make(code.OpEqualJumpNotTruthy, 14),
+			code.Make(code.OpConstant, 1),
+			code.Make(code.OpJump, 18),
+			code.Make(code.OpGetLocalConstantSub, 0, 2),
+			code.Make(code.OpReturnValue),
+		},
+	}, bytecode.Constants)
+	if err != nil {
+		t.Fatalf("testConstants failed: %s", err)
+	}
+
+	err = testInstructions([]code.Instructions{
+		code.Make(code.OpClosure, 3, 0),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+}
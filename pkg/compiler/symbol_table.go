@@ -28,6 +28,8 @@ type SymbolTable struct {
 	outer          *SymbolTable
 	store          map[string]Symbol
 	numDefinitions int
+	// names are the names of the definitions, by index
+	names []string
 
 	FreeSymbols []Symbol
 }
@@ -45,6 +47,12 @@ func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
 	return s
 }
 
+// Outer returns the symbol table enclosing this one, or nil for the global
+// symbol table.
+func (s *SymbolTable) Outer() *SymbolTable {
+	return s.outer
+}
+
 // Define defines a symbol in the symbol table.
 func (s *SymbolTable) Define(name string) Symbol {
 	symbol := Symbol{Name: name, Index: s.numDefinitions}
@@ -57,9 +65,16 @@ func (s *SymbolTable) Define(name string) Symbol {
 
 	s.store[name] = symbol
 	s.numDefinitions++
+	s.names = append(s.names, name)
 	return symbol
 }
 
+// Names returns the names of the symbols defined, by index. Names defined
+// again have several indexes, the last one being the one resolved.
+func (s *SymbolTable) Names() []string {
+	return s.names
+}
+
 // DefineBuiltin defines a builtin in the symbol table.
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
@@ -335,3 +335,49 @@ func TestShadowingFunctionName(t *testing.T) {
 			expected.Name, expected, result)
 	}
 }
+
+func TestNames(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("a")
+	global.Define("b")
+	global.Define("a")
+
+	local := NewEnclosedSymbolTable(global)
+	local.DefineFunctionName("f")
+	local.Define("c")
+	local.Resolve("a")
+
+	tests := []struct {
+		table    *SymbolTable
+		expected []string
+	}{
+		{global, []string{"a", "b", "a"}},
+		{local, []string{"c"}},
+	}
+
+	for _, tt := range tests {
+		names := tt.table.Names()
+		if len(names) != len(tt.expected) {
+			t.Fatalf("wrong names. want=%v, got=%v", tt.expected, names)
+		}
+		for i, name := range tt.expected {
+			if names[i] != name {
+				t.Errorf("wrong name %d. want=%q, got=%q", i, name, names[i])
+			}
+		}
+	}
+}
+
+func TestOuter(t *testing.T) {
+	global := NewSymbolTable()
+	local := NewEnclosedSymbolTable(global)
+	nested := NewEnclosedSymbolTable(local)
+
+	if global.Outer() != nil {
+		t.Errorf("global symbol table has an outer table")
+	}
+	if local.Outer() != global || nested.Outer() != local {
+		t.Errorf("wrong outer symbol tables")
+	}
+}
@@ -0,0 +1,273 @@
+package coverage
+
+import (
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/code"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/vm"
+)
+
+// Coverage records the statements and the branches of the if expressions of
+// a Monkey program run, as a tracer of the VM or of the evaluator. Like the
+// tracers, it follows a single goroutine, so functions spawned are not
+// covered.
+type Coverage struct {
+	filename string
+	source   string
+
+	statements []*Statement
+	ifs        []*If
+
+	// nodes maps the statements, if expressions and their blocks to what
+	// they count, for the evaluator
+	nodes map[ast.Node]any
+	// positions maps the source positions of the nodes of the program to
+	// the innermost statement they are in, and those of the if expressions
+	// to them, for the VM
+	positions   map[position]*Statement
+	ifPositions map[position]*If
+
+	functions map[*object.CompiledFunction]*function
+	// pending is the conditional jump just run by the VM, whose branch is
+	// found from the next instruction
+	pending      *jump
+	pendingDepth int
+}
+
+// Statement is a statement of the program, with the number of times it was
+// run.
+type Statement struct {
+	Line   int
+	Column int
+	Count  int
+}
+
+// If is an if expression of the program, with the number of times it was
+// evaluated and the number of times each branch was taken. Ifs without an
+// alternative take their implicit one when the condition is not truthy.
+type If struct {
+	Line        int
+	Column      int
+	Count       int
+	Consequence int
+	Alternative int
+
+	node *ast.IfExpression
+}
+
+type position struct {
+	line   int
+	column int
+}
+
+// function holds the statements and the conditional jumps of a compiled
+// function, by the position of their instructions.
+type function struct {
+	// statements are the statements starting at every instruction, if any
+	statements []*Statement
+	jumps      map[int]*jump
+}
+
+// jump is the conditional jump of an if expression. Its consequence
+// continues at the next instruction.
+type jump struct {
+	ifExpression *If
+	next         int
+}
+
+var conditionalJumps = map[code.Opcode]bool{
+	code.OpJumpNotTruthy:            true,
+	code.OpEqualJumpNotTruthy:       true,
+	code.OpNotEqualJumpNotTruthy:    true,
+	code.OpGreaterThanJumpNotTruthy: true,
+}
+
+// New creates the coverage of a program parsed from the source of filename.
+func New(filename string, source string, program *ast.Program) *Coverage {
+	c := &Coverage{
+		filename:    filename,
+		source:      source,
+		nodes:       map[ast.Node]any{},
+		positions:   map[position]*Statement{},
+		ifPositions: map[position]*If{},
+		functions:   map[*object.CompiledFunction]*function{},
+	}
+	ast.Walk(recorder{c, nil}, program)
+
+	return c
+}
+
+// Statements returns the statements of the program, in source order.
+func (c *Coverage) Statements() []*Statement {
+	return c.statements
+}
+
+// Ifs returns the if expressions of the program, in source order.
+func (c *Coverage) Ifs() []*If {
+	return c.ifs
+}
+
+// VMTracer returns the tracer recording the coverage of the program
+// compiled and run by the VM.
+func (c *Coverage) VMTracer() vm.Tracer {
+	return vmTracer{c}
+}
+
+// EvalTracer returns the tracer recording the coverage of the program
+// evaluated.
+func (c *Coverage) EvalTracer() object.EvalTracer {
+	return evalTracer{c}
+}
+
+// recorder records the statements and if expressions of the nodes it
+// visits, in statement
+type recorder struct {
+	c         *Coverage
+	statement *Statement
+}
+
+func (v recorder) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		return nil
+	}
+
+	c, statement := v.c, v.statement
+	line, column := ast.Position(node)
+
+	switch node := node.(type) {
+	case *ast.LetStatement, *ast.ReturnStatement, *ast.ExpressionStatement:
+		statement = &Statement{Line: line, Column: column}
+		c.statements = append(c.statements, statement)
+		c.nodes[node] = statement
+	case *ast.IfExpression:
+		ifExpression := &If{Line: line, Column: column, node: node}
+		c.ifs = append(c.ifs, ifExpression)
+		c.nodes[node] = ifExpression
+		c.nodes[node.Consequence] = ifExpression
+		if node.Alternative != nil {
+			c.nodes[node.Alternative] = ifExpression
+		}
+		c.ifPositions[position{line, column}] = ifExpression
+	}
+
+	if statement != nil && line > 0 {
+		c.positions[position{line, column}] = statement
+	}
+
+	return recorder{c, statement}
+}
+
+// function returns the statements and conditional jumps of a compiled
+// function, found from its source map
+func (c *Coverage) function(fn *object.CompiledFunction) *function {
+	f, ok := c.functions[fn]
+	if ok {
+		return f
+	}
+
+	f = &function{
+		statements: make([]*Statement, len(fn.Instructions)),
+		jumps:      map[int]*jump{},
+	}
+	c.functions[fn] = f
+
+	// the instructions of a statement follow the first one, apart from
+	// those of the statements nested in it
+	seen := map[*Statement]bool{}
+	for _, entry := range fn.SourceMap {
+		s := c.positions[position{entry.Line, entry.Column}]
+		if s != nil && !seen[s] {
+			seen[s] = true
+			f.statements[entry.Position] = s
+		}
+	}
+
+	ins := fn.Instructions
+	for ip := 0; ip < len(ins); {
+		def, err := code.Lookup(ins[ip])
+		if err != nil {
+			break
+		}
+		_, read := code.ReadOperands(def, ins[ip+1:])
+
+		if conditionalJumps[code.Opcode(ins[ip])] {
+			line, column := fn.SourceMap.Lookup(ip)
+			if ifExpression, ok := c.ifPositions[position{line, column}]; ok {
+				f.jumps[ip] = &jump{ifExpression: ifExpression, next: ip + 1 + read}
+			}
+		}
+
+		ip += 1 + read
+	}
+
+	return f
+}
+
+type vmTracer struct {
+	c *Coverage
+}
+
+func (t vmTracer) OnInstruction(e vm.TraceEvent) {
+	c := t.c
+
+	if c.pending != nil {
+		if e.Depth == c.pendingDepth {
+			if e.IP == c.pending.next {
+				c.pending.ifExpression.Consequence++
+			} else {
+				c.pending.ifExpression.Alternative++
+			}
+		}
+		c.pending = nil
+	}
+
+	f := c.function(e.Function)
+	if e.IP >= len(f.statements) {
+		return
+	}
+	if s := f.statements[e.IP]; s != nil {
+		s.Count++
+	}
+	if j, ok := f.jumps[e.IP]; ok {
+		j.ifExpression.Count++
+		c.pending = j
+		c.pendingDepth = e.Depth
+	}
+}
+
+func (t vmTracer) OnCall(vm.TraceEvent) {}
+
+func (t vmTracer) OnReturn(vm.TraceEvent) {}
+
+func (t vmTracer) OnError(vm.TraceEvent, error) {}
+
+type evalTracer struct {
+	c *Coverage
+}
+
+func (t evalTracer) OnNode(node ast.Node, _ *object.Environment) {
+	switch counted := t.c.nodes[node].(type) {
+	case *Statement:
+		counted.Count++
+	case *If:
+		switch node {
+		case counted.node:
+			counted.Count++
+			// taken unless the consequence is evaluated next
+			if counted.node.Alternative == nil {
+				counted.Alternative++
+			}
+		case counted.node.Consequence:
+			counted.Consequence++
+			if counted.node.Alternative == nil {
+				counted.Alternative--
+			}
+		case counted.node.Alternative:
+			counted.Alternative++
+		}
+	}
+}
+
+func (t evalTracer) OnCall(object.Object) {}
+
+func (t evalTracer) OnReturn(object.Object, object.Object) {}
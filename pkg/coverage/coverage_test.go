@@ -0,0 +1,213 @@
+package coverage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/compiler"
+	"github.com/jalopez/go-monkey-interpreter/pkg/eval"
+	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+	"github.com/jalopez/go-monkey-interpreter/pkg/vm"
+)
+
+const coveredInput = `let abs = fn(x) {
+  if (x < 0) {
+    return -x;
+  }
+  x
+};
+let sign = fn(x) { if (x > 0) { 1 } else { if (x == 0) { 0 } else { -1 } } };
+let unused = fn() {
+  puts("never");
+};
+map([1, -2], fn(x) { abs(x) });
+sign(5);
+sign(0);
+`
+
+func coverProgram(t *testing.T, engine string, input string) *Coverage {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	cover := New("test.monkey", input, program)
+
+	switch engine {
+	case "vm":
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		machine := vm.New(comp.Bytecode())
+		machine.SetTracer(cover.VMTracer())
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+	case "eval":
+		env := object.NewEnvironment()
+		env.SetTracer(cover.EvalTracer())
+		result := eval.Eval(program, env)
+		if result != nil && result.Type() == object.ERROR_OBJ {
+			t.Fatalf("eval error: %s", result.Inspect())
+		}
+	}
+
+	return cover
+}
+
+func TestStatements(t *testing.T) {
+	expected := []struct {
+		line   int
+		column int
+		count  int
+	}{
+		{1, 1, 1},
+		{2, 3, 2},
+		{3, 5, 1},
+		{5, 3, 1},
+		{7, 1, 1},
+		{7, 20, 2},
+		{7, 33, 1},
+		{7, 44, 1},
+		{7, 58, 1},
+		{7, 69, 0},
+		{8, 1, 1},
+		{9, 3, 0},
+		{11, 1, 1},
+		{11, 22, 2},
+		{12, 1, 1},
+		{13, 1, 1},
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		statements := coverProgram(t, engine, coveredInput).Statements()
+		if len(statements) != len(expected) {
+			t.Fatalf("%s: wrong number of statements. want=%d, got=%d", engine, len(expected), len(statements))
+		}
+
+		for i, want := range expected {
+			s := statements[i]
+			if s.Line != want.line || s.Column != want.column || s.Count != want.count {
+				t.Errorf("%s: wrong statement %d. want=%d:%d run %d times, got=%d:%d run %d times",
+					engine, i, want.line, want.column, want.count, s.Line, s.Column, s.Count)
+			}
+		}
+	}
+}
+
+func TestIfs(t *testing.T) {
+	expected := []struct {
+		line        int
+		count       int
+		consequence int
+		alternative int
+	}{
+		{2, 2, 1, 1},
+		{7, 2, 1, 1},
+		{7, 1, 1, 0},
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		ifs := coverProgram(t, engine, coveredInput).Ifs()
+		if len(ifs) != len(expected) {
+			t.Fatalf("%s: wrong number of ifs. want=%d, got=%d", engine, len(expected), len(ifs))
+		}
+
+		for i, want := range expected {
+			got := ifs[i]
+			if got.Line != want.line || got.Count != want.count || got.Consequence != want.consequence || got.Alternative != want.alternative {
+				t.Errorf("%s: wrong if %d. want=%+v, got=%+v", engine, i, want, *got)
+			}
+		}
+	}
+}
+
+func TestWriteLCOV(t *testing.T) {
+	expected := `TN:
+SF:test.monkey
+BRDA:2,0,0,1
+BRDA:2,0,1,1
+BRDA:7,1,0,1
+BRDA:7,1,1,1
+BRDA:7,2,0,1
+BRDA:7,2,1,0
+BRF:6
+BRH:5
+DA:1,1
+DA:2,2
+DA:3,1
+DA:5,1
+DA:7,2
+DA:8,1
+DA:9,0
+DA:11,2
+DA:12,1
+DA:13,1
+LF:10
+LH:9
+end_of_record
+`
+
+	for _, engine := range []string{"vm", "eval"} {
+		var out bytes.Buffer
+		if err := coverProgram(t, engine, coveredInput).WriteLCOV(&out); err != nil {
+			t.Fatalf("%s: error writing coverage: %s", engine, err)
+		}
+
+		if out.String() != expected {
+			t.Errorf("%s: wrong LCOV coverage.\nwant=%q\ngot=%q", engine, expected, out.String())
+		}
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var out bytes.Buffer
+	if err := coverProgram(t, "vm", coveredInput).WriteText(&out); err != nil {
+		t.Fatalf("error writing report: %s", err)
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	expected := []string{
+		"test.monkey: 90.0% of lines, 87.5% of statements, 83.3% of branches",
+		"        1:    1:let abs = fn(x) {",
+		"        2:    2:  if (x < 0) {",
+		"branch 0 taken 1",
+		"branch 1 taken 1",
+		"        1:    3:    return -x;",
+		"        -:    4:  }",
+	}
+	for i, want := range expected {
+		if lines[i] != want {
+			t.Errorf("wrong line %d. want=%q, got=%q", i, want, lines[i])
+		}
+	}
+
+	if !strings.Contains(out.String(), "    #####:    9:  puts(\"never\");\n") {
+		t.Errorf("uncovered line not marked:\n%s", out.String())
+	}
+}
+
+func TestNeverEvaluatedIf(t *testing.T) {
+	input := "let f = fn(x) { if (x) { 1 } };\n1"
+
+	for _, engine := range []string{"vm", "eval"} {
+		var out bytes.Buffer
+		if err := coverProgram(t, engine, input).WriteLCOV(&out); err != nil {
+			t.Fatalf("%s: error writing coverage: %s", engine, err)
+		}
+
+		for _, want := range []string{"BRDA:1,0,0,-\n", "BRDA:1,0,1,-\n", "BRH:0\n", "LH:2\n"} {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("%s: missing %q in coverage:\n%s", engine, want, out.String())
+			}
+		}
+	}
+}
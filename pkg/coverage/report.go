@@ -0,0 +1,130 @@
+package coverage
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Lines returns the number of times every line starting a statement was
+// run, which is the most any of its statements was.
+func (c *Coverage) Lines() map[int]int {
+	lines := map[int]int{}
+	for _, s := range c.statements {
+		if count, ok := lines[s.Line]; !ok || s.Count > count {
+			lines[s.Line] = s.Count
+		}
+	}
+
+	return lines
+}
+
+// WriteText writes the lines, statements and branches covered, and the
+// source annotated with the number of times every line was run, and the
+// number of times every branch was taken.
+func (c *Coverage) WriteText(w io.Writer) error {
+	lines := c.Lines()
+	ifs := map[int][]*If{}
+	for _, i := range c.ifs {
+		ifs[i.Line] = append(ifs[i.Line], i)
+	}
+
+	coveredStatements := 0
+	for _, s := range c.statements {
+		if s.Count > 0 {
+			coveredStatements++
+		}
+	}
+	coveredBranches := 0
+	for _, i := range c.ifs {
+		coveredBranches += covered(i.Consequence) + covered(i.Alternative)
+	}
+
+	_, err := fmt.Fprintf(w, "%s: %s of lines, %s of statements, %s of branches\n", c.filename,
+		ratio(coveredLines(lines), len(lines)), ratio(coveredStatements, len(c.statements)),
+		ratio(coveredBranches, 2*len(c.ifs)))
+	if err != nil {
+		return err
+	}
+
+	source := strings.Split(strings.TrimSuffix(c.source, "\n"), "\n")
+	for i, text := range source {
+		line := i + 1
+
+		count := "-"
+		if n, ok := lines[line]; ok && n == 0 {
+			count = "#####"
+		} else if ok {
+			count = fmt.Sprint(n)
+		}
+		_, err = fmt.Fprintf(w, "%9s:%5d:%s\n", count, line, text)
+
+		for _, ifExpression := range ifs[line] {
+			for branch, taken := range []int{ifExpression.Consequence, ifExpression.Alternative} {
+				if ifExpression.Count == 0 {
+					_, err = fmt.Fprintf(w, "branch %d never executed\n", branch)
+				} else {
+					_, err = fmt.Fprintf(w, "branch %d taken %d\n", branch, taken)
+				}
+			}
+		}
+	}
+
+	return err
+}
+
+// WriteLCOV writes the lines and branches covered in the LCOV tracefile
+// format, read by genhtml and most coverage tools.
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	lines := c.Lines()
+	numbers := make([]int, 0, len(lines))
+	for line := range lines {
+		numbers = append(numbers, line)
+	}
+	sort.Ints(numbers)
+
+	fmt.Fprintf(w, "TN:\nSF:%s\n", c.filename)
+
+	hitBranches := 0
+	for block, i := range c.ifs {
+		for branch, taken := range []int{i.Consequence, i.Alternative} {
+			if i.Count == 0 {
+				fmt.Fprintf(w, "BRDA:%d,%d,%d,-\n", i.Line, block, branch)
+				continue
+			}
+			fmt.Fprintf(w, "BRDA:%d,%d,%d,%d\n", i.Line, block, branch, taken)
+			hitBranches += covered(taken)
+		}
+	}
+	fmt.Fprintf(w, "BRF:%d\nBRH:%d\n", 2*len(c.ifs), hitBranches)
+
+	for _, line := range numbers {
+		fmt.Fprintf(w, "DA:%d,%d\n", line, lines[line])
+	}
+	_, err := fmt.Fprintf(w, "LF:%d\nLH:%d\nend_of_record\n", len(lines), coveredLines(lines))
+
+	return err
+}
+
+func coveredLines(lines map[int]int) int {
+	n := 0
+	for _, count := range lines {
+		n += covered(count)
+	}
+	return n
+}
+
+func covered(count int) int {
+	if count > 0 {
+		return 1
+	}
+	return 0
+}
+
+func ratio(n, total int) string {
+	if total == 0 {
+		return "100.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(n)/float64(total))
+}
@@ -0,0 +1,360 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/coverage"
+	"github.com/jalopez/go-monkey-interpreter/pkg/debugger"
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
+	"github.com/jalopez/go-monkey-interpreter/pkg/eval"
+	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+)
+
+// threadID is the id of the only thread of the programs debugged
+const threadID = 1
+
+// Server serves the Debug Adapter Protocol, debugging a Monkey program on
+// the VM for an editor. Requests are handled one at a time, while the
+// program runs on its own goroutine, and the output of the program is sent
+// as output events.
+type Server struct {
+	in *bufio.Reader
+
+	writeMutex sync.Mutex
+	out        io.Writer
+	seq        int
+
+	mutex       sync.Mutex
+	debugger    *debugger.Debugger
+	path        string
+	source      string
+	lines       map[int]int
+	stopOnEntry bool
+	running     bool
+	// frames and references are the frames of the stopped program and the
+	// variables of their scopes, by reference, until it is resumed
+	frames     []debugger.Frame
+	references [][]debugger.Variable
+}
+
+// NewServer creates a server reading requests from in and writing responses
+// and events to out.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out}
+}
+
+// Serve handles requests until the client disconnects or closes its
+// stream.
+func (s *Server) Serve() error {
+	for {
+		req, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		s.mutex.Lock()
+		done := s.handle(req)
+		s.mutex.Unlock()
+
+		if done {
+			return nil
+		}
+	}
+}
+
+// handle handles a request, and reports whether the session is over
+func (s *Server) handle(req *request) bool {
+	switch req.Command {
+	case "initialize":
+		s.respond(req, map[string]any{"supportsConfigurationDoneRequest": true})
+	case "launch":
+		var args launchArguments
+		if err := s.launch(req, &args); err != nil {
+			s.fail(req, err.Error())
+			return false
+		}
+		s.respond(req, nil)
+		s.event("initialized", nil)
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if !s.arguments(req, &args) || !s.launched(req) {
+			return false
+		}
+
+		for _, line := range s.debugger.Breakpoints() {
+			s.debugger.ClearBreakpoint(line)
+		}
+		breakpoints := make([]breakpoint, len(args.Breakpoints))
+		for i, b := range args.Breakpoints {
+			s.debugger.SetBreakpoint(b.Line)
+			_, verified := s.lines[b.Line]
+			breakpoints[i] = breakpoint{Verified: verified, Line: b.Line}
+		}
+		s.respond(req, map[string]any{"breakpoints": breakpoints})
+	case "configurationDone":
+		if !s.launched(req) {
+			return false
+		}
+		s.respond(req, nil)
+
+		stopOnEntry := s.stopOnEntry
+		s.resume(func(d *debugger.Debugger) debugger.Stop {
+			stop := d.Start()
+			if stop.Reason == debugger.Entry && !stopOnEntry {
+				stop = d.Continue()
+			}
+			return stop
+		})
+	case "threads":
+		s.respond(req, map[string]any{"threads": []thread{{ID: threadID, Name: "main"}}})
+	case "stackTrace":
+		if !s.stopped(req) {
+			return false
+		}
+
+		s.frames = s.debugger.Frames()
+		frames := make([]stackFrame, len(s.frames))
+		for i, f := range s.frames {
+			frames[i] = stackFrame{
+				ID:     i + 1,
+				Name:   f.Function,
+				Source: source{Name: filepath.Base(s.path), Path: s.path},
+				Line:   f.Line,
+				Column: 1,
+			}
+		}
+		s.respond(req, map[string]any{"stackFrames": frames, "totalFrames": len(frames)})
+	case "scopes":
+		var args scopesArguments
+		if !s.arguments(req, &args) || !s.stopped(req) {
+			return false
+		}
+		if args.FrameID < 1 || args.FrameID > len(s.frames) {
+			s.fail(req, fmt.Sprintf("unknown frame %d", args.FrameID))
+			return false
+		}
+
+		frame := s.frames[args.FrameID-1]
+		s.respond(req, map[string]any{"scopes": []scope{
+			{Name: "Locals", VariablesReference: s.reference(frame.Locals)},
+			{Name: "Free variables", VariablesReference: s.reference(frame.Free)},
+			{Name: "Globals", VariablesReference: s.reference(s.debugger.Globals())},
+		}})
+	case "variables":
+		var args variablesArguments
+		if !s.arguments(req, &args) || !s.stopped(req) {
+			return false
+		}
+		if args.VariablesReference < 1 || args.VariablesReference > len(s.references) {
+			s.fail(req, fmt.Sprintf("unknown variables reference %d", args.VariablesReference))
+			return false
+		}
+
+		vars := s.references[args.VariablesReference-1]
+		variables := make([]variable, len(vars))
+		for i, v := range vars {
+			variables[i] = variable{Name: v.Name, Value: v.Value.Inspect(), Type: string(v.Value.Type())}
+		}
+		s.respond(req, map[string]any{"variables": variables})
+	case "continue", "next", "stepIn", "stepOut":
+		if !s.stopped(req) {
+			return false
+		}
+
+		if req.Command == "continue" {
+			s.respond(req, map[string]any{"allThreadsContinued": true})
+		} else {
+			s.respond(req, nil)
+		}
+
+		resume := map[string]func(d *debugger.Debugger) debugger.Stop{
+			"continue": (*debugger.Debugger).Continue,
+			"next":     (*debugger.Debugger).StepOver,
+			"stepIn":   (*debugger.Debugger).StepInto,
+			"stepOut":  (*debugger.Debugger).StepOut,
+		}[req.Command]
+		s.resume(resume)
+	case "disconnect":
+		s.respond(req, nil)
+		return true
+	default:
+		s.fail(req, fmt.Sprintf("unsupported request %q", req.Command))
+	}
+
+	return false
+}
+
+// launch parses and compiles the program to debug
+func (s *Server) launch(req *request, args *launchArguments) error {
+	if err := json.Unmarshal(req.Arguments, args); err != nil {
+		return err
+	}
+	if s.debugger != nil {
+		return fmt.Errorf("a program is already launched")
+	}
+
+	content, err := os.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+
+	p := parser.New(lexer.New(string(content)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		var errors strings.Builder
+		for _, d := range p.Diagnostics() {
+			errors.WriteString(d.Render(args.Program, string(content)))
+		}
+		return fmt.Errorf("parsing %s failed:\n%s", args.Program, errors.String())
+	}
+
+	macros := object.NewEnvironment()
+	eval.DefineMacros(program, macros)
+	if err := eval.ExpandMacros(program, macros); err != nil {
+		return fmt.Errorf("expanding the macros of %s failed:\n%s", args.Program, render(err, args.Program, string(content)))
+	}
+
+	io := object.NewIO(strings.NewReader(""), outputWriter{s, "stdout"}, outputWriter{s, "stderr"})
+	d, err := debugger.NewVM(program, io)
+	if err != nil {
+		return fmt.Errorf("compiling %s failed:\n%s", args.Program, render(err, args.Program, string(content)))
+	}
+
+	s.debugger = d
+	s.path = args.Program
+	s.source = string(content)
+	s.stopOnEntry = args.StopOnEntry
+	// breakpoints are verified on the lines starting statements
+	s.lines = coverage.New(args.Program, string(content), program).Lines()
+
+	return nil
+}
+
+// resume resumes the program on another goroutine, which sends the event
+// of the next stop
+func (s *Server) resume(resume func(d *debugger.Debugger) debugger.Stop) {
+	s.running = true
+	s.frames = nil
+	s.references = nil
+
+	d := s.debugger
+	go func() {
+		stop := resume(d)
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.running = false
+
+		if stop.Reason != debugger.Exited {
+			s.event("stopped", map[string]any{
+				"reason":            string(stop.Reason),
+				"threadId":          threadID,
+				"allThreadsStopped": true,
+			})
+			return
+		}
+
+		exitCode := 0
+		if stop.Err != nil {
+			exitCode = 1
+			s.event("output", map[string]any{"category": "stderr", "output": "Program failed:\n" + render(stop.Err, s.path, s.source)})
+		}
+		s.event("exited", map[string]any{"exitCode": exitCode})
+		s.event("terminated", nil)
+	}()
+}
+
+// render renders an error of the program with its source, like the REPL does,
+// when it is a diagnostic
+func render(err error, path, source string) string {
+	if d, ok := err.(*diagnostic.Diagnostic); ok {
+		return d.Render(path, source)
+	}
+	return err.Error() + "\n"
+}
+
+// reference returns the reference of variables, valid until the program is
+// resumed
+func (s *Server) reference(vars []debugger.Variable) int {
+	s.references = append(s.references, vars)
+	return len(s.references)
+}
+
+func (s *Server) arguments(req *request, args any) bool {
+	if err := json.Unmarshal(req.Arguments, args); err != nil {
+		s.fail(req, err.Error())
+		return false
+	}
+	return true
+}
+
+func (s *Server) launched(req *request) bool {
+	if s.debugger == nil {
+		s.fail(req, "no program launched")
+		return false
+	}
+	return true
+}
+
+func (s *Server) stopped(req *request) bool {
+	if !s.launched(req) {
+		return false
+	}
+	if s.running || s.debugger.Exited() {
+		s.fail(req, "the program is not stopped")
+		return false
+	}
+	return true
+}
+
+func (s *Server) respond(req *request, body any) {
+	s.write(&response{Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body})
+}
+
+func (s *Server) fail(req *request, message string) {
+	s.write(&response{Type: "response", RequestSeq: req.Seq, Success: false, Command: req.Command, Message: message})
+}
+
+func (s *Server) event(name string, body any) {
+	s.write(&event{Type: "event", Event: name, Body: body})
+}
+
+// write numbers and writes a message. Errors writing are those of the
+// stream, and are found again reading the next request.
+func (s *Server) write(message any) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+
+	s.seq++
+	switch m := message.(type) {
+	case *response:
+		m.Seq = s.seq
+	case *event:
+		m.Seq = s.seq
+	}
+
+	writeMessage(s.out, message)
+}
+
+// outputWriter sends what the program writes as output events
+type outputWriter struct {
+	s        *Server
+	category string
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	w.s.event("output", map[string]any{"category": w.category, "output": string(p)})
+	return len(p), nil
+}
@@ -0,0 +1,352 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const debuggedInput = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+
+let result = add(1, 2);
+puts(result);
+result
+`
+
+// client is a scripted DAP client of a server
+type client struct {
+	t        *testing.T
+	in       *io.PipeWriter
+	messages chan map[string]any
+	seq      int
+	done     chan error
+	// output is the output of the program, from output events
+	output string
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{t: t, in: clientOut, messages: make(chan map[string]any, 100), done: make(chan error, 1)}
+
+	go func() {
+		c.done <- NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+	}()
+
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			header, err := textproto.NewReader(r).ReadMIMEHeader()
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			length, _ := strconv.Atoi(header.Get("Content-Length"))
+			content := make([]byte, length)
+			if _, err := io.ReadFull(r, content); err != nil {
+				close(c.messages)
+				return
+			}
+
+			var message map[string]any
+			if err := json.Unmarshal(content, &message); err != nil {
+				t.Errorf("invalid message %q: %s", content, err)
+			}
+			c.messages <- message
+		}
+	}()
+
+	return c
+}
+
+// request sends a request and returns the body of its response, failing
+// the test when it does not succeed
+func (c *client) request(command string, arguments any) map[string]any {
+	c.t.Helper()
+
+	response := c.send(command, arguments)
+	if response["success"] != true {
+		c.t.Fatalf("request %s failed: %v", command, response["message"])
+	}
+
+	body, _ := response["body"].(map[string]any)
+	return body
+}
+
+// send sends a request and returns its response
+func (c *client) send(command string, arguments any) map[string]any {
+	c.t.Helper()
+
+	c.seq++
+	err := writeMessage(c.in, map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": arguments})
+	if err != nil {
+		c.t.Fatalf("error sending %s: %s", command, err)
+	}
+
+	return c.next("response", command)
+}
+
+// next returns the next message of a type, a response to command or an
+// event, recording the output events skipped
+func (c *client) next(typ, name string) map[string]any {
+	c.t.Helper()
+
+	for message := range c.messages {
+		if message["type"] == "event" && message["event"] == "output" && name != "output" {
+			body := message["body"].(map[string]any)
+			c.output += body["output"].(string)
+			continue
+		}
+
+		key := "event"
+		if typ == "response" {
+			key = "command"
+		}
+		if message["type"] != typ || message[key] != name {
+			c.t.Fatalf("expected %s %s, got %v", typ, name, message)
+		}
+
+		return message
+	}
+
+	c.t.Fatalf("expected %s %s, got the end of the stream", typ, name)
+	return nil
+}
+
+// stopped waits for a stopped event and returns the reason and the frames
+// of the program
+func (c *client) stopped(reason string) []any {
+	c.t.Helper()
+
+	stopped := c.next("event", "stopped")
+	if got := stopped["body"].(map[string]any)["reason"]; got != reason {
+		c.t.Fatalf("wrong stop reason. want=%s, got=%v", reason, got)
+	}
+
+	return c.request("stackTrace", map[string]any{"threadId": threadID})["stackFrames"].([]any)
+}
+
+// program writes a program to debug and returns its path
+func (c *client) program(input string) string {
+	c.t.Helper()
+
+	program := filepath.Join(c.t.TempDir(), "script.monkey")
+	if err := os.WriteFile(program, []byte(input), 0o600); err != nil {
+		c.t.Fatal(err)
+	}
+
+	return program
+}
+
+func (c *client) launch(stopOnEntry bool) string {
+	c.t.Helper()
+
+	program := c.program(debuggedInput)
+
+	capabilities := c.request("initialize", map[string]any{"adapterID": "monkey"})
+	if capabilities["supportsConfigurationDoneRequest"] != true {
+		c.t.Errorf("configurationDone not supported")
+	}
+
+	c.request("launch", map[string]any{"program": program, "stopOnEntry": stopOnEntry})
+	c.next("event", "initialized")
+
+	return program
+}
+
+func (c *client) disconnect() {
+	c.t.Helper()
+
+	c.request("disconnect", nil)
+	if err := <-c.done; err != nil {
+		c.t.Errorf("server failed: %s", err)
+	}
+}
+
+func checkFrames(t *testing.T, frames []any, expected ...string) {
+	t.Helper()
+
+	if len(frames) != len(expected) {
+		t.Fatalf("wrong number of frames. want=%d, got=%d", len(expected), len(frames))
+	}
+	for i, want := range expected {
+		frame := frames[i].(map[string]any)
+		got := frame["name"].(string) + ":" + strconv.Itoa(int(frame["line"].(float64)))
+		if got != want {
+			t.Errorf("wrong frame %d. want=%s, got=%s", i, want, got)
+		}
+	}
+}
+
+func TestSession(t *testing.T) {
+	c := newClient(t)
+	program := c.launch(false)
+
+	body := c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": program},
+		"breakpoints": []any{map[string]any{"line": 2}, map[string]any{"line": 5}},
+	})
+	breakpoints := body["breakpoints"].([]any)
+	if breakpoints[0].(map[string]any)["verified"] != true || breakpoints[1].(map[string]any)["verified"] != false {
+		t.Errorf("wrong breakpoints verified: %v", breakpoints)
+	}
+
+	c.request("configurationDone", nil)
+	frames := c.stopped("breakpoint")
+	checkFrames(t, frames, "add:2", "main:6")
+	if path := frames[0].(map[string]any)["source"].(map[string]any)["path"]; path != program {
+		t.Errorf("wrong source path. got=%v", path)
+	}
+
+	threads := c.request("threads", nil)["threads"].([]any)
+	if len(threads) != 1 || threads[0].(map[string]any)["id"] != float64(threadID) {
+		t.Errorf("wrong threads: %v", threads)
+	}
+
+	scopes := c.request("scopes", map[string]any{"frameId": 1})["scopes"].([]any)
+	if len(scopes) != 3 {
+		t.Fatalf("wrong number of scopes. got=%d", len(scopes))
+	}
+	locals := scopes[0].(map[string]any)
+	if locals["name"] != "Locals" {
+		t.Errorf("wrong scope. got=%v", locals["name"])
+	}
+	variables := c.request("variables", map[string]any{"variablesReference": locals["variablesReference"]})["variables"].([]any)
+	if len(variables) != 2 {
+		t.Fatalf("wrong number of locals. got=%v", variables)
+	}
+	for i, want := range []string{"a=1", "b=2"} {
+		v := variables[i].(map[string]any)
+		if got := v["name"].(string) + "=" + v["value"].(string); got != want {
+			t.Errorf("wrong local %d. want=%s, got=%s", i, want, got)
+		}
+	}
+
+	c.request("next", map[string]any{"threadId": threadID})
+	checkFrames(t, c.stopped("step"), "add:3", "main:6")
+
+	c.request("stepOut", map[string]any{"threadId": threadID})
+	checkFrames(t, c.stopped("step"), "main:6")
+
+	c.request("next", map[string]any{"threadId": threadID})
+	checkFrames(t, c.stopped("step"), "main:7")
+
+	c.request("continue", map[string]any{"threadId": threadID})
+	exited := c.next("event", "exited")
+	if code := exited["body"].(map[string]any)["exitCode"]; code != float64(0) {
+		t.Errorf("wrong exit code. got=%v", code)
+	}
+	c.next("event", "terminated")
+	if c.output != "3\n" {
+		t.Errorf("wrong output. got=%q", c.output)
+	}
+
+	if response := c.send("stackTrace", map[string]any{"threadId": threadID}); response["success"] != false {
+		t.Errorf("stack trace of an exited program succeeded")
+	}
+
+	c.disconnect()
+}
+
+func TestStopOnEntry(t *testing.T) {
+	c := newClient(t)
+	c.launch(true)
+
+	c.request("configurationDone", nil)
+	checkFrames(t, c.stopped("entry"), "main:1")
+
+	c.request("next", map[string]any{"threadId": threadID})
+	checkFrames(t, c.stopped("step"), "main:6")
+
+	c.request("stepIn", map[string]any{"threadId": threadID})
+	checkFrames(t, c.stopped("step"), "add:2", "main:6")
+
+	scopes := c.request("scopes", map[string]any{"frameId": 2})["scopes"].([]any)
+	globals := scopes[2].(map[string]any)
+	variables := c.request("variables", map[string]any{"variablesReference": globals["variablesReference"]})["variables"].([]any)
+	if len(variables) != 1 || variables[0].(map[string]any)["name"] != "add" {
+		t.Errorf("wrong globals: %v", variables)
+	}
+
+	c.disconnect()
+}
+
+func TestProgramErrors(t *testing.T) {
+	c := newClient(t)
+	c.request("initialize", map[string]any{"adapterID": "monkey"})
+
+	program := c.program("let x 1;")
+	response := c.send("launch", map[string]any{"program": program})
+	expected := "parsing " + program + " failed:\n" +
+		"error[E0001]: expected =, got INT instead\n" +
+		" --> " + program + ":1:7\n" +
+		"  |\n" +
+		"1 | let x 1;\n" +
+		"  |       ^\n"
+	if response["success"] != false || response["message"] != expected {
+		t.Errorf("wrong launch response.\nwant=%q\ngot=%v", expected, response["message"])
+	}
+
+	program = c.program("let x = 0;\n10 / x")
+	c.request("launch", map[string]any{"program": program})
+	c.next("event", "initialized")
+	c.request("configurationDone", nil)
+
+	exited := c.next("event", "exited")
+	if code := exited["body"].(map[string]any)["exitCode"]; code != float64(1) {
+		t.Errorf("wrong exit code. got=%v", code)
+	}
+	expected = "Program failed:\n" +
+		"error[E0201]: division by zero\n" +
+		" --> " + program + ":2:4\n" +
+		"  |\n" +
+		"2 | 10 / x\n" +
+		"  |    ^\n"
+	if c.output != expected {
+		t.Errorf("wrong output.\nwant=%q\ngot=%q", expected, c.output)
+	}
+	c.next("event", "terminated")
+
+	c.disconnect()
+}
+
+func TestInvalidRequests(t *testing.T) {
+	c := newClient(t)
+
+	tests := []struct {
+		command   string
+		arguments any
+		message   string
+	}{
+		{"setBreakpoints", map[string]any{"breakpoints": []any{}}, "no program launched"},
+		{"launch", map[string]any{"program": filepath.Join(t.TempDir(), "missing.monkey")}, ""},
+		{"evaluate", nil, `unsupported request "evaluate"`},
+	}
+
+	for _, tt := range tests {
+		response := c.send(tt.command, tt.arguments)
+		if response["success"] != false {
+			t.Errorf("%s succeeded", tt.command)
+		}
+		if tt.message != "" && response["message"] != tt.message {
+			t.Errorf("wrong message for %s. want=%q, got=%v", tt.command, tt.message, response["message"])
+		}
+	}
+
+	c.in.Close()
+	if err := <-c.done; err != nil {
+		t.Errorf("server failed: %s", err)
+	}
+}
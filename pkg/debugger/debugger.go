@@ -0,0 +1,263 @@
+package debugger
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+)
+
+// Debugger runs a Monkey program, on the VM or on the evaluator, stopping
+// it at breakpoints and after steps to inspect its frames. The program runs
+// on its own goroutine, blocked in a tracer while it is stopped, and is
+// driven by the methods of the debugger, which must be called from a single
+// goroutine.
+type Debugger struct {
+	engine engine
+
+	mutex       sync.Mutex
+	breakpoints map[int]bool
+
+	commands chan mode
+	stops    chan Stop
+	started  bool
+	exited   bool
+	last     Stop
+
+	// state of the goroutine running the program
+	mode mode
+	// depth is the depth of the frame the program stopped in
+	depth int
+	// lines are the current lines of the frames, outermost first
+	lines []int
+}
+
+// StopReason is the reason the program stopped.
+type StopReason string
+
+const (
+	// Entry is the stop before the first line is run
+	Entry StopReason = "entry"
+	// Breakpoint is the stop at a line with a breakpoint
+	Breakpoint StopReason = "breakpoint"
+	// Step is the stop after a step
+	Step StopReason = "step"
+	// Exited is the end of the program, which cannot be resumed
+	Exited StopReason = "exited"
+)
+
+// Stop is where the program stopped.
+type Stop struct {
+	Reason StopReason
+	Line   int
+
+	// Result and Err are the value the program evaluated to and the error
+	// it failed with, when it exited
+	Result object.Object
+	Err    error
+}
+
+// Frame is a call being run, innermost first.
+type Frame struct {
+	Function string
+	Line     int
+	Locals   []Variable
+	Free     []Variable
+}
+
+// Variable is a binding of a frame or a global.
+type Variable struct {
+	Name  string
+	Value object.Object
+}
+
+type mode int
+
+const (
+	modeEntry mode = iota
+	modeContinue
+	modeStepInto
+	modeStepOver
+	modeStepOut
+)
+
+// engine runs the program, calling the debugger on every instruction or
+// node
+type engine interface {
+	run() (object.Object, error)
+	frames() []Frame
+	globals() []Variable
+}
+
+func newDebugger() *Debugger {
+	return &Debugger{
+		breakpoints: map[int]bool{},
+		commands:    make(chan mode),
+		stops:       make(chan Stop),
+	}
+}
+
+// SetBreakpoint sets a breakpoint at a line. It can be called while the
+// program runs.
+func (d *Debugger) SetBreakpoint(line int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.breakpoints[line] = true
+}
+
+// ClearBreakpoint removes the breakpoint at a line.
+func (d *Debugger) ClearBreakpoint(line int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	delete(d.breakpoints, line)
+}
+
+// Breakpoints returns the lines with breakpoints, sorted.
+func (d *Debugger) Breakpoints() []int {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	lines := make([]int, 0, len(d.breakpoints))
+	for line := range d.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	return lines
+}
+
+// Start starts the program, which stops before its first line is run.
+func (d *Debugger) Start() Stop {
+	if d.started {
+		return d.last
+	}
+	d.started = true
+
+	go func() {
+		result, err := d.engine.run()
+		d.stops <- Stop{Reason: Exited, Result: result, Err: err}
+	}()
+
+	return d.wait()
+}
+
+// Continue resumes the program until it reaches a breakpoint or exits.
+func (d *Debugger) Continue() Stop {
+	return d.resume(modeContinue)
+}
+
+// StepInto resumes the program until it reaches another line, in any call.
+func (d *Debugger) StepInto() Stop {
+	return d.resume(modeStepInto)
+}
+
+// StepOver resumes the program until it reaches another line of the current
+// call or of its callers.
+func (d *Debugger) StepOver() Stop {
+	return d.resume(modeStepOver)
+}
+
+// StepOut resumes the program until the current call returns.
+func (d *Debugger) StepOut() Stop {
+	return d.resume(modeStepOut)
+}
+
+// Exited reports whether the program exited.
+func (d *Debugger) Exited() bool {
+	return d.exited
+}
+
+// Frames returns the calls being run by the stopped program, innermost
+// first, or nil when it exited.
+func (d *Debugger) Frames() []Frame {
+	if !d.started || d.exited {
+		return nil
+	}
+
+	return d.engine.frames()
+}
+
+// Globals returns the globals bound, or nil when the program exited.
+func (d *Debugger) Globals() []Variable {
+	if !d.started || d.exited {
+		return nil
+	}
+
+	return d.engine.globals()
+}
+
+func (d *Debugger) resume(m mode) Stop {
+	if !d.started {
+		d.Start()
+	}
+	if d.exited {
+		return d.last
+	}
+
+	d.commands <- m
+	return d.wait()
+}
+
+func (d *Debugger) wait() Stop {
+	d.last = <-d.stops
+	if d.last.Reason == Exited {
+		d.exited = true
+	}
+
+	return d.last
+}
+
+// call is called by the engines before a call is made at depth, so the
+// call starts on a new line even when no instruction is run in between
+func (d *Debugger) call(depth int) {
+	if len(d.lines) >= depth {
+		d.lines = d.lines[:depth-1]
+	}
+}
+
+// at is called by the engines before the program runs a line at depth,
+// and stops the program until it is resumed when it has to
+func (d *Debugger) at(depth, line int) {
+	if line == 0 || depth == 0 {
+		return
+	}
+
+	// frames returned from
+	if len(d.lines) > depth {
+		d.lines = d.lines[:depth]
+	}
+	for len(d.lines) < depth {
+		d.lines = append(d.lines, 0)
+	}
+	newLine := d.lines[depth-1] != line
+	d.lines[depth-1] = line
+
+	var reason StopReason
+	switch {
+	case d.mode == modeEntry:
+		reason = Entry
+	case newLine && d.hasBreakpoint(line):
+		reason = Breakpoint
+	case d.mode == modeContinue:
+		return
+	case depth < d.depth,
+		newLine && d.mode == modeStepInto,
+		newLine && d.mode == modeStepOver && depth <= d.depth:
+		reason = Step
+	default:
+		return
+	}
+
+	d.stops <- Stop{Reason: reason, Line: line}
+	d.mode = <-d.commands
+	d.depth = depth
+}
+
+func (d *Debugger) hasBreakpoint(line int) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.breakpoints[line]
+}
@@ -0,0 +1,194 @@
+package debugger
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+)
+
+const debuggedInput = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let makeAdder = fn(x) {
+  fn(y) { add(x, y) }
+};
+let addTwo = makeAdder(2);
+let result = addTwo(3);
+map([1, 2], fn(n) { add(n, n) });
+result
+`
+
+func newDebuggers(t *testing.T, input string) map[string]*Debugger {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	io := object.NewIO(nil, &bytes.Buffer{}, &bytes.Buffer{})
+	vmDebugger, err := NewVM(program, io)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return map[string]*Debugger{"vm": vmDebugger, "eval": NewEval(program, io)}
+}
+
+func TestStepping(t *testing.T) {
+	tests := []struct {
+		name        string
+		breakpoints []int
+		commands    []string
+		expected    []string
+	}{
+		{
+			"step over",
+			nil,
+			[]string{"next", "next", "next", "next", "next", "next"},
+			[]string{"entry 1", "step 5", "step 8", "step 9", "step 10", "step 11", "exited 5"},
+		},
+		{
+			"step into",
+			nil,
+			[]string{"next", "next", "step", "step", "step", "step", "step", "step"},
+			[]string{"entry 1", "step 5", "step 8", "step 6", "step 8", "step 9", "step 6", "step 2", "step 3"},
+		},
+		{
+			"step out",
+			[]int{2},
+			[]string{"continue", "out", "out", "out"},
+			[]string{"entry 1", "breakpoint 2", "step 6", "step 9", "breakpoint 2"},
+		},
+		{
+			"breakpoints in callbacks",
+			[]int{3},
+			[]string{"continue", "continue", "continue", "continue"},
+			[]string{"entry 1", "breakpoint 3", "breakpoint 3", "breakpoint 3", "exited 5"},
+		},
+		{
+			"step over returns",
+			[]int{3},
+			[]string{"continue", "next", "next"},
+			[]string{"entry 1", "breakpoint 3", "step 6", "step 9"},
+		},
+	}
+
+	for _, tt := range tests {
+		for engine, d := range newDebuggers(t, debuggedInput) {
+			for _, line := range tt.breakpoints {
+				d.SetBreakpoint(line)
+			}
+
+			stops := []string{describe(d.Start())}
+			for _, command := range tt.commands {
+				var stop Stop
+				switch command {
+				case "continue":
+					stop = d.Continue()
+				case "next":
+					stop = d.StepOver()
+				case "step":
+					stop = d.StepInto()
+				case "out":
+					stop = d.StepOut()
+				}
+				stops = append(stops, describe(stop))
+			}
+
+			if strings.Join(stops, ", ") != strings.Join(tt.expected, ", ") {
+				t.Errorf("%s on %s: wrong stops.\nwant=%v\ngot=%v", tt.name, engine, tt.expected, stops)
+			}
+		}
+	}
+}
+
+func TestInspection(t *testing.T) {
+	for engine, d := range newDebuggers(t, debuggedInput) {
+		d.SetBreakpoint(3)
+		d.Start()
+		d.Continue()
+
+		frames := d.Frames()
+		expected := []string{"add 3 [a=2 b=3 sum=5] []", "fn@6 6 [y=3] [x=2]", "main 9 [] []"}
+		if len(frames) != len(expected) {
+			t.Fatalf("%s: wrong number of frames. want=%d, got=%d", engine, len(expected), len(frames))
+		}
+		for i, want := range expected {
+			got := fmt.Sprintf("%s %d %s %s", frames[i].Function, frames[i].Line, describeVariables(frames[i].Locals), describeVariables(frames[i].Free))
+			if got != want {
+				t.Errorf("%s: wrong frame %d. want=%q, got=%q", engine, i, want, got)
+			}
+		}
+
+		globals := describeVariables(d.Globals())
+		if !strings.Contains(globals, "addTwo=") || strings.Contains(globals, "result=") {
+			t.Errorf("%s: wrong globals. got=%s", engine, globals)
+		}
+
+		d.ClearBreakpoint(3)
+		stop := d.Continue()
+		if stop.Reason != Exited || stop.Result.Inspect() != "5" {
+			t.Errorf("%s: wrong exit. got=%+v", engine, stop)
+		}
+		if d.Frames() != nil {
+			t.Errorf("%s: frames after exit", engine)
+		}
+	}
+}
+
+func TestUnboundLocals(t *testing.T) {
+	// the second call reuses the stack slots of the locals of the first one
+	input := "let f = fn(x) {\n  let y = x + 1;\n  let z = y + 1;\n  z\n};\nf(1);\nf(5);\n"
+
+	for engine, d := range newDebuggers(t, input) {
+		d.SetBreakpoint(2)
+		d.Start()
+
+		for _, expected := range []string{"[x=1]", "[x=5]"} {
+			if stop := d.Continue(); stop.Reason != Breakpoint {
+				t.Fatalf("%s: wrong stop. got=%s", engine, describe(stop))
+			}
+
+			if locals := describeVariables(d.Frames()[0].Locals); locals != expected {
+				t.Errorf("%s: wrong locals. want=%s, got=%s", engine, expected, locals)
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for engine, d := range newDebuggers(t, "let f = fn() { 1 + true };\nf()") {
+		d.Start()
+		stop := d.Continue()
+		if stop.Reason != Exited || stop.Err == nil {
+			t.Errorf("%s: expected error. got=%+v", engine, stop)
+		}
+	}
+}
+
+func describe(stop Stop) string {
+	if stop.Reason == Exited {
+		return fmt.Sprintf("exited %s", stop.Result.Inspect())
+	}
+	return fmt.Sprintf("%s %d", stop.Reason, stop.Line)
+}
+
+func describeVariables(vars []Variable) string {
+	names := make([]string, 0, len(vars))
+	for _, v := range vars {
+		value := v.Value.Inspect()
+		if _, ok := v.Value.(*object.Integer); !ok {
+			value = string(v.Value.Type())
+		}
+		names = append(names, v.Name+"="+value)
+	}
+	return "[" + strings.Join(names, " ") + "]"
+}
@@ -0,0 +1,124 @@
+package debugger
+
+import (
+	"sort"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/eval"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+)
+
+// evalEngine evaluates a program, stopping it from its tracer. As the
+// evaluator has no frames, it keeps them from the calls traced.
+type evalEngine struct {
+	d       *Debugger
+	program *ast.Program
+	env     *object.Environment
+	stack   []evalFrame
+}
+
+// evalFrame is a call, or the program, being evaluated
+type evalFrame struct {
+	function string
+	builtin  bool
+	env      *object.Environment
+	line     int
+}
+
+// NewEval creates a debugger evaluating a program.
+func NewEval(program *ast.Program, io *object.IO) *Debugger {
+	d := newDebugger()
+	e := &evalEngine{d: d, program: program, env: object.NewEnvironment()}
+	e.env.SetIO(io)
+	e.env.SetTracer(e)
+	e.stack = []evalFrame{{function: "main", env: e.env}}
+	d.engine = e
+
+	return d
+}
+
+func (e *evalEngine) run() (object.Object, error) {
+	result := eval.Eval(e.program, e.env)
+	if result == nil {
+		return object.NULL, nil
+	}
+	if err, ok := result.(*object.Error); ok {
+		return nil, err.Diagnostic()
+	}
+
+	return result, nil
+}
+
+func (e *evalEngine) frames() []Frame {
+	var frames []Frame
+	for i := len(e.stack) - 1; i >= 0; i-- {
+		f := e.stack[i]
+		if f.builtin {
+			continue
+		}
+
+		frame := Frame{Function: f.function, Line: f.line}
+		if f.env != e.env {
+			frame.Locals = bindings(f.env)
+			// the environments of the enclosing functions, up to the globals
+			for env := f.env.Outer(); env != nil && env != e.env; env = env.Outer() {
+				frame.Free = append(frame.Free, bindings(env)...)
+			}
+		}
+		frames = append(frames, frame)
+	}
+
+	return frames
+}
+
+func (e *evalEngine) globals() []Variable {
+	return bindings(e.env)
+}
+
+func (e *evalEngine) OnNode(node ast.Node, env *object.Environment) {
+	// the lines of programs and blocks are those of their statements
+	switch node.(type) {
+	case *ast.Program, *ast.BlockStatement:
+		return
+	}
+
+	line, _ := ast.Position(node)
+	top := &e.stack[len(e.stack)-1]
+	top.env = env
+	top.line = line
+
+	e.d.at(len(e.stack), line)
+}
+
+func (e *evalEngine) OnCall(callee object.Object) {
+	f := evalFrame{function: callee.Inspect()}
+	switch callee := callee.(type) {
+	case *object.Function:
+		line, _ := ast.Position(callee.Body)
+		f.function = functionName(callee.Name, line)
+	case *object.Builtin:
+		f.builtin = true
+	}
+
+	e.stack = append(e.stack, f)
+	e.d.call(len(e.stack))
+}
+
+func (e *evalEngine) OnReturn(object.Object, object.Object) {
+	e.stack = e.stack[:len(e.stack)-1]
+
+	// steps out of calls stop in the caller, even when it has nothing left
+	// to evaluate
+	e.d.at(len(e.stack), e.stack[len(e.stack)-1].line)
+}
+
+// bindings returns the names bound in an environment, sorted
+func bindings(env *object.Environment) []Variable {
+	var vars []Variable
+	for name, value := range env.Bindings() {
+		vars = append(vars, Variable{Name: name, Value: value})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+
+	return vars
+}
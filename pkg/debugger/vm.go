@@ -0,0 +1,112 @@
+package debugger
+
+import (
+	"fmt"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/compiler"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/vm"
+)
+
+// vmEngine runs a program on the VM, stopping it from its tracer
+type vmEngine struct {
+	d           *Debugger
+	machine     *vm.VM
+	globalNames []string
+}
+
+// NewVM creates a debugger running a program compiled for the VM.
+func NewVM(program *ast.Program, io *object.IO) (*Debugger, error) {
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	bytecode := comp.Bytecode()
+
+	d := newDebugger()
+	e := &vmEngine{d: d, machine: vm.New(bytecode), globalNames: bytecode.GlobalNames}
+	e.machine.SetIO(io)
+	e.machine.SetTracer(e)
+	d.engine = e
+
+	return d, nil
+}
+
+func (e *vmEngine) run() (object.Object, error) {
+	err := e.machine.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	return e.machine.LastPoppedStackElem(), nil
+}
+
+func (e *vmEngine) frames() []Frame {
+	stackFrames := e.machine.StackFrames()
+
+	frames := make([]Frame, len(stackFrames))
+	for i, f := range stackFrames {
+		fn := f.Closure.Fn
+		line, _ := fn.SourceMap.Lookup(f.IP)
+
+		frames[i] = Frame{
+			Function: functionName(fn.Name, fn.Line),
+			Line:     line,
+			Locals:   variables(fn.LocalNames, f.Locals),
+			Free:     variables(fn.FreeNames, f.Closure.Free),
+		}
+	}
+	// the main function is the outermost one
+	frames[len(frames)-1].Function = "main"
+
+	return frames
+}
+
+func (e *vmEngine) globals() []Variable {
+	values := make([]object.Object, len(e.globalNames))
+	for i := range values {
+		values[i] = e.machine.Global(i)
+	}
+
+	return variables(e.globalNames, values)
+}
+
+func (e *vmEngine) OnInstruction(event vm.TraceEvent) {
+	line, _ := event.Function.SourceMap.Lookup(event.IP)
+	e.d.at(event.Depth, line)
+}
+
+func (e *vmEngine) OnCall(event vm.TraceEvent) {
+	e.d.call(event.Depth)
+}
+
+func (e *vmEngine) OnReturn(vm.TraceEvent) {}
+
+func (e *vmEngine) OnError(vm.TraceEvent, error) {}
+
+// variables returns the values bound to names, by index. Names bound again
+// shadow the previous bindings, and values not bound yet are skipped.
+func variables(names []string, values []object.Object) []Variable {
+	last := map[string]int{}
+	for i, name := range names {
+		last[name] = i
+	}
+
+	var vars []Variable
+	for i, name := range names {
+		if i >= len(values) || values[i] == nil || last[name] != i {
+			continue
+		}
+		vars = append(vars, Variable{Name: name, Value: values[i]})
+	}
+
+	return vars
+}
+
+func functionName(name string, line int) string {
+	if name != "" {
+		return name
+	}
+	return fmt.Sprintf("fn@%d", line)
+}
@@ -0,0 +1,175 @@
+// Package diagnostic describes the problems found in programs by the parser,
+// the compilers and the runtimes, and renders them with the source they are
+// found in.
+package diagnostic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
+
+// Severity is how serious a problem is
+type Severity int
+
+// Severities of the diagnostics
+const (
+	Error Severity = iota
+	Warning
+	Note
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Note:
+		return "note"
+	default:
+		return "error"
+	}
+}
+
+// Codes of the diagnostics. Syntax errors are E00xx, compilation errors
+// E01xx and runtime errors E02xx.
+const (
+	// ExpectedToken is a token other than the one the syntax requires
+	ExpectedToken = "E0001"
+	// UnexpectedToken is a token starting no expression
+	UnexpectedToken = "E0002"
+	// InvalidInteger is an integer literal out of range
+	InvalidInteger = "E0003"
+
+	// UndefinedVariable is a name bound nowhere
+	UndefinedVariable = "E0101"
+	// UnknownOperator is an operator the compiler has no instruction for
+	UnknownOperator = "E0102"
+	// UncapturedVariable is a variable a closure cannot capture
+	UncapturedVariable = "E0103"
+	// InvalidMacro is a macro defined out of the top level, or failing to
+	// expand
+	InvalidMacro = "E0104"
+
+	// RuntimeError is an error running a program
+	RuntimeError = "E0201"
+)
+
+// Position is a position in the source. Lines and columns start at 1, and
+// line 0 is an unknown position.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Diagnostic is a problem found in a program, spanning the source from
+// Start up to End, not included
+type Diagnostic struct {
+	Severity Severity
+	Code     string
+	Start    Position
+	End      Position
+	Message  string
+	// Notes explain the problem further
+	Notes []string
+}
+
+// New creates an error diagnostic spanning a token
+func New(code string, tok token.Token, format string, args ...any) *Diagnostic {
+	width := len(tok.Literal)
+	if tok.Type == token.STRING {
+		// the quotes
+		width += 2
+	}
+
+	return &Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Start:    Position{tok.Line, tok.Column},
+		End:      Position{tok.Line, tok.Column + width},
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// At creates an error diagnostic at a position of the source
+func At(code string, line, column int, format string, args ...any) *Diagnostic {
+	return &Diagnostic{
+		Severity: Error,
+		Code:     code,
+		Start:    Position{line, column},
+		End:      Position{line, column},
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+// Error returns the message of the diagnostic, so diagnostics are errors
+func (d *Diagnostic) Error() string {
+	return d.Message
+}
+
+// Render renders the diagnostic like:
+//
+//	error[E0101]: undefined variable y
+//	 --> script.monkey:2:5
+//	  |
+//	2 | x + y;
+//	  |     ^
+//	  = note: ...
+//
+// The source line is left out when the position is unknown, and the
+// filename when it is empty.
+func (d *Diagnostic) Render(filename, source string) string {
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "%s[%s]: %s\n", d.Severity, d.Code, d.Message)
+
+	gutter := ""
+	if d.Start.Line > 0 {
+		location := fmt.Sprintf("%d:%d", d.Start.Line, d.Start.Column)
+		if filename != "" {
+			location = filename + ":" + location
+		}
+
+		number := strconv.Itoa(d.Start.Line)
+		gutter = strings.Repeat(" ", len(number))
+		fmt.Fprintf(&out, "%s--> %s\n", gutter, location)
+
+		lines := strings.Split(source, "\n")
+		if d.Start.Line <= len(lines) {
+			line := strings.TrimRight(lines[d.Start.Line-1], "\r")
+			fmt.Fprintf(&out, "%s |\n", gutter)
+			fmt.Fprintf(&out, "%s | %s\n", number, line)
+			fmt.Fprintf(&out, "%s | %s\n", gutter, d.underline(line))
+		}
+	}
+
+	for _, note := range d.Notes {
+		fmt.Fprintf(&out, "%s = note: %s\n", gutter, note)
+	}
+
+	return out.String()
+}
+
+// underline returns the carets under the span of the diagnostic in its first
+// line, keeping the tabs of the line before it so they line up
+func (d *Diagnostic) underline(line string) string {
+	start := min(max(d.Start.Column, 1)-1, len(line))
+
+	end := len(line)
+	if d.End.Line == d.Start.Line {
+		end = min(d.End.Column-1, len(line))
+	}
+	width := max(end-start, 1)
+
+	var padding strings.Builder
+	for _, ch := range line[:start] {
+		if ch == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+	}
+
+	return padding.String() + strings.Repeat("^", width)
+}
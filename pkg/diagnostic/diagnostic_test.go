@@ -0,0 +1,105 @@
+package diagnostic
+
+import (
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		tok   token.Token
+		start Position
+		end   Position
+	}{
+		{token.Token{Type: token.IDENT, Literal: "foo", Line: 2, Column: 5}, Position{2, 5}, Position{2, 8}},
+		{token.Token{Type: token.STRING, Literal: "ab", Line: 1, Column: 3}, Position{1, 3}, Position{1, 7}},
+		{token.Token{Type: token.EOF, Line: 3, Column: 1}, Position{3, 1}, Position{3, 1}},
+	}
+
+	for _, tt := range tests {
+		d := New(UndefinedVariable, tt.tok, "undefined variable %s", tt.tok.Literal)
+		if d.Start != tt.start || d.End != tt.end {
+			t.Errorf("wrong span of %+v. want=%v-%v, got=%v-%v", tt.tok, tt.start, tt.end, d.Start, d.End)
+		}
+		if d.Severity != Error || d.Code != UndefinedVariable {
+			t.Errorf("wrong severity or code. got=%s %s", d.Severity, d.Code)
+		}
+		if d.Error() != "undefined variable "+tt.tok.Literal {
+			t.Errorf("wrong error. got=%q", d.Error())
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	source := "let x = 1;\nx + y;\n\tlet s = \"ab\" == 1;"
+
+	tests := []struct {
+		diagnostic *Diagnostic
+		filename   string
+		expected   string
+	}{
+		{
+			New(UndefinedVariable, token.Token{Type: token.IDENT, Literal: "y", Line: 2, Column: 5}, "undefined variable y"),
+			"script.monkey",
+			"error[E0101]: undefined variable y\n" +
+				" --> script.monkey:2:5\n" +
+				"  |\n" +
+				"2 | x + y;\n" +
+				"  |     ^\n",
+		},
+		{
+			// tabs are kept under the line, and strings span their quotes
+			New(UnexpectedToken, token.Token{Type: token.STRING, Literal: "ab", Line: 3, Column: 10}, "unexpected STRING found"),
+			"",
+			"error[E0002]: unexpected STRING found\n" +
+				" --> 3:10\n" +
+				"  |\n" +
+				"3 | \tlet s = \"ab\" == 1;\n" +
+				"  | \t        ^^^^\n",
+		},
+		{
+			&Diagnostic{
+				Severity: Warning, Code: RuntimeError, Start: Position{1, 5}, End: Position{2, 1},
+				Message: "spanning lines", Notes: []string{"first note", "second note"},
+			},
+			"",
+			"warning[E0201]: spanning lines\n" +
+				" --> 1:5\n" +
+				"  |\n" +
+				"1 | let x = 1;\n" +
+				"  |     ^^^^^^\n" +
+				"  = note: first note\n" +
+				"  = note: second note\n",
+		},
+		{
+			// the end of the source, after its last line
+			At(ExpectedToken, 3, 21, "expected ), got EOF instead"),
+			"",
+			"error[E0001]: expected ), got EOF instead\n" +
+				" --> 3:21\n" +
+				"  |\n" +
+				"3 | \tlet s = \"ab\" == 1;\n" +
+				"  | \t                  ^\n",
+		},
+		{
+			&Diagnostic{Code: RuntimeError, Message: "stack overflow", Notes: []string{"in f"}},
+			"script.monkey",
+			"error[E0201]: stack overflow\n" +
+				" = note: in f\n",
+		},
+		{
+			At(RuntimeError, 12, 1, "out of the source"),
+			"script.monkey",
+			"error[E0201]: out of the source\n" +
+				"  --> script.monkey:12:1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		got := tt.diagnostic.Render(tt.filename, source)
+		if got != tt.expected {
+			t.Errorf("wrong rendering.\nwant=%q\ngot=%q", tt.expected, got)
+		}
+	}
+}
@@ -11,4 +11,23 @@ var builtins = map[string]*object.Builtin{
 	"rest":  object.GetBuiltinByName("rest"),
 	"push":  object.GetBuiltinByName("push"),
 	"puts":  object.GetBuiltinByName("puts"),
+
+	"map":     object.GetBuiltinByName("map"),
+	"filter":  object.GetBuiltinByName("filter"),
+	"reduce":  object.GetBuiltinByName("reduce"),
+	"each":    object.GetBuiltinByName("each"),
+	"sort_by": object.GetBuiltinByName("sort_by"),
+
+	"print":     object.GetBuiltinByName("print"),
+	"eprint":    object.GetBuiltinByName("eprint"),
+	"read_line": object.GetBuiltinByName("read_line"),
+	"read_all":  object.GetBuiltinByName("read_all"),
+
+	"spawn":  object.GetBuiltinByName("spawn"),
+	"wait":   object.GetBuiltinByName("wait"),
+	"chan":   object.GetBuiltinByName("chan"),
+	"send":   object.GetBuiltinByName("send"),
+	"recv":   object.GetBuiltinByName("recv"),
+	"close":  object.GetBuiltinByName("close"),
+	"select": object.GetBuiltinByName("select"),
 }
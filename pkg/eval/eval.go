@@ -1,6 +1,7 @@
 package eval
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
@@ -10,15 +11,19 @@ import (
 
 var (
 	// NULL null
-	NULL = &object.Null{}
+	NULL = object.NULL
 	// TRUE true
-	TRUE = &object.Boolean{Value: true}
+	TRUE = object.TRUE
 	// FALSE false
-	FALSE = &object.Boolean{Value: false}
+	FALSE = object.FALSE
 )
 
 // Eval evaluates an AST node
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	if tracer := env.Tracer(); tracer != nil {
+		tracer.OnNode(node, env)
+	}
+
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
@@ -87,9 +92,16 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Body: body, Env: env}
+		return &object.Function{Parameters: params, Body: body, Env: env, Name: node.Name}
+
+	case *ast.MacroLiteral:
+		return newError(node.Token.Line, node.Token.Column, "macros can only be bound by let statements at the top level")
 
 	case *ast.CallExpression:
+		if isCallTo(node, "quote") {
+			return quote(node, env)
+		}
+
 		function := Eval(node.Function, env)
 		if isError(function) {
 			return function
@@ -99,11 +111,11 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return args[0]
 		}
 
-		return applyFunction(node.Token, function, args)
+		return applyFunction(node.Token, function, args, env)
 
 	// Expressions
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return object.NewInteger(node.Value)
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 	case *ast.Boolean:
@@ -136,16 +148,48 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
-func applyFunction(t token.Token, fn object.Object, args []object.Object) object.Object {
+// ApplyFunction calls a function or builtin, usually one returned by a
+// script, with the given arguments and returns its result. Errors are
+// returned as *object.Error.
+func ApplyFunction(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(token.Token{}, fn, args, nil)
+}
+
+// applyFunction applies fn to args. env is the environment of the caller,
+// which builtins get their streams from, and whose tracer is passed on.
+func applyFunction(t token.Token, fn object.Object, args []object.Object, env *object.Environment) object.Object {
+	var tracer object.EvalTracer
+	if env != nil {
+		tracer = env.Tracer()
+	}
+
+	if tracer == nil {
+		return callFunction(t, fn, args, env, nil)
+	}
+
+	tracer.OnCall(fn)
+	result := callFunction(t, fn, args, env, tracer)
+	tracer.OnReturn(fn, result)
+
+	return result
+}
+
+func callFunction(t token.Token, fn object.Object, args []object.Object, env *object.Environment, tracer object.EvalTracer) object.Object {
 	switch fn := fn.(type) {
 
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError(t.Line, t.Column, "wrong number of arguments: want=%d, got=%d",
+				len(fn.Parameters), len(args))
+		}
+
 		extendedEnv := extendFunctionEnv(fn, args)
+		extendedEnv.SetTracer(tracer)
 		evaluated := Eval(fn.Body, extendedEnv)
 		return unwrapReturnValue(evaluated)
 
 	case *object.Builtin:
-		value, ok := fn.Fn(args...)
+		value, ok := fn.Fn(executionContext{env: env}, args...)
 
 		if ok != nil {
 			return newError(t.Line, t.Column, ok.Error())
@@ -160,6 +204,36 @@ func applyFunction(t token.Token, fn object.Object, args []object.Object) object
 	}
 }
 
+// executionContext lets builtins call back into the evaluator
+type executionContext struct {
+	env *object.Environment
+}
+
+// Call calls a function or builtin, turning error objects into Go errors
+func (ctx executionContext) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	result := applyFunction(token.Token{}, fn, args, ctx.env)
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, errors.New(errObj.Message)
+	}
+
+	return result, nil
+}
+
+// IO returns the streams set on the caller environment
+func (ctx executionContext) IO() *object.IO {
+	return ctx.env.IO()
+}
+
+// Fork returns a context for the same environment, which is safe for
+// concurrent use, without its tracer
+func (ctx executionContext) Fork() object.ExecutionContext {
+	if ctx.env == nil || ctx.env.Tracer() == nil {
+		return ctx
+	}
+
+	return executionContext{env: object.NewEnclosedEnvironment(ctx.env)}
+}
+
 func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Environment {
 	env := object.NewEnclosedEnvironment(fn.Env)
 
@@ -334,13 +408,16 @@ func evalIntegerInfixExpression(operator string, left, right object.Object, line
 
 	switch operator {
 	case token.PLUS:
-		return &object.Integer{Value: leftVal + rightVal}
+		return object.NewInteger(leftVal + rightVal)
 	case token.MINUS:
-		return &object.Integer{Value: leftVal - rightVal}
+		return object.NewInteger(leftVal - rightVal)
 	case token.ASTERISK:
-		return &object.Integer{Value: leftVal * rightVal}
+		return object.NewInteger(leftVal * rightVal)
 	case token.SLASH:
-		return &object.Integer{Value: leftVal / rightVal}
+		if rightVal == 0 {
+			return newError(line, column, "division by zero")
+		}
+		return object.NewInteger(leftVal / rightVal)
 	case token.LT:
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case token.GT:
@@ -375,7 +452,7 @@ func evalMinusPrefixOperatorExpression(right object.Object, line, column int) ob
 	}
 
 	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return object.NewInteger(-value)
 }
 
 func maybeIntegerToBoolean(input object.Object) object.Object {
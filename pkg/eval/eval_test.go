@@ -1,8 +1,11 @@
 package eval
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
 	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
 	"github.com/jalopez/go-monkey-interpreter/pkg/object"
 	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
@@ -146,6 +149,10 @@ func TestErrorHandling(t *testing.T) {
 			"-true",
 			"unknown operator: -BOOLEAN",
 		},
+		{
+			"10 / (5 - 5)",
+			"division by zero",
+		},
 		{
 			"true + false;",
 			"unknown operator: BOOLEAN + BOOLEAN",
@@ -256,6 +263,25 @@ func TestFunctionApplication(t *testing.T) {
 	}
 }
 
+func TestApplyFunction(t *testing.T) {
+	add := testEval("let base = 10; fn(x, y) { base + x + y }")
+
+	result := ApplyFunction(add, &object.Integer{Value: 1}, &object.Integer{Value: 2})
+	testIntegerObject(t, result, 13)
+
+	result = ApplyFunction(add, &object.Integer{Value: 1})
+	errObj, ok := result.(*object.Error)
+	if !ok {
+		t.Fatalf("object is not Error. got=%T (%+v)", result, result)
+	}
+	if errObj.Message != "wrong number of arguments: want=2, got=1" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	result = ApplyFunction(testEval("len"), &object.String{Value: "four"})
+	testIntegerObject(t, result, 4)
+}
+
 func TestClosures(t *testing.T) {
 	input := `
 let newAdder = fn(x) {
@@ -337,6 +363,124 @@ func TestBuiltinFunctions(t *testing.T) {
 	}
 }
 
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int64{2, 4, 6}},
+		{`let y = 10; map([1, 2], fn(x) { x + y })`, []int64{11, 12}},
+		{`map([[1], [1, 2]], len)`, []int64{1, 2}},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []int64{3, 4}},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`sort_by([3, 1, 2], fn(x) { -x })`, []int64{3, 2, 1}},
+		{`each([1, 2], fn(x) { x })`, nil},
+		{`map([1], fn(x) { x + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`map([1], 1)`, "second argument to `map` must be a function, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case []int64:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+				continue
+			}
+			for i, e := range expected {
+				testIntegerObject(t, array.Elements[i], e)
+			}
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		case nil:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestConcurrencyBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`wait(spawn(fn(a, b) { a + b }, 1, 2))`, 3},
+		{
+			`let square = fn(x) { x * x };
+			reduce(wait(map([1, 2, 3], fn(x) { spawn(square, x) })), 0, fn(a, b) { a + b })`,
+			14,
+		},
+		{
+			`let ch = chan();
+			spawn(fn() { each([1, 2, 3], fn(x) { send(ch, x) }); close(ch) });
+			let sum = fn(acc) { let v = recv(ch); if (v) { sum(acc + v) } else { acc } };
+			sum(0)`,
+			6,
+		},
+		{`let a = chan(); let b = chan(1); send(b, 7); select([a, b])[1]`, 7},
+		{`wait(spawn(fn() { 1 + true }))`, "task failed: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestIOBuiltins(t *testing.T) {
+	var out, errOut bytes.Buffer
+
+	env := object.NewEnvironment()
+	env.SetIO(object.NewIO(strings.NewReader("monkey\n"), &out, &errOut))
+
+	l := lexer.New(`
+	let greet = fn(name) { puts("hello " + name) };
+	greet(read_line());
+	each([1, 2], print);
+	eprint("oops");
+	read_line();
+	`)
+	p := parser.New(l)
+	evaluated := Eval(p.ParseProgram(), env)
+
+	testNullObject(t, evaluated)
+
+	if out.String() != "hello monkey\n12" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	if errOut.String() != "oops" {
+		t.Errorf("wrong error output. got=%q", errOut.String())
+	}
+}
+
 func TestArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -448,3 +592,52 @@ func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 
 	return true
 }
+
+type recordingTracer struct {
+	events []string
+}
+
+func (r *recordingTracer) OnNode(node ast.Node, _ *object.Environment) {
+	if _, ok := node.(*ast.CallExpression); ok {
+		r.events = append(r.events, "node "+node.String())
+	}
+}
+
+func (r *recordingTracer) OnCall(callee object.Object) {
+	r.events = append(r.events, "call "+string(callee.Type()))
+}
+
+func (r *recordingTracer) OnReturn(callee object.Object, result object.Object) {
+	r.events = append(r.events, "return "+result.Inspect())
+}
+
+func TestEvalTracer(t *testing.T) {
+	l := lexer.New(`let f = fn(x) { len(x) + 1 }; map([f("ab")], f); f(1)`)
+	program := parser.New(l).ParseProgram()
+
+	tracer := &recordingTracer{}
+	env := object.NewEnvironment()
+	env.SetTracer(tracer)
+	Eval(program, env)
+
+	expected := []string{
+		"node map([f(ab)], f)",
+		"node f(ab)",
+		"call FUNCTION",
+		"node len(x)",
+		"call BUILTIN",
+		"return 2",
+		"return 3",
+		"call BUILTIN",
+		"call FUNCTION",
+		"node len(x)",
+		"call BUILTIN",
+		"return Error: argument to `len` not supported, got INTEGER at line 1 column 20",
+		"return Error: argument to `len` not supported, got INTEGER at line 1 column 20",
+		"return Error: argument to `len` not supported, got INTEGER at line 1 column 34",
+	}
+
+	if strings.Join(tracer.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong events.\nwant=%q\ngot=%q", expected, tracer.events)
+	}
+}
@@ -0,0 +1,248 @@
+package eval
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+)
+
+// renames numbers the names renamed by macro expansions, which end in #N
+// so they cannot be written in programs
+var renames atomic.Int64
+
+// DefineMacros removes the let statements binding macro literals at the top
+// level of a program, and binds their macros in env
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	statements := program.Statements[:0]
+
+	for _, s := range program.Statements {
+		let, ok := s.(*ast.LetStatement)
+		if !ok {
+			statements = append(statements, s)
+			continue
+		}
+
+		macro, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			statements = append(statements, s)
+			continue
+		}
+
+		env.Set(let.Name.Value, &object.Macro{Parameters: macro.Parameters, Body: macro.Body, Env: env})
+	}
+
+	program.Statements = statements
+}
+
+// ExpandMacros replaces the calls to the macros of env in a program by the
+// code they return. Macros are expanded before running programs, so both the
+// evaluator and the compilers run the expanded code.
+//
+// Expansions are hygienic: the names bound by the code a macro returns,
+// other than in the code passed to it, are renamed in their scope, so they
+// neither capture nor hide the names of that code.
+//
+// As the compilers cannot quote code, the calls to quote and unquote left
+// out of macros once expanded are errors in every engine.
+func ExpandMacros(program *ast.Program, env *object.Environment) error {
+	var err error
+
+	ast.Modify(program, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+		ident, ok := call.Function.(*ast.Identifier)
+		if !ok {
+			return node
+		}
+		obj, ok := env.Get(ident.Value)
+		if !ok {
+			return node
+		}
+		macro, ok := obj.(*object.Macro)
+		if !ok {
+			return node
+		}
+
+		expanded, expandErr := expandMacro(macro, ident, call.Arguments)
+		if expandErr != nil {
+			err = expandErr
+			return node
+		}
+		return expanded
+	})
+	if err != nil {
+		return err
+	}
+
+	return checkQuotes(program)
+}
+
+// checkQuotes returns an error for the first call to quote or unquote out
+// of the macros of a program
+func checkQuotes(program *ast.Program) error {
+	var err error
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		switch node := node.(type) {
+		case *ast.MacroLiteral:
+			return false
+		case *ast.CallExpression:
+			for _, name := range []string{"quote", "unquote"} {
+				if isCallTo(node, name) {
+					err = diagnostic.New(diagnostic.InvalidMacro, node.Function.(*ast.Identifier).Token, "%s can only be used in macros", name)
+					return false
+				}
+			}
+		}
+		return true
+	})
+
+	return err
+}
+
+// expandMacro calls a macro with the quoted code of its arguments, and
+// returns the code it returns
+func expandMacro(macro *object.Macro, ident *ast.Identifier, args []ast.Expression) (ast.Expression, error) {
+	if len(args) != len(macro.Parameters) {
+		return nil, diagnostic.New(diagnostic.InvalidMacro, ident.Token, "wrong number of arguments to macro %s: want=%d, got=%d",
+			ident.Value, len(macro.Parameters), len(args))
+	}
+
+	env := object.NewEnclosedEnvironment(macro.Env)
+	for i, p := range macro.Parameters {
+		env.Set(p.Value, &object.Quote{Node: args[i]})
+	}
+
+	switch result := unwrapReturnValue(Eval(macro.Body, env)).(type) {
+	case *object.Error:
+		d := diagnostic.New(diagnostic.InvalidMacro, ident.Token, "expanding macro %s: %s", ident.Value, result.Message)
+		if result.Line > 0 {
+			d.Notes = append(d.Notes, fmt.Sprintf("in the macro, at line %d, column %d", result.Line, result.Column))
+		}
+		return nil, d
+	case *object.Quote:
+		if expanded, ok := result.Node.(ast.Expression); ok {
+			return hygienic(expanded, args), nil
+		}
+	}
+
+	return nil, diagnostic.New(diagnostic.InvalidMacro, ident.Token, "macro %s returned no quoted code", ident.Value)
+}
+
+// hygienic renames the names bound by the code returned by a macro, and
+// the identifiers in their scope, leaving the code of its arguments as it is
+func hygienic(expanded ast.Expression, args []ast.Expression) ast.Expression {
+	r := renamer{
+		passed:    map[ast.Node]bool{},
+		functions: map[*ast.FunctionLiteral]string{},
+		scope:     &renameScope{names: map[string]string{}},
+	}
+	for _, a := range args {
+		ast.Inspect(a, func(node ast.Node) bool {
+			if node != nil {
+				r.passed[node] = true
+			}
+			return true
+		})
+	}
+
+	ast.Walk(r, expanded)
+	return expanded
+}
+
+// renameScope is the names bound in a function of the code returned by a
+// macro, or at its top level, and what they are renamed to
+type renameScope struct {
+	outer *renameScope
+	names map[string]string
+}
+
+func (s *renameScope) lookup(name string) (string, bool) {
+	for ; s != nil; s = s.outer {
+		if renamed, ok := s.names[name]; ok {
+			return renamed, true
+		}
+	}
+	return "", false
+}
+
+// renamer renames the bindings of the code returned by a macro in a scope.
+// As in the compilers, let statements bind their names after their values,
+// and only functions have scopes of their own.
+type renamer struct {
+	// passed are the nodes of the arguments of the macro
+	passed map[ast.Node]bool
+	// functions are the renamed names of the functions bound by let
+	// statements, which see their own name
+	functions map[*ast.FunctionLiteral]string
+	scope     *renameScope
+}
+
+func (r renamer) Visit(node ast.Node) ast.Visitor {
+	if node == nil || r.passed[node] {
+		return nil
+	}
+
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		renamed := r.bound(node.Name)
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok && fn.Name == node.Name.Value {
+			r.functions[fn] = renamed
+		}
+		ast.Walk(r, node.Value)
+		r.scope.names[node.Name.Value] = renamed
+		rename(node.Name, renamed)
+		return nil
+	case *ast.Identifier:
+		if renamed, ok := r.scope.lookup(node.Value); ok {
+			rename(node, renamed)
+		}
+		return nil
+	case *ast.FunctionLiteral:
+		inner := r.enter(node.Parameters)
+		if renamed, ok := r.functions[node]; ok {
+			inner.scope.names[node.Name] = renamed
+			node.Name = renamed
+		}
+		ast.Walk(inner, node.Body)
+		return nil
+	case *ast.MacroLiteral:
+		ast.Walk(r.enter(node.Parameters), node.Body)
+		return nil
+	}
+	return r
+}
+
+// enter returns the renamer of a function binding parameters
+func (r renamer) enter(parameters []*ast.Identifier) renamer {
+	inner := r
+	inner.scope = &renameScope{outer: r.scope, names: map[string]string{}}
+	for _, p := range parameters {
+		renamed := inner.bound(p)
+		inner.scope.names[p.Value] = renamed
+		rename(p, renamed)
+	}
+	return inner
+}
+
+// bound returns the name a binding is renamed to, which is its own name
+// when the binding is passed to the macro
+func (r renamer) bound(ident *ast.Identifier) string {
+	if r.passed[ident] {
+		return ident.Value
+	}
+	return fmt.Sprintf("%s#%d", ident.Value, renames.Add(1))
+}
+
+func rename(ident *ast.Identifier, name string) {
+	ident.Value = name
+	ident.Token.Literal = name
+}
@@ -0,0 +1,243 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
+	"github.com/jalopez/go-monkey-interpreter/pkg/format"
+	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+)
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+		{`quote(unquote(4))`, `4`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`let foobar = 8; quote(unquote(foobar) + 1)`, `(8 + 1)`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote("a" + "b"))`, `ab`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`let q = quote(4 + 4); quote(unquote(4 + 4) + unquote(q))`, `(8 + (4 + 4))`},
+		// quoting the same code twice
+		{`let f = fn(x) { quote(unquote(x) + 1) }; f(1); f(2)`, `(2 + 1)`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+		}
+
+		if quote.Node.String() != tt.expected {
+			t.Errorf("wrong quoted code of %q. want=%q, got=%q", tt.input, tt.expected, quote.Node.String())
+		}
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(1, 2)`, "wrong number of arguments to quote: want=1, got=2"},
+		{`quote(unquote())`, "wrong number of arguments to unquote: want=1, got=0"},
+		{`quote(unquote([1]))`, "cannot unquote ARRAY"},
+		{`quote(unquote(x))`, "identifier not found: x"},
+		{`macro(x) { x }`, "macros can only be bound by let statements at the top level"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		err, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Fatalf("expected *object.Error for %q. got=%T (%+v)", tt.input, evaluated, evaluated)
+		}
+
+		if err.Message != tt.expected {
+			t.Errorf("wrong error of %q. want=%q, got=%q", tt.input, tt.expected, err.Message)
+		}
+	}
+}
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	for _, name := range []string{"number", "function"} {
+		if _, ok := env.Get(name); ok {
+			t.Errorf("%s should not be defined", name)
+		}
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("wrong number of macro parameters. got=%d", len(macro.Parameters))
+	}
+	if macro.Parameters[0].String() != "x" || macro.Parameters[1].String() != "y" {
+		t.Errorf("wrong parameters. got=%s, %s", macro.Parameters[0], macro.Parameters[1])
+	}
+	if macro.Body.String() != "(x + y)" {
+		t.Errorf("wrong body. got=%q", macro.Body.String())
+	}
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let infixExpression = macro() { quote(1 + 2); };
+			infixExpression();`,
+			"1 + 2;\n",
+		},
+		{
+			`let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+			reverse(2 + 2, 10 - 5);`,
+			"10 - 5 - (2 + 2);\n",
+		},
+		{
+			`let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+			unless(10 > 5, puts("not greater"), puts("greater"));`,
+			"if (!(10 > 5)) {\n  puts(\"not greater\")\n} else {\n  puts(\"greater\")\n};\n",
+		},
+		{
+			// macros calls in the arguments of macros are expanded first
+			`let twice = macro(x) { quote(unquote(x) * 2) };
+			twice(twice(1));`,
+			"1 * 2 * 2;\n",
+		},
+		{
+			// names bound by the macro are renamed, but not those passed to it
+			`let swap = macro(a, b) { quote(fn(tmp) { let x = tmp; [unquote(b), unquote(a), x] }(1)) };
+			swap(x, tmp);`,
+			"fn(tmp#1) {\n  let x#2 = tmp#1;\n  [tmp, x, x#2]\n}(1);\n",
+		},
+		{
+			// only the identifiers in the scope of a binding are renamed
+			`let m = macro(e) { quote([x, fn(x) { x + unquote(e) }(1), x]) };
+			m(x * 2);`,
+			"[x, fn(x#1) { x#1 + x * 2 }(1), x];\n",
+		},
+		{
+			// lets bind their names after their values
+			`let m = macro(e) { quote(fn() { let x = x + 1; let f = fn() { f() }; [x, unquote(e)] }) };
+			m(x);`,
+			"fn() {\n  let x#1 = x + 1;\n  let f#2 = fn() { f#2() };\n  [x#1, x]\n};\n",
+		},
+		{
+			`let bind = macro(f) { quote(fn() { let g = unquote(f); g(1) }) };
+			bind(fn(g) { g });`,
+			"fn() {\n  let g#1 = fn(g) { g };\n  g#1(1)\n};\n",
+		},
+	}
+
+	for _, tt := range tests {
+		renames.Store(0)
+
+		env := object.NewEnvironment()
+		program := testParseProgram(tt.input)
+		DefineMacros(program, env)
+		if err := ExpandMacros(program, env); err != nil {
+			t.Fatalf("error expanding %q: %s", tt.input, err)
+		}
+
+		if format.Node(program) != tt.expected {
+			t.Errorf("wrong expansion of %q. want=%q, got=%q", tt.input, tt.expected, format.Node(program))
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		line     int
+		column   int
+		notes    []string
+	}{
+		{
+			"let m = macro(a) { quote(a) };\nm(1, 2)",
+			"wrong number of arguments to macro m: want=1, got=2", 2, 1, nil,
+		},
+		{
+			"let m = macro() { 1 };\n1 + m()",
+			"macro m returned no quoted code", 2, 5, nil,
+		},
+		{
+			"let m = macro(a) {\n  quote(unquote(b))\n};\nm(1)",
+			"expanding macro m: identifier not found: b", 4, 1, []string{"in the macro, at line 2, column 17"},
+		},
+		{
+			"let x = 1;\nputs(quote(x + 1))",
+			"quote can only be used in macros", 2, 6, nil,
+		},
+		{
+			"let x = 1;\nunquote(x) + 1",
+			"unquote can only be used in macros", 2, 1, nil,
+		},
+	}
+
+	for _, tt := range tests {
+		env := object.NewEnvironment()
+		program := testParseProgram(tt.input)
+		DefineMacros(program, env)
+
+		err := ExpandMacros(program, env)
+		d, ok := err.(*diagnostic.Diagnostic)
+		if !ok {
+			t.Fatalf("expected a diagnostic expanding %q. got=%T (%v)", tt.input, err, err)
+		}
+
+		if d.Code != diagnostic.InvalidMacro || d.Message != tt.expected {
+			t.Errorf("wrong error expanding %q. want=%q, got=%s %q", tt.input, tt.expected, d.Code, d.Message)
+		}
+		if d.Start.Line != tt.line || d.Start.Column != tt.column {
+			t.Errorf("wrong position expanding %q. want=%d:%d, got=%d:%d", tt.input, tt.line, tt.column, d.Start.Line, d.Start.Column)
+		}
+		if len(d.Notes) != len(tt.notes) || len(tt.notes) > 0 && d.Notes[0] != tt.notes[0] {
+			t.Errorf("wrong notes expanding %q. want=%q, got=%q", tt.input, tt.notes, d.Notes)
+		}
+	}
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
@@ -0,0 +1,88 @@
+package eval
+
+import (
+	"strconv"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
+
+// isCallTo reports whether a call calls the function bound to name, like
+// quote and unquote, which are not functions but forms of the evaluator
+func isCallTo(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+// quote returns the code of the argument of a call to quote, not evaluated,
+// with the calls to unquote in it replaced by the code of their values
+func quote(call *ast.CallExpression, env *object.Environment) object.Object {
+	if len(call.Arguments) != 1 {
+		return newError(call.Token.Line, call.Token.Column, "wrong number of arguments to quote: want=1, got=%d", len(call.Arguments))
+	}
+
+	// the code is copied before unquoting, as the body of a macro quotes
+	// the same code each time it is called
+	node := ast.Copy(call.Arguments[0])
+
+	var err *object.Error
+	node = ast.Modify(node, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || !isCallTo(call, "unquote") || err != nil {
+			return node
+		}
+
+		if len(call.Arguments) != 1 {
+			err = newError(call.Token.Line, call.Token.Column, "wrong number of arguments to unquote: want=1, got=%d", len(call.Arguments))
+			return node
+		}
+
+		value := Eval(call.Arguments[0], env)
+		if isError(value) {
+			err = value.(*object.Error)
+			return node
+		}
+
+		unquoted := objectToNode(value, call.Token)
+		if unquoted == nil {
+			err = newError(call.Token.Line, call.Token.Column, "cannot unquote %s", value.Type())
+			return node
+		}
+		return unquoted
+	})
+	if err != nil {
+		return err
+	}
+
+	return &object.Quote{Node: node}
+}
+
+// objectToNode returns the code of a value unquoted at a token, or nil when
+// it has no literal
+func objectToNode(obj object.Object, at token.Token) ast.Expression {
+	tok := token.Token{Line: at.Line, Column: at.Column}
+
+	switch obj := obj.(type) {
+	case *object.Integer:
+		tok.Type = token.INT
+		tok.Literal = strconv.FormatInt(obj.Value, 10)
+		return &ast.IntegerLiteral{Token: tok, Value: obj.Value}
+	case *object.Boolean:
+		tok.Type = token.FALSE
+		if obj.Value {
+			tok.Type = token.TRUE
+		}
+		tok.Literal = strconv.FormatBool(obj.Value)
+		return &ast.Boolean{Token: tok, Value: obj.Value}
+	case *object.String:
+		tok.Type = token.STRING
+		tok.Literal = obj.Value
+		return &ast.StringLiteral{Token: tok, Value: obj.Value}
+	case *object.Quote:
+		e, _ := obj.Node.(ast.Expression)
+		return e
+	}
+
+	return nil
+}
@@ -0,0 +1,266 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
+	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
+
+const indentation = "  "
+
+// precedences of the operators, as the parser binds them
+const (
+	lowest int = iota
+	equals
+	lessGreater
+	sum
+	product
+	prefix
+	postfix // calls and indexes
+)
+
+var precedences = map[string]int{
+	token.EQ:       equals,
+	token.NOTEQ:    equals,
+	token.LT:       lessGreater,
+	token.GT:       lessGreater,
+	token.PLUS:     sum,
+	token.MINUS:    sum,
+	token.ASTERISK: product,
+	token.SLASH:    product,
+}
+
+// Source formats Monkey source code, keeping its comments and single blank
+// lines between statements. It fails when the source does not parse.
+func Source(source string) (string, error) {
+	l := lexer.New(source)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", fmt.Errorf("%s", strings.Join(p.Errors(), "\n"))
+	}
+
+	pr := &printer{comments: l.Comments(), lines: strings.Split(source, "\n"), first: true}
+	pr.statements(program.Statements, token.Token{Line: math.MaxInt}, true)
+	return pr.out.String(), nil
+}
+
+// Node formats a node, with no comments
+func Node(node ast.Node) string {
+	p := &printer{first: true}
+
+	switch node := node.(type) {
+	case *ast.Program:
+		p.statements(node.Statements, token.Token{Line: math.MaxInt}, true)
+	case *ast.BlockStatement:
+		p.block(node)
+	case ast.Statement:
+		p.statement(node, false)
+	case ast.Expression:
+		p.expression(node)
+	}
+
+	return p.out.String()
+}
+
+// printer prints nodes, and the comments before them
+type printer struct {
+	out    bytes.Buffer
+	indent int
+	// comments are the comments not printed yet
+	comments []token.Comment
+	// lines are the lines of the source, to keep its blank lines
+	lines []string
+	// first is set until the first line of a block is printed
+	first bool
+}
+
+// statements prints the statements of a program or a block, each on its
+// own line, and the comments before the end of the block
+func (p *printer) statements(statements []ast.Statement, end token.Token, top bool) {
+	for i, s := range statements {
+		line, column := ast.Position(s)
+		p.flush(line, column)
+		p.line(line)
+
+		// the last expression of a block is its value
+		p.statement(s, !top && i == len(statements)-1)
+		p.out.WriteString("\n")
+	}
+	p.flush(end.Line, end.Column)
+}
+
+// line starts a line of the source, after a blank line when the source
+// has one before it
+func (p *printer) line(line int) {
+	if !p.first && line >= 2 && line-2 < len(p.lines) && strings.TrimSpace(p.lines[line-2]) == "" {
+		p.out.WriteString("\n")
+	}
+	p.first = false
+	p.out.WriteString(strings.Repeat(indentation, p.indent))
+}
+
+// flush prints the comments before a position. Trailing comments are
+// printed at the end of the last line printed.
+func (p *printer) flush(line, column int) {
+	for p.pending(line, column) {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+
+		if c.Trailing && p.out.Len() > 0 {
+			p.out.Truncate(p.out.Len() - 1)
+			p.out.WriteString(" " + c.Text + "\n")
+			continue
+		}
+
+		p.line(c.Line)
+		p.out.WriteString(c.Text + "\n")
+	}
+}
+
+// pending reports whether there are comments before a position
+func (p *printer) pending(line, column int) bool {
+	if len(p.comments) == 0 {
+		return false
+	}
+	c := p.comments[0]
+	return c.Line < line || c.Line == line && c.Column < column
+}
+
+func (p *printer) statement(s ast.Statement, last bool) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.out.WriteString("let " + s.Name.Value + " = ")
+		p.expression(s.Value)
+		p.out.WriteString(";")
+	case *ast.ReturnStatement:
+		p.out.WriteString("return ")
+		p.expression(s.ReturnValue)
+		p.out.WriteString(";")
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression)
+		if !last {
+			p.out.WriteString(";")
+		}
+	}
+}
+
+// block prints a block on its own lines, or on the line of its braces
+// when it was written on one line and has one statement and no comments
+func (p *printer) block(b *ast.BlockStatement) {
+	if len(b.Statements) == 0 && !p.pending(b.End.Line, b.End.Column) {
+		p.out.WriteString("{}")
+		return
+	}
+
+	if len(b.Statements) == 1 && b.Token.Line == b.End.Line && !p.pending(b.End.Line, b.End.Column) {
+		inline := &printer{}
+		inline.statement(b.Statements[0], true)
+		if !bytes.Contains(inline.out.Bytes(), []byte("\n")) {
+			p.out.WriteString("{ " + inline.out.String() + " }")
+			return
+		}
+	}
+
+	p.out.WriteString("{\n")
+	p.indent++
+	p.first = true
+	p.statements(b.Statements, b.End, false)
+	p.indent--
+	p.first = false
+	p.out.WriteString(strings.Repeat(indentation, p.indent) + "}")
+}
+
+func (p *printer) expression(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.out.WriteString(e.Value)
+	case *ast.IntegerLiteral:
+		p.out.WriteString(strconv.FormatInt(e.Value, 10))
+	case *ast.StringLiteral:
+		p.out.WriteString(`"` + e.Value + `"`)
+	case *ast.Boolean:
+		p.out.WriteString(strconv.FormatBool(e.Value))
+	case *ast.PrefixExpression:
+		p.out.WriteString(e.Operator)
+		p.operand(e.Right, prefix, false)
+	case *ast.InfixExpression:
+		p.operand(e.Left, precedences[e.Operator], false)
+		p.out.WriteString(" " + e.Operator + " ")
+		p.operand(e.Right, precedences[e.Operator], true)
+	case *ast.CallExpression:
+		p.operand(e.Function, postfix, false)
+		p.out.WriteString("(")
+		p.list(e.Arguments)
+		p.out.WriteString(")")
+	case *ast.IndexExpression:
+		p.operand(e.Left, postfix, false)
+		p.out.WriteString("[")
+		p.expression(e.Index)
+		p.out.WriteString("]")
+	case *ast.ArrayLiteral:
+		p.out.WriteString("[")
+		p.list(e.Elements)
+		p.out.WriteString("]")
+	case *ast.FunctionLiteral:
+		p.out.WriteString("fn(" + parameters(e.Parameters) + ") ")
+		p.block(e.Body)
+	case *ast.MacroLiteral:
+		p.out.WriteString("macro(" + parameters(e.Parameters) + ") ")
+		p.block(e.Body)
+	case *ast.IfExpression:
+		p.out.WriteString("if (")
+		p.expression(e.Condition)
+		p.out.WriteString(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.out.WriteString(" else ")
+			p.block(e.Alternative)
+		}
+	}
+}
+
+// operand prints an operand of an operator, in parentheses when the
+// operator binds tighter than the operand. Operators are left
+// associative, so right operands of the same precedence need them too.
+func (p *printer) operand(e ast.Expression, precedence int, right bool) {
+	operand := postfix
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		operand = precedences[e.Operator]
+	case *ast.PrefixExpression:
+		operand = prefix
+	}
+
+	if operand < precedence || right && operand == precedence {
+		p.out.WriteString("(")
+		p.expression(e)
+		p.out.WriteString(")")
+		return
+	}
+	p.expression(e)
+}
+
+func parameters(identifiers []*ast.Identifier) string {
+	names := make([]string, len(identifiers))
+	for i, ident := range identifiers {
+		names[i] = ident.Value
+	}
+	return strings.Join(names, ", ")
+}
+
+func (p *printer) list(expressions []ast.Expression) {
+	for i, e := range expressions {
+		if i > 0 {
+			p.out.WriteString(", ")
+		}
+		p.expression(e)
+	}
+}
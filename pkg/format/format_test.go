@@ -0,0 +1,144 @@
+package format
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
+	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+)
+
+var formatTests = []struct {
+	input    string
+	expected string
+}{
+	{"", ""},
+	{"let x=1;x", "let x = 1;\nx;\n"},
+	{"let a = 1; let b = 2\n\n\n\nlet c = 3", "let a = 1;\nlet b = 2;\n\nlet c = 3;\n"},
+	{
+		"let b = (1 + 2) * -(3 - 4) - (5 - 6) - 7 / (8 * 9);(-f)(x)[0]; -f(x); !(a == b) == (c < d);",
+		"let b = (1 + 2) * -(3 - 4) - (5 - 6) - 7 / (8 * 9);\n(-f)(x)[0];\n-f(x);\n!(a == b) == c < d;\n",
+	},
+	{
+		`let f = fn(a,b){let s=a+b;return s;};`,
+		"let f = fn(a, b) {\n  let s = a + b;\n  return s;\n};\n",
+	},
+	{
+		"let f = fn(x) {\n  x * 2;\n};\nmap([1, \"two\", true], fn(x) { x });let g = fn() {\n};",
+		"let f = fn(x) {\n  x * 2\n};\nmap([1, \"two\", true], fn(x) { x });\nlet g = fn() {};\n",
+	},
+	{
+		"let unless=macro(c,a){quote(if(!(unquote(c))){unquote(a)})};",
+		"let unless = macro(c, a) { quote(if (!unquote(c)) { unquote(a) }) };\n",
+	},
+	{
+		"if (x > 1) { if (y) { 1 } else { 2 } } else {\n3 }",
+		"if (x > 1) { if (y) { 1 } else { 2 } } else {\n  3\n};\n",
+	},
+	{
+		"if (x) { let y = 1; y }",
+		"if (x) {\n  let y = 1;\n  y\n};\n",
+	},
+	{
+		"// header\n\n// about x\nlet x = 1;   // one\n\n\n// before f\nlet f = fn() { // f\n  // inside\n  x\n\n  // end\n};\n// footer",
+		"// header\n\n// about x\nlet x = 1; // one\n\n// before f\nlet f = fn() { // f\n  // inside\n  x\n\n  // end\n};\n// footer\n",
+	},
+	{
+		"let a = [\n  1, // one\n  // two\n  2\n];\nlet b = 1;",
+		"let a = [1, 2]; // one\n// two\nlet b = 1;\n",
+	},
+	{
+		"let f = fn() {\n  // nothing\n};",
+		"let f = fn() {\n  // nothing\n};\n",
+	},
+}
+
+func TestSource(t *testing.T) {
+	for _, tt := range formatTests {
+		formatted, err := Source(tt.input)
+		if err != nil {
+			t.Fatalf("error formatting %q: %s", tt.input, err)
+		}
+		if formatted != tt.expected {
+			t.Errorf("wrong formatting of %q.\nwant=%q\ngot=%q", tt.input, tt.expected, formatted)
+		}
+	}
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source("let x 1;")
+	if err == nil || err.Error() != "expected =, got INT instead (on line 1, col 7)" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
+
+// TestIdempotency formats the examples and the test inputs twice, checking
+// that formatting keeps the program and does not change formatted code
+func TestIdempotency(t *testing.T) {
+	corpus := map[string]string{}
+	for i, tt := range formatTests {
+		corpus["test "+string(rune('a'+i))] = tt.input
+	}
+
+	files, err := filepath.Glob("../../examples/*.monkey")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corpus[file] = string(content)
+	}
+
+	for name, source := range corpus {
+		formatted, err := Source(source)
+		if err != nil {
+			t.Fatalf("error formatting %s: %s", name, err)
+		}
+
+		again, err := Source(formatted)
+		if err != nil {
+			t.Fatalf("error formatting %s again: %s", name, err)
+		}
+		if again != formatted {
+			t.Errorf("formatting %s is not idempotent.\nfirst=%q\nsecond=%q", name, formatted, again)
+		}
+
+		if parse(t, formatted) != parse(t, source) {
+			t.Errorf("formatting %s changed the program.\nwant=%s\ngot=%s", name, parse(t, source), parse(t, formatted))
+		}
+	}
+}
+
+func TestNode(t *testing.T) {
+	program := parser.New(lexer.New("let f = fn(x) { // double\n x * 2 };\nf((1 + 2) * 3)")).ParseProgram()
+
+	tests := []struct {
+		formatted string
+		expected  string
+	}{
+		{Node(program), "let f = fn(x) {\n  x * 2\n};\nf((1 + 2) * 3);\n"},
+		{Node(program.Statements[0]), "let f = fn(x) {\n  x * 2\n};"},
+		{Node(program.Statements[1]), "f((1 + 2) * 3);"},
+	}
+
+	for _, tt := range tests {
+		if tt.formatted != tt.expected {
+			t.Errorf("wrong formatting.\nwant=%q\ngot=%q", tt.expected, tt.formatted)
+		}
+	}
+}
+
+func parse(t *testing.T, source string) string {
+	t.Helper()
+
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program.String()
+}
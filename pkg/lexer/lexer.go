@@ -1,6 +1,10 @@
 package lexer
 
-import "github.com/jalopez/go-monkey-interpreter/pkg/token"
+import (
+	"strings"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
 
 // Lexer lexer
 type Lexer struct {
@@ -10,6 +14,8 @@ type Lexer struct {
 	line         int  // current line number
 	column       int  // current column number
 	ch           byte // current char under examination
+	lastLine     int  // line of the last token returned
+	comments     []token.Comment
 }
 
 // New creates a new lexer
@@ -25,6 +31,17 @@ func New(input string) *Lexer {
 
 // NextToken returns the next token of the input
 func (l *Lexer) NextToken() token.Token {
+	tok := l.nextToken()
+	l.lastLine = tok.Line
+	return tok
+}
+
+// Comments returns the comments skipped so far, in order
+func (l *Lexer) Comments() []token.Comment {
+	return l.comments
+}
+
+func (l *Lexer) nextToken() token.Token {
 	var nextToken token.Token
 
 	l.skipWhitespace()
@@ -82,10 +99,14 @@ func (l *Lexer) NextToken() token.Token {
 		}
 	case '/':
 		if l.peekChar() == '/' {
+			comment := token.Comment{Line: l.line, Column: l.column, Trailing: l.lastLine == l.line}
+			position := l.position
 			for l.ch != '\n' && l.ch != 0 {
 				l.readChar()
 			}
-			return l.NextToken()
+			comment.Text = strings.TrimRight(l.input[position:l.position], " \t\r")
+			l.comments = append(l.comments, comment)
+			return l.nextToken()
 		}
 
 		nextToken = newToken(token.SLASH, l)
@@ -111,6 +132,8 @@ func (l *Lexer) NextToken() token.Token {
 	case 0:
 		nextToken.Literal = ""
 		nextToken.Type = token.EOF
+		nextToken.Line = l.line
+		nextToken.Column = l.column
 	default:
 		switch {
 		case isLetter(l.ch):
@@ -171,3 +171,34 @@ if (5 < 10) {
 
 	runTest(t, input, expected)
 }
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 5; // trailing   
+// own line
+x / 2
+//`
+	l := New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Type == token.ILLEGAL {
+			t.Fatalf("illegal token %q", tok.Literal)
+		}
+	}
+
+	expected := []token.Comment{
+		{Text: "// leading", Line: 1, Column: 1},
+		{Text: "// trailing", Line: 2, Column: 12, Trailing: true},
+		{Text: "// own line", Line: 3, Column: 1},
+		{Text: "//", Line: 5, Column: 1},
+	}
+
+	comments := l.Comments()
+	if len(comments) != len(expected) {
+		t.Fatalf("wrong number of comments. want=%d, got=%d", len(expected), len(comments))
+	}
+	for i, want := range expected {
+		if comments[i] != want {
+			t.Errorf("wrong comment %d. want=%+v, got=%+v", i, want, comments[i])
+		}
+	}
+}
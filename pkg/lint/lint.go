@@ -0,0 +1,130 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
+
+// Diagnostic is a problem found by a rule, at the token of the code with
+// the problem
+type Diagnostic struct {
+	Rule    string
+	Token   token.Token
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s (%s)", d.Token.Line, d.Token.Column, d.Message, d.Rule)
+}
+
+// MarshalJSON encodes a diagnostic with the line and column of its token
+func (d Diagnostic) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Rule    string `json:"rule"`
+		Line    int    `json:"line"`
+		Column  int    `json:"column"`
+		Message string `json:"message"`
+	}{d.Rule, d.Token.Line, d.Token.Column, d.Message})
+}
+
+// Rule checks programs for a kind of problem
+type Rule interface {
+	// Name identifies the rule in configurations and diagnostics
+	Name() string
+	// Description describes the problems the rule finds
+	Description() string
+	// Check returns the problems found in a program. The linter sets the
+	// rule of the diagnostics.
+	Check(program *ast.Program) []Diagnostic
+}
+
+// Rules are the rules of the linter
+var Rules = []Rule{
+	unusedBinding{},
+	shadowedParameter{},
+	unreachableCode{},
+	builtinArity{},
+	typeMismatch{},
+}
+
+// Config selects the rules a linter runs: every rule, or only those in
+// Enable when it is not empty, but those in Disable.
+type Config struct {
+	Enable  []string `json:"enable"`
+	Disable []string `json:"disable"`
+}
+
+// Linter checks programs with a set of rules
+type Linter struct {
+	rules []Rule
+}
+
+// New creates a linter running the rules selected by a configuration. It
+// fails when the configuration names unknown rules.
+func New(rules []Rule, config Config) (*Linter, error) {
+	known := map[string]bool{}
+	for _, r := range rules {
+		known[r.Name()] = true
+	}
+
+	selected := func(names []string) (map[string]bool, error) {
+		set := map[string]bool{}
+		for _, name := range names {
+			if !known[name] {
+				return nil, fmt.Errorf("unknown rule %q", name)
+			}
+			set[name] = true
+		}
+		return set, nil
+	}
+
+	enabled, err := selected(config.Enable)
+	if err != nil {
+		return nil, err
+	}
+	disabled, err := selected(config.Disable)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Linter{}
+	for _, r := range rules {
+		if (len(enabled) == 0 || enabled[r.Name()]) && !disabled[r.Name()] {
+			l.rules = append(l.rules, r)
+		}
+	}
+
+	return l, nil
+}
+
+// Rules returns the rules the linter runs
+func (l *Linter) Rules() []Rule {
+	return l.rules
+}
+
+// Lint returns the problems found in a program by the rules, sorted by
+// position
+func (l *Linter) Lint(program *ast.Program) []Diagnostic {
+	diagnostics := []Diagnostic{}
+
+	for _, r := range l.rules {
+		for _, d := range r.Check(program) {
+			d.Rule = r.Name()
+			diagnostics = append(diagnostics, d)
+		}
+	}
+
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Token, diagnostics[j].Token
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+
+	return diagnostics
+}
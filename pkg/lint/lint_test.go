@@ -0,0 +1,150 @@
+package lint
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func lint(t *testing.T, input string, config Config) []string {
+	t.Helper()
+
+	l, err := New(Rules, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var diagnostics []string
+	for _, d := range l.Lint(parse(t, input)) {
+		diagnostics = append(diagnostics, d.String())
+	}
+	return diagnostics
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rule     string
+		input    string
+		expected []string
+	}{
+		{
+			"unused-binding",
+			"let a = 1; let b = 2; let _c = 3; let f = fn(x) { let y = x; a }; f(b)",
+			[]string{"1:55: y is never used (unused-binding)"},
+		},
+		{
+			"unused-binding",
+			"let x = 1; let x = x + 1; let loop = fn(n) { loop(n) };",
+			[]string{"1:16: x is never used (unused-binding)", "1:31: loop is never used (unused-binding)"},
+		},
+		{
+			"shadowed-parameter",
+			"let f = fn(x, y) { let x = 1; let g = fn(y, z) { let f = z; f }; g(x, y) }; f(1, 2)",
+			[]string{"1:24: x shadows the parameter on line 1 (shadowed-parameter)", "1:42: y shadows the parameter on line 1 (shadowed-parameter)"},
+		},
+		{
+			"unreachable-code",
+			"let f = fn(x) {\n  return x;\n  x + 1;\n  x + 2\n};\nlet g = fn(x) { if (x) { return 1; } else { return 2; }; 3 };\nlet h = fn(x) { if (x) { return 1; }; 2 };\nreturn 1;\nf(g(h(1)))",
+			[]string{"3:3: unreachable code (unreachable-code)", "6:58: unreachable code (unreachable-code)", "9:1: unreachable code (unreachable-code)"},
+		},
+		{
+			"builtin-arity",
+			"len(); len([1]); puts(); push([1]); chan(1, 2); spawn(); let first = fn() { 1 }; first()",
+			[]string{
+				"1:1: len takes 1 argument, got 0 (builtin-arity)",
+				"1:26: push takes 2 arguments, got 1 (builtin-arity)",
+				"1:37: chan takes 0 to 1 argument, got 2 (builtin-arity)",
+				"1:49: spawn takes at least 1 argument, got 0 (builtin-arity)",
+			},
+		},
+		{
+			"type-mismatch",
+			`let x = 1; 1 == "1"; x == "1"; -1 != true; (1 < 2) == !x; [1] == fn() {}; "a" + "b" > 1 + 2; x > 1`,
+			[]string{
+				`1:14: comparing INTEGER == STRING, values of different types (type-mismatch)`,
+				`1:35: comparing INTEGER != BOOLEAN, values of different types (type-mismatch)`,
+				`1:63: comparing ARRAY == FUNCTION, values of different types (type-mismatch)`,
+				`1:85: comparing STRING > INTEGER, values of different types (type-mismatch)`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		diagnostics := lint(t, tt.input, Config{Enable: []string{tt.rule}})
+		if strings.Join(diagnostics, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong %s diagnostics for %q.\nwant=%q\ngot=%q", tt.rule, tt.input, tt.expected, diagnostics)
+		}
+	}
+}
+
+func TestConfig(t *testing.T) {
+	input := "let x = 1; return 2; len()"
+
+	tests := []struct {
+		config   Config
+		expected []string
+	}{
+		{Config{}, []string{
+			"1:5: x is never used (unused-binding)",
+			"1:22: unreachable code (unreachable-code)",
+			"1:22: len takes 1 argument, got 0 (builtin-arity)",
+		}},
+		{Config{Disable: []string{"unreachable-code"}}, []string{
+			"1:5: x is never used (unused-binding)",
+			"1:22: len takes 1 argument, got 0 (builtin-arity)",
+		}},
+		{Config{Enable: []string{"unused-binding", "builtin-arity"}, Disable: []string{"unused-binding"}}, []string{
+			"1:22: len takes 1 argument, got 0 (builtin-arity)",
+		}},
+	}
+
+	for _, tt := range tests {
+		diagnostics := lint(t, input, tt.config)
+		if strings.Join(diagnostics, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong diagnostics with %+v.\nwant=%q\ngot=%q", tt.config, tt.expected, diagnostics)
+		}
+	}
+
+	for _, config := range []Config{{Enable: []string{"unknown"}}, {Disable: []string{"unknown"}}} {
+		if _, err := New(Rules, config); err == nil || err.Error() != `unknown rule "unknown"` {
+			t.Errorf("wrong error for %+v. got=%v", config, err)
+		}
+	}
+}
+
+func TestDiagnosticJSON(t *testing.T) {
+	l, _ := New(Rules, Config{})
+	content, err := json.Marshal(l.Lint(parse(t, "let x = 1;")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `[{"rule":"unused-binding","line":1,"column":5,"message":"x is never used"}]`
+	if string(content) != expected {
+		t.Errorf("wrong JSON.\nwant=%s\ngot=%s", expected, content)
+	}
+}
+
+func TestArities(t *testing.T) {
+	for _, b := range object.Builtins {
+		if _, ok := arities[b.Name]; !ok {
+			t.Errorf("no arity for builtin %s", b.Name)
+		}
+	}
+}
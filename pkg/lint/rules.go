@@ -0,0 +1,291 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
+
+// unusedBinding reports let bindings never used. Names starting with _ are
+// meant to be unused.
+type unusedBinding struct{}
+
+func (unusedBinding) Name() string { return "unused-binding" }
+
+func (unusedBinding) Description() string { return "let bindings that are never used" }
+
+func (unusedBinding) Check(program *ast.Program) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for _, b := range resolve(program).bindings {
+		if !b.parameter && !b.used && !strings.HasPrefix(b.ident.Value, "_") {
+			diagnostics = append(diagnostics, Diagnostic{
+				Token:   b.ident.Token,
+				Message: fmt.Sprintf("%s is never used", b.ident.Value),
+			})
+		}
+	}
+
+	return diagnostics
+}
+
+// shadowedParameter reports parameters hidden by let bindings or by the
+// parameters of nested functions
+type shadowedParameter struct{}
+
+func (shadowedParameter) Name() string { return "shadowed-parameter" }
+
+func (shadowedParameter) Description() string {
+	return "bindings hiding a parameter of the function or of an enclosing one"
+}
+
+func (shadowedParameter) Check(program *ast.Program) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	for _, s := range resolve(program).shadows {
+		if s.shadowed.parameter {
+			diagnostics = append(diagnostics, Diagnostic{
+				Token:   s.binding.ident.Token,
+				Message: fmt.Sprintf("%s shadows the parameter on line %d", s.binding.ident.Value, s.shadowed.ident.Token.Line),
+			})
+		}
+	}
+
+	return diagnostics
+}
+
+// unreachableCode reports statements after a return, or after an if
+// expression returning from both branches
+type unreachableCode struct{}
+
+func (unreachableCode) Name() string { return "unreachable-code" }
+
+func (unreachableCode) Description() string {
+	return "statements that are never run because of a return"
+}
+
+func (unreachableCode) Check(program *ast.Program) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	check := func(statements []ast.Statement) {
+		for i, s := range statements[:max(len(statements)-1, 0)] {
+			if returns(s) {
+				diagnostics = append(diagnostics, Diagnostic{
+					Token:   statementToken(statements[i+1]),
+					Message: "unreachable code",
+				})
+				return
+			}
+		}
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.Program:
+			check(node.Statements)
+		case *ast.BlockStatement:
+			check(node.Statements)
+		}
+		return true
+	})
+
+	return diagnostics
+}
+
+// returns reports whether a statement always returns
+func returns(s ast.Statement) bool {
+	switch s := s.(type) {
+	case *ast.ReturnStatement:
+		return true
+	case *ast.ExpressionStatement:
+		e, ok := s.Expression.(*ast.IfExpression)
+		return ok && e.Alternative != nil && blockReturns(e.Consequence) && blockReturns(e.Alternative)
+	}
+	return false
+}
+
+func blockReturns(b *ast.BlockStatement) bool {
+	for _, s := range b.Statements {
+		if returns(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func statementToken(s ast.Statement) token.Token {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		return s.Token
+	case *ast.ReturnStatement:
+		return s.Token
+	case *ast.ExpressionStatement:
+		return s.Token
+	}
+	return token.Token{}
+}
+
+// arity is the number of arguments of a builtin, with no maximum when max
+// is -1
+type arity struct {
+	min, max int
+}
+
+var arities = map[string]arity{
+	"len":       {1, 1},
+	"puts":      {0, -1},
+	"first":     {1, 1},
+	"last":      {1, 1},
+	"rest":      {1, 1},
+	"push":      {2, 2},
+	"map":       {2, 2},
+	"filter":    {2, 2},
+	"reduce":    {3, 3},
+	"each":      {2, 2},
+	"sort_by":   {2, 2},
+	"print":     {0, -1},
+	"eprint":    {0, -1},
+	"read_line": {0, 0},
+	"read_all":  {0, 0},
+	"spawn":     {1, -1},
+	"wait":      {1, 1},
+	"chan":      {0, 1},
+	"send":      {2, 2},
+	"recv":      {1, 1},
+	"close":     {1, 1},
+	"select":    {1, 1},
+}
+
+// builtinArity reports calls to builtins with the wrong number of
+// arguments. Names bound by the program are not builtins.
+type builtinArity struct{}
+
+func (builtinArity) Name() string { return "builtin-arity" }
+
+func (builtinArity) Description() string {
+	return "calls to builtins with the wrong number of arguments"
+}
+
+func (builtinArity) Check(program *ast.Program) []Diagnostic {
+	var diagnostics []Diagnostic
+	uses := resolve(program).uses
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+		ident, ok := call.Function.(*ast.Identifier)
+		if !ok || uses[ident] != nil {
+			return true
+		}
+		a, ok := arities[ident.Value]
+		if !ok {
+			return true
+		}
+
+		got := len(call.Arguments)
+		if got < a.min || a.max != -1 && got > a.max {
+			diagnostics = append(diagnostics, Diagnostic{
+				Token:   ident.Token,
+				Message: fmt.Sprintf("%s takes %s, got %d", ident.Value, a, got),
+			})
+		}
+		return true
+	})
+
+	return diagnostics
+}
+
+func (a arity) String() string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return fmt.Sprintf("%d arguments", n)
+	}
+
+	switch {
+	case a.max == -1:
+		return "at least " + plural(a.min)
+	case a.min == a.max:
+		return plural(a.min)
+	default:
+		return fmt.Sprintf("%d to %s", a.min, plural(a.max))
+	}
+}
+
+// typeMismatch reports comparisons of values whose types are known to be
+// different, which are never equal and fail to be ordered, and which the
+// evaluator rejects
+type typeMismatch struct{}
+
+func (typeMismatch) Name() string { return "type-mismatch" }
+
+func (typeMismatch) Description() string { return "comparisons of values of different types" }
+
+func (typeMismatch) Check(program *ast.Program) []Diagnostic {
+	var diagnostics []Diagnostic
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		infix, ok := node.(*ast.InfixExpression)
+		if !ok || !comparison(infix.Operator) {
+			return true
+		}
+
+		left, right := staticType(infix.Left), staticType(infix.Right)
+		if left != "" && right != "" && left != right {
+			diagnostics = append(diagnostics, Diagnostic{
+				Token:   infix.Token,
+				Message: fmt.Sprintf("comparing %s %s %s, values of different types", left, infix.Operator, right),
+			})
+		}
+		return true
+	})
+
+	return diagnostics
+}
+
+func comparison(operator string) bool {
+	switch operator {
+	case token.EQ, token.NOTEQ, token.LT, token.GT:
+		return true
+	}
+	return false
+}
+
+// staticType returns the type of the values of an expression when it is
+// known without running it, or ""
+func staticType(e ast.Expression) object.Type {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return object.INTEGER_OBJ
+	case *ast.StringLiteral:
+		return object.STRING_OBJ
+	case *ast.Boolean:
+		return object.BOOLEAN_OBJ
+	case *ast.ArrayLiteral:
+		return object.ARRAY_OBJ
+	case *ast.FunctionLiteral:
+		return object.FUNCTION_OBJ
+	case *ast.PrefixExpression:
+		if e.Operator == token.BANG {
+			return object.BOOLEAN_OBJ
+		}
+		if staticType(e.Right) == object.INTEGER_OBJ {
+			return object.INTEGER_OBJ
+		}
+	case *ast.InfixExpression:
+		if comparison(e.Operator) {
+			return object.BOOLEAN_OBJ
+		}
+		left := staticType(e.Left)
+		if left == staticType(e.Right) && (left == object.INTEGER_OBJ || left == object.STRING_OBJ && e.Operator == token.PLUS) {
+			return left
+		}
+	}
+	return ""
+}
@@ -0,0 +1,112 @@
+package lint
+
+import (
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+)
+
+// binding is a name bound by a let statement or a parameter
+type binding struct {
+	ident     *ast.Identifier
+	parameter bool
+	used      bool
+	// defining is set while the value of the binding is resolved, where
+	// recursive calls do not use it
+	defining bool
+}
+
+// scope is the names bound in a function, or at the top level
+type scope struct {
+	outer    *scope
+	bindings map[string]*binding
+}
+
+func (s *scope) lookup(name string) *binding {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
+
+// shadow is a binding hiding another one
+type shadow struct {
+	binding  *binding
+	shadowed *binding
+}
+
+// resolution is the binding of the identifiers of a program
+type resolution struct {
+	// bindings are the bindings of the program, in order
+	bindings []*binding
+	// uses are the bindings of the identifiers used, nil for builtins
+	// and undefined names
+	uses    map[*ast.Identifier]*binding
+	shadows []shadow
+	// functions are the let bindings of function literals, which see
+	// their own name
+	functions map[*ast.FunctionLiteral]*binding
+}
+
+// resolve resolves the identifiers of a program as the compiler does: the
+// value of a let statement is resolved before its name is bound, and
+// function literals bind their parameters in a scope of their own.
+func resolve(program *ast.Program) *resolution {
+	r := &resolution{uses: map[*ast.Identifier]*binding{}, functions: map[*ast.FunctionLiteral]*binding{}}
+	ast.Walk(resolver{r, &scope{bindings: map[string]*binding{}}}, program)
+	return r
+}
+
+// resolver resolves the identifiers of a node in a scope
+type resolver struct {
+	r *resolution
+	s *scope
+}
+
+func (v resolver) Visit(node ast.Node) ast.Visitor {
+	switch node := node.(type) {
+	case *ast.LetStatement:
+		b := &binding{ident: node.Name}
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok && fn.Name != "" {
+			v.r.functions[fn] = b
+		}
+		b.defining = true
+		ast.Walk(v, node.Value)
+		b.defining = false
+		v.r.bind(v.s, b)
+		return nil
+	case *ast.Identifier:
+		b := v.s.lookup(node.Value)
+		if b != nil && !b.defining {
+			b.used = true
+		}
+		v.r.uses[node] = b
+		return nil
+	case *ast.FunctionLiteral:
+		inner := &scope{outer: v.s, bindings: map[string]*binding{}}
+		if b, ok := v.r.functions[node]; ok {
+			inner.bindings[node.Name] = b
+		}
+		for _, p := range node.Parameters {
+			v.r.bind(inner, &binding{ident: p, parameter: true})
+		}
+		ast.Walk(resolver{v.r, inner}, node.Body)
+		return nil
+	case *ast.MacroLiteral:
+		inner := &scope{outer: v.s, bindings: map[string]*binding{}}
+		for _, p := range node.Parameters {
+			v.r.bind(inner, &binding{ident: p, parameter: true})
+		}
+		ast.Walk(resolver{v.r, inner}, node.Body)
+		return nil
+	}
+	return v
+}
+
+func (r *resolution) bind(s *scope, b *binding) {
+	if shadowed := s.lookup(b.ident.Value); shadowed != nil && shadowed != b {
+		r.shadows = append(r.shadows, shadow{b, shadowed})
+	}
+	s.bindings[b.ident.Value] = b
+	r.bindings = append(r.bindings, b)
+}
@@ -0,0 +1,231 @@
+package lsp
+
+import (
+	"sort"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/compiler"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
+
+// definitionKind is what defines a name
+type definitionKind string
+
+const (
+	letDefinition       definitionKind = "let"
+	parameterDefinition definitionKind = "parameter"
+	builtinDefinition   definitionKind = "builtin"
+)
+
+// definition is a name bound by a let statement, a parameter or a builtin
+type definition struct {
+	name string
+	kind definitionKind
+	// ident is the identifier defining the name, nil for builtins
+	ident *ast.Identifier
+	// statement is the let statement defining the name, if any
+	statement *ast.LetStatement
+	// parent is the let statement whose value defines this one
+	parent     *definition
+	references []*ast.Identifier
+}
+
+// function returns the function literal bound by a let statement, if any
+func (def *definition) function() (*ast.FunctionLiteral, bool) {
+	if def.statement == nil {
+		return nil, false
+	}
+	fn, ok := def.statement.Value.(*ast.FunctionLiteral)
+	return fn, ok
+}
+
+// key identifies a symbol by the symbol table defining it
+type key struct {
+	table *compiler.SymbolTable
+	scope compiler.SymbolScope
+	index int
+}
+
+// analysis resolves the identifiers of a program with the symbol tables
+// of the compiler, in the order it compiles them, so names resolve to the
+// same definitions as when the program runs
+type analysis struct {
+	global      *compiler.SymbolTable
+	symbols     map[key]*definition
+	functions   map[*ast.FunctionLiteral]*definition
+	enclosing   *definition
+	builtins    []*definition
+	definitions []*definition
+	// identifiers are the identifiers defining or using a definition
+	identifiers map[*ast.Identifier]*definition
+	// undefined are the identifiers that do not resolve, in compilation
+	// order
+	undefined []*ast.Identifier
+}
+
+func analyze(program *ast.Program) *analysis {
+	a := &analysis{
+		global:      compiler.NewSymbolTable(),
+		symbols:     map[key]*definition{},
+		functions:   map[*ast.FunctionLiteral]*definition{},
+		identifiers: map[*ast.Identifier]*definition{},
+	}
+
+	for i, b := range object.Builtins {
+		symbol := a.global.DefineBuiltin(i, b.Name)
+		def := &definition{name: b.Name, kind: builtinDefinition}
+		a.symbols[a.key(a.global, symbol)] = def
+		a.builtins = append(a.builtins, def)
+	}
+
+	a.walk(program, a.global)
+	return a
+}
+
+func (a *analysis) walk(node ast.Node, table *compiler.SymbolTable) {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			a.walk(s, table)
+		}
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			a.walk(s, table)
+		}
+	case *ast.ExpressionStatement:
+		a.walk(node.Expression, table)
+	case *ast.ReturnStatement:
+		a.walk(node.ReturnValue, table)
+	case *ast.LetStatement:
+		def := &definition{name: node.Name.Value, kind: letDefinition, ident: node.Name, statement: node, parent: a.enclosing}
+		a.definitions = append(a.definitions, def)
+		if fn, ok := node.Value.(*ast.FunctionLiteral); ok && fn.Name != "" {
+			a.functions[fn] = def
+		}
+
+		// the value is compiled before the name is defined
+		enclosing := a.enclosing
+		a.enclosing = def
+		a.walk(node.Value, table)
+		a.enclosing = enclosing
+
+		a.define(table, node.Name, def)
+	case *ast.Identifier:
+		symbol, ok := table.Resolve(node.Value)
+		if !ok {
+			a.undefined = append(a.undefined, node)
+			return
+		}
+
+		def := a.resolve(table, symbol)
+		if def != nil {
+			def.references = append(def.references, node)
+			a.identifiers[node] = def
+		}
+	case *ast.FunctionLiteral:
+		inner := compiler.NewEnclosedSymbolTable(table)
+		if node.Name != "" {
+			symbol := inner.DefineFunctionName(node.Name)
+			if def, ok := a.functions[node]; ok {
+				a.symbols[a.key(inner, symbol)] = def
+			}
+		}
+
+		for _, p := range node.Parameters {
+			def := &definition{name: p.Value, kind: parameterDefinition, ident: p, parent: a.enclosing}
+			a.definitions = append(a.definitions, def)
+			a.define(inner, p, def)
+		}
+
+		a.walk(node.Body, inner)
+	case *ast.PrefixExpression:
+		a.walk(node.Right, table)
+	case *ast.InfixExpression:
+		// < is compiled as > with its operands swapped
+		if node.Operator == token.LT {
+			a.walk(node.Right, table)
+			a.walk(node.Left, table)
+		} else {
+			a.walk(node.Left, table)
+			a.walk(node.Right, table)
+		}
+	case *ast.IfExpression:
+		a.walk(node.Condition, table)
+		a.walk(node.Consequence, table)
+		if node.Alternative != nil {
+			a.walk(node.Alternative, table)
+		}
+	case *ast.CallExpression:
+		a.walk(node.Function, table)
+		for _, arg := range node.Arguments {
+			a.walk(arg, table)
+		}
+	case *ast.ArrayLiteral:
+		for _, e := range node.Elements {
+			a.walk(e, table)
+		}
+	case *ast.IndexExpression:
+		a.walk(node.Left, table)
+		a.walk(node.Index, table)
+	}
+}
+
+func (a *analysis) define(table *compiler.SymbolTable, ident *ast.Identifier, def *definition) {
+	symbol := table.Define(ident.Value)
+	a.symbols[a.key(table, symbol)] = def
+	a.identifiers[ident] = def
+}
+
+// resolve returns the definition of a symbol resolved in a table,
+// following free symbols to the tables defining them
+func (a *analysis) resolve(table *compiler.SymbolTable, symbol compiler.Symbol) *definition {
+	if symbol.Scope == compiler.FreeScope {
+		return a.resolve(table.Outer(), table.FreeSymbols[symbol.Index])
+	}
+	return a.symbols[a.key(table, symbol)]
+}
+
+func (a *analysis) key(table *compiler.SymbolTable, symbol compiler.Symbol) key {
+	switch symbol.Scope {
+	case compiler.GlobalScope, compiler.BuiltinScope:
+		// globals and builtins resolve as such in every table
+		table = a.global
+	}
+	return key{table, symbol.Scope, symbol.Index}
+}
+
+// at returns the identifier at a position and its definition
+func (a *analysis) at(pos position) (*ast.Identifier, *definition) {
+	for ident, def := range a.identifiers {
+		start := ident.Token.Column - 1
+		if ident.Token.Line == pos.Line+1 && pos.Character >= start && pos.Character <= start+len(ident.Value) {
+			return ident, def
+		}
+	}
+	return nil, nil
+}
+
+// occurrences returns the identifiers referencing a definition, and the
+// one defining it when declaration is set, sorted by position
+func (def *definition) occurrences(declaration bool) []*ast.Identifier {
+	var idents []*ast.Identifier
+	if declaration && def.ident != nil {
+		idents = append(idents, def.ident)
+	}
+	idents = append(idents, def.references...)
+
+	sort.Slice(idents, func(i, j int) bool {
+		if idents[i].Token.Line != idents[j].Token.Line {
+			return idents[i].Token.Line < idents[j].Token.Line
+		}
+		return idents[i].Token.Column < idents[j].Token.Column
+	})
+	return idents
+}
+
+// identRange returns the range of an identifier in a document
+func identRange(ident *ast.Identifier) textRange {
+	start := position{Line: ident.Token.Line - 1, Character: ident.Token.Column - 1}
+	return textRange{Start: start, End: position{Line: start.Line, Character: start.Character + len(ident.Value)}}
+}
@@ -0,0 +1,32 @@
+package lsp
+
+// builtin documents a builtin function on hover
+type builtin struct {
+	signature   string
+	description string
+}
+
+var builtins = map[string]builtin{
+	"len":       {"len(value)", "Returns the length of a string or an array."},
+	"puts":      {"puts(values...)", "Prints each value on its own line."},
+	"first":     {"first(array)", "Returns the first element of an array, or null when it is empty."},
+	"last":      {"last(array)", "Returns the last element of an array, or null when it is empty."},
+	"rest":      {"rest(array)", "Returns a new array with every element but the first one, or null when it is empty."},
+	"push":      {"push(array, value)", "Returns a new array with the value added at the end."},
+	"map":       {"map(array, fn(element))", "Returns a new array with the results of calling the function on each element."},
+	"filter":    {"filter(array, fn(element))", "Returns a new array with the elements for which the function returns a truthy value."},
+	"reduce":    {"reduce(array, initial, fn(accumulator, element))", "Combines the elements from left to right, starting from the initial value."},
+	"each":      {"each(array, fn(element))", "Calls the function on each element."},
+	"sort_by":   {"sort_by(array, fn(element))", "Returns a new array with the elements sorted by the keys the function returns."},
+	"print":     {"print(values...)", "Prints the values, with no separator or newline."},
+	"eprint":    {"eprint(values...)", "Prints the values to the standard error, with no separator or newline."},
+	"read_line": {"read_line()", "Reads a line of the standard input, or returns null at its end."},
+	"read_all":  {"read_all()", "Reads the rest of the standard input."},
+	"spawn":     {"spawn(fn, args...)", "Calls the function with the arguments concurrently, returning its task."},
+	"wait":      {"wait(task)", "Waits for a task, or an array of tasks, and returns its results."},
+	"chan":      {"chan(size)", "Returns a new channel, unbuffered unless a size is given."},
+	"send":      {"send(channel, value)", "Sends a value to a channel, blocking until it is received or buffered."},
+	"recv":      {"recv(channel)", "Receives a value from a channel, or null when it is closed."},
+	"close":     {"close(channel)", "Closes a channel."},
+	"select":    {"select(channels)", "Waits for a value on any of the channels, returning its index and the value."},
+}
@@ -0,0 +1,379 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/compiler"
+	diag "github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
+	"github.com/jalopez/go-monkey-interpreter/pkg/eval"
+	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+)
+
+var keywords = []string{"fn", "let", "true", "false", "if", "else", "return", "macro"}
+
+// document is an open document, analyzed on every change
+type document struct {
+	analysis *analysis
+}
+
+// Server serves the Language Server Protocol for Monkey documents open in
+// an editor. Documents are synchronized in full, and their diagnostics are
+// published on every change.
+type Server struct {
+	in        *bufio.Reader
+	out       io.Writer
+	documents map[string]*document
+	shutdown  bool
+}
+
+// NewServer creates a server reading messages from in and writing
+// responses and notifications to out.
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: bufio.NewReader(in), out: out, documents: map[string]*document{}}
+}
+
+// Serve handles messages until the client exits or closes its stream. It
+// fails when the client exits without shutting the server down first.
+func (s *Server) Serve() error {
+	for {
+		m, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if m.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+
+		if len(m.ID) == 0 {
+			s.notified(m)
+			continue
+		}
+
+		result, failure := s.handle(m)
+		if failure != nil {
+			s.write(&errorResponse{JSONRPC: "2.0", ID: m.ID, Error: *failure})
+			continue
+		}
+		s.write(&response{JSONRPC: "2.0", ID: m.ID, Result: result})
+	}
+}
+
+// handle handles a request, returning its result
+func (s *Server) handle(m *message) (any, *responseError) {
+	if s.shutdown {
+		return nil, &responseError{invalidRequest, "the server is shut down"}
+	}
+
+	switch m.Method {
+	case "initialize":
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       fullSync,
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"hoverProvider":          true,
+				"documentSymbolProvider": true,
+				"completionProvider":     map[string]any{},
+			},
+			"serverInfo": map[string]any{"name": "monkey"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/definition":
+		var params textDocumentPositionParams
+		doc, err := s.document(m, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+
+		_, def := doc.analysis.at(params.Position)
+		if def == nil || def.ident == nil {
+			return nil, nil
+		}
+		return location{URI: params.TextDocument.URI, Range: identRange(def.ident)}, nil
+	case "textDocument/references":
+		var params referenceParams
+		doc, err := s.document(m, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+
+		locations := []location{}
+		if _, def := doc.analysis.at(params.Position); def != nil {
+			for _, ident := range def.occurrences(params.Context.IncludeDeclaration) {
+				locations = append(locations, location{URI: params.TextDocument.URI, Range: identRange(ident)})
+			}
+		}
+		return locations, nil
+	case "textDocument/hover":
+		var params textDocumentPositionParams
+		doc, err := s.document(m, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+
+		ident, def := doc.analysis.at(params.Position)
+		if def == nil {
+			return nil, nil
+		}
+		return hover{Contents: markupContent{Kind: "markdown", Value: describe(def)}, Range: identRange(ident)}, nil
+	case "textDocument/documentSymbol":
+		var params documentSymbolParams
+		doc, err := s.document(m, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return symbols(doc.analysis, nil), nil
+	case "textDocument/completion":
+		var params textDocumentPositionParams
+		doc, err := s.document(m, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return completions(doc.analysis), nil
+	default:
+		return nil, &responseError{methodNotFound, fmt.Sprintf("unsupported method %q", m.Method)}
+	}
+}
+
+// notified handles a notification
+func (s *Server) notified(m *message) {
+	switch m.Method {
+	case "textDocument/didOpen":
+		var params didOpenParams
+		if json.Unmarshal(m.Params, &params) == nil {
+			s.open(params.TextDocument.URI, params.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var params didChangeParams
+		if json.Unmarshal(m.Params, &params) == nil && len(params.ContentChanges) > 0 {
+			// changes are full documents, the last one being the current
+			s.open(params.TextDocument.URI, params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var params didCloseParams
+		if json.Unmarshal(m.Params, &params) == nil {
+			delete(s.documents, params.TextDocument.URI)
+			s.publish(params.TextDocument.URI, []diagnostic{})
+		}
+	}
+}
+
+// open analyzes the text of a document and publishes its diagnostics
+func (s *Server) open(uri, text string) {
+	p := parser.New(lexer.New(text))
+	program := p.ParseProgram()
+
+	diagnostics := []diagnostic{}
+	for _, d := range p.Diagnostics() {
+		diagnostics = append(diagnostics, convertDiagnostic(d))
+	}
+
+	// programs that do not parse are neither expanded nor compiled, and
+	// those failing to expand are not compiled
+	compile := len(diagnostics) == 0
+	if compile {
+		macros := object.NewEnvironment()
+		eval.DefineMacros(program, macros)
+		if err := eval.ExpandMacros(program, macros); err != nil {
+			diagnostics = append(diagnostics, compilerDiagnostics(err, nil)...)
+			compile = false
+		}
+	}
+
+	doc := &document{analysis: analyze(program)}
+	s.documents[uri] = doc
+
+	if compile {
+		if err := compiler.New().Compile(program); err != nil {
+			diagnostics = append(diagnostics, compilerDiagnostics(err, doc.analysis)...)
+		}
+	}
+
+	s.publish(uri, diagnostics)
+}
+
+// document decodes the params of a request on a document, and returns the
+// document
+func (s *Server) document(m *message, params any, id *textDocumentIdentifier) (*document, *responseError) {
+	if err := json.Unmarshal(m.Params, params); err != nil {
+		return nil, &responseError{invalidParams, err.Error()}
+	}
+
+	doc, ok := s.documents[id.URI]
+	if !ok {
+		return nil, &responseError{invalidParams, fmt.Sprintf("unknown document %s", id.URI)}
+	}
+	return doc, nil
+}
+
+func (s *Server) publish(uri string, diagnostics []diagnostic) {
+	s.write(&notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  publishDiagnosticsParams{URI: uri, Diagnostics: diagnostics},
+	})
+}
+
+// write writes a message. Errors writing are those of the stream, and are
+// found again reading the next message.
+func (s *Server) write(message any) {
+	writeMessage(s.out, message)
+}
+
+// convertDiagnostic converts a diagnostic of the parser or the compiler,
+// whose positions start at 1
+func convertDiagnostic(d *diag.Diagnostic) diagnostic {
+	convert := func(p diag.Position) position {
+		return position{Line: max(p.Line-1, 0), Character: max(p.Column-1, 0)}
+	}
+
+	return diagnostic{
+		Range:    textRange{Start: convert(d.Start), End: convert(d.End)},
+		Severity: errorSeverity,
+		Code:     d.Code,
+		Source:   "monkey",
+		Message:  d.Message,
+	}
+}
+
+// compilerDiagnostics returns the diagnostics of a compiler error. The
+// compiler stops at the first undefined variable, the first one found
+// resolving the program, so every undefined variable is reported.
+func compilerDiagnostics(err error, a *analysis) []diagnostic {
+	d, ok := err.(*diag.Diagnostic)
+	if !ok {
+		return []diagnostic{{Severity: errorSeverity, Source: "monkey", Message: err.Error()}}
+	}
+	if d.Code != diag.UndefinedVariable || a == nil || len(a.undefined) == 0 {
+		return []diagnostic{convertDiagnostic(d)}
+	}
+
+	diagnostics := make([]diagnostic, len(a.undefined))
+	for i, ident := range a.undefined {
+		diagnostics[i] = diagnostic{
+			Range:    identRange(ident),
+			Severity: errorSeverity,
+			Code:     diag.UndefinedVariable,
+			Source:   "monkey",
+			Message:  "undefined variable " + ident.Value,
+		}
+	}
+	return diagnostics
+}
+
+// describe returns the hover of a definition, in Markdown
+func describe(def *definition) string {
+	var signature, description string
+
+	switch def.kind {
+	case builtinDefinition:
+		signature = def.name
+		if b, ok := builtins[def.name]; ok {
+			signature, description = b.signature, b.description
+		}
+	case parameterDefinition:
+		signature = "(parameter) " + def.name
+	default:
+		signature = "let " + def.name
+		if fn, ok := def.function(); ok {
+			signature += " = " + functionSignature(fn)
+		}
+	}
+
+	value := "```monkey\n" + signature + "\n```"
+	if description != "" {
+		value += "\n" + description
+	}
+	return value
+}
+
+func functionSignature(fn *ast.FunctionLiteral) string {
+	params := make([]string, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		params[i] = p.Value
+	}
+	return "fn(" + strings.Join(params, ", ") + ")"
+}
+
+// symbols returns the symbols of the let statements defined in the value
+// of parent, or at the top level when it is nil
+func symbols(a *analysis, parent *definition) []documentSymbol {
+	result := []documentSymbol{}
+
+	for _, def := range a.definitions {
+		if def.kind != letDefinition || def.parent != parent {
+			continue
+		}
+
+		symbol := documentSymbol{
+			Name:           def.name,
+			Kind:           variableSymbol,
+			Range:          identRange(def.ident),
+			SelectionRange: identRange(def.ident),
+			Children:       symbols(a, def),
+		}
+		if fn, ok := def.function(); ok {
+			symbol.Kind = functionSymbol
+			symbol.Detail = functionSignature(fn)
+		}
+		// the range spans from the let keyword to the name
+		let := def.statement.Token
+		symbol.Range.Start = position{Line: let.Line - 1, Character: let.Column - 1}
+
+		result = append(result, symbol)
+	}
+
+	return result
+}
+
+// completions returns the keywords, the builtins and the names defined in
+// the document
+func completions(a *analysis) []completionItem {
+	items := []completionItem{}
+	seen := map[string]bool{}
+
+	for _, keyword := range keywords {
+		items = append(items, completionItem{Label: keyword, Kind: keywordCompletion})
+		seen[keyword] = true
+	}
+
+	for _, def := range a.builtins {
+		items = append(items, completionItem{Label: def.name, Kind: functionCompletion, Detail: builtins[def.name].signature})
+		seen[def.name] = true
+	}
+
+	var names []completionItem
+	for _, def := range a.definitions {
+		if seen[def.name] {
+			continue
+		}
+		seen[def.name] = true
+
+		item := completionItem{Label: def.name, Kind: variableCompletion}
+		if fn, ok := def.function(); ok {
+			item.Kind = functionCompletion
+			item.Detail = functionSignature(fn)
+		}
+		names = append(names, item)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i].Label < names[j].Label })
+
+	return append(items, names...)
+}
@@ -0,0 +1,442 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+)
+
+const uri = "file:///script.monkey"
+
+const analyzedInput = `let add = fn(a, b) {
+  let sum = a + b;
+  sum
+};
+let makeAdder = fn(x) {
+  fn(y) { add(x, y) }
+};
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let x = makeAdder(2)(len([1]));
+x
+`
+
+// client is a scripted LSP client of a server
+type client struct {
+	t        *testing.T
+	in       *io.PipeWriter
+	messages chan map[string]any
+	id       int
+	done     chan error
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{t: t, in: clientOut, messages: make(chan map[string]any, 100), done: make(chan error, 1)}
+
+	go func() {
+		c.done <- NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+	}()
+
+	go func() {
+		r := bufio.NewReader(clientIn)
+		for {
+			header, err := textproto.NewReader(r).ReadMIMEHeader()
+			if err != nil {
+				close(c.messages)
+				return
+			}
+			length, _ := strconv.Atoi(header.Get("Content-Length"))
+			content := make([]byte, length)
+			if _, err := io.ReadFull(r, content); err != nil {
+				close(c.messages)
+				return
+			}
+
+			var message map[string]any
+			if err := json.Unmarshal(content, &message); err != nil {
+				t.Errorf("invalid message %q: %s", content, err)
+			}
+			c.messages <- message
+		}
+	}()
+
+	result := c.request("initialize", map[string]any{"capabilities": map[string]any{}})
+	capabilities := result.(map[string]any)["capabilities"].(map[string]any)
+	for _, capability := range []string{"definitionProvider", "referencesProvider", "hoverProvider", "documentSymbolProvider"} {
+		if capabilities[capability] != true {
+			t.Errorf("capability %s not supported", capability)
+		}
+	}
+	c.notify("initialized", map[string]any{})
+
+	return c
+}
+
+// request sends a request and returns its result, failing the test when
+// it does not succeed
+func (c *client) request(method string, params any) any {
+	c.t.Helper()
+
+	response := c.send(method, params)
+	if response["error"] != nil {
+		c.t.Fatalf("request %s failed: %v", method, response["error"])
+	}
+	return response["result"]
+}
+
+// send sends a request and returns its response
+func (c *client) send(method string, params any) map[string]any {
+	c.t.Helper()
+
+	c.id++
+	err := writeMessage(c.in, map[string]any{"jsonrpc": "2.0", "id": c.id, "method": method, "params": params})
+	if err != nil {
+		c.t.Fatalf("error sending %s: %s", method, err)
+	}
+
+	response := c.next()
+	if response["id"] != float64(c.id) {
+		c.t.Fatalf("expected the response to %s, got %v", method, response)
+	}
+	return response
+}
+
+func (c *client) notify(method string, params any) {
+	c.t.Helper()
+
+	err := writeMessage(c.in, map[string]any{"jsonrpc": "2.0", "method": method, "params": params})
+	if err != nil {
+		c.t.Fatalf("error sending %s: %s", method, err)
+	}
+}
+
+func (c *client) next() map[string]any {
+	c.t.Helper()
+
+	message, ok := <-c.messages
+	if !ok {
+		c.t.Fatalf("expected a message, got the end of the stream")
+	}
+	return message
+}
+
+// diagnostics returns the next diagnostics published, as line:character
+// message
+func (c *client) diagnostics() []string {
+	c.t.Helper()
+
+	message := c.next()
+	if message["method"] != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %v", message)
+	}
+
+	var diagnostics []string
+	for _, d := range message["params"].(map[string]any)["diagnostics"].([]any) {
+		d := d.(map[string]any)
+		diagnostics = append(diagnostics, describePosition(d["range"].(map[string]any)["start"])+" "+d["message"].(string))
+	}
+	return diagnostics
+}
+
+func (c *client) open(text string) []string {
+	c.t.Helper()
+
+	c.notify("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uri, "languageId": "monkey", "version": 1, "text": text},
+	})
+	return c.diagnostics()
+}
+
+func (c *client) close() {
+	c.t.Helper()
+
+	c.request("shutdown", nil)
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		c.t.Errorf("server failed: %s", err)
+	}
+}
+
+func positionParams(line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     map[string]any{"line": line, "character": character},
+	}
+}
+
+func describePosition(position any) string {
+	p := position.(map[string]any)
+	return fmt.Sprintf("%d:%d", int(p["line"].(float64)), int(p["character"].(float64)))
+}
+
+func describeLocation(location any) string {
+	if location == nil {
+		return "none"
+	}
+	return describePosition(location.(map[string]any)["range"].(map[string]any)["start"])
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x = 1;\nx + y;\nfn() { z }", []string{"1:4 undefined variable y", "2:7 undefined variable z"}},
+		{"let x 1;\nlet y = 2;", []string{"0:6 expected =, got INT instead"}},
+		{"let f = fn(a { a };", []string{"0:13 expected ), got { instead"}},
+		{analyzedInput, nil},
+		{"let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) };\nunless(1 > 2, 1, 2)", nil},
+		{"let m = macro(a) { quote(a) };\nm(1, 2)", []string{"1:0 wrong number of arguments to macro m: want=1, got=2"}},
+	}
+
+	for _, tt := range tests {
+		c := newClient(t)
+
+		diagnostics := c.open(tt.input)
+		if strings.Join(diagnostics, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong diagnostics for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, diagnostics)
+		}
+
+		c.notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": 2},
+			"contentChanges": []any{map[string]any{"text": "let x = 1;\nx"}},
+		})
+		if diagnostics := c.diagnostics(); len(diagnostics) != 0 {
+			t.Errorf("diagnostics after fixing %q: %q", tt.input, diagnostics)
+		}
+
+		c.notify("textDocument/didClose", map[string]any{"textDocument": map[string]any{"uri": uri}})
+		if diagnostics := c.diagnostics(); len(diagnostics) != 0 {
+			t.Errorf("diagnostics after closing: %q", diagnostics)
+		}
+
+		c.close()
+	}
+}
+
+func TestPartialDocuments(t *testing.T) {
+	c := newClient(t)
+
+	// statements failing to parse are skipped, and the others analyzed
+	diagnostics := c.open("let add = fn(a, b) { a + };\nlet twice = fn(f) {\n  let y = ;\n  f(f(1))\n};\ntwice(add")
+	expected := []string{"0:25 unexpected } found", "2:10 unexpected ; found", "5:9 expected ), got EOF instead"}
+	if strings.Join(diagnostics, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong diagnostics.\nwant=%q\ngot=%q", expected, diagnostics)
+	}
+
+	symbols := c.request("textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": uri}}).([]any)
+	var names []string
+	for _, s := range symbols {
+		names = append(names, s.(map[string]any)["name"].(string))
+	}
+	if strings.Join(names, " ") != "add twice" {
+		t.Errorf("wrong symbols. got=%q", names)
+	}
+
+	location := c.request("textDocument/definition", positionParams(3, 4))
+	if got := describeLocation(location); got != "1:15" {
+		t.Errorf("wrong definition. want=1:15, got=%s", got)
+	}
+
+	c.close()
+}
+
+func TestDefinition(t *testing.T) {
+	c := newClient(t)
+	c.open(analyzedInput)
+
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{2, 3, "1:6"},   // local
+		{5, 10, "0:4"},  // global
+		{5, 14, "4:19"}, // free variable
+		{5, 17, "5:5"},  // parameter
+		{7, 42, "7:4"},  // recursive function
+		{9, 0, "8:4"},   // global shadowing a parameter
+		{8, 21, "none"}, // builtin
+		{3, 0, "none"},  // no identifier
+	}
+
+	for _, tt := range tests {
+		location := c.request("textDocument/definition", positionParams(tt.line, tt.character))
+		if got := describeLocation(location); got != tt.expected {
+			t.Errorf("wrong definition at %d:%d. want=%s, got=%s", tt.line, tt.character, tt.expected, got)
+		}
+	}
+
+	c.close()
+}
+
+func TestReferences(t *testing.T) {
+	c := newClient(t)
+	c.open(analyzedInput)
+
+	tests := []struct {
+		line, character    int
+		includeDeclaration bool
+		expected           []string
+	}{
+		{0, 5, true, []string{"0:4", "5:10"}},
+		{7, 13, true, []string{"7:13", "7:22", "7:31", "7:46", "7:59"}},
+		{4, 19, true, []string{"4:19", "5:14"}},
+		{9, 0, false, []string{"9:0"}},
+		{8, 21, true, []string{"8:21"}},
+		{3, 0, true, nil},
+	}
+
+	for _, tt := range tests {
+		params := positionParams(tt.line, tt.character)
+		params["context"] = map[string]any{"includeDeclaration": tt.includeDeclaration}
+
+		var got []string
+		for _, location := range c.request("textDocument/references", params).([]any) {
+			got = append(got, describeLocation(location))
+		}
+		if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("wrong references at %d:%d. want=%v, got=%v", tt.line, tt.character, tt.expected, got)
+		}
+	}
+
+	c.close()
+}
+
+func TestHover(t *testing.T) {
+	c := newClient(t)
+	c.open(analyzedInput)
+
+	tests := []struct {
+		line, character int
+		expected        string
+	}{
+		{8, 22, "```monkey\nlen(value)\n```\nReturns the length of a string or an array."},
+		{5, 11, "```monkey\nlet add = fn(a, b)\n```"},
+		{9, 1, "```monkey\nlet x\n```"},
+		{1, 12, "```monkey\n(parameter) a\n```"},
+	}
+
+	for _, tt := range tests {
+		hover := c.request("textDocument/hover", positionParams(tt.line, tt.character)).(map[string]any)
+		if got := hover["contents"].(map[string]any)["value"]; got != tt.expected {
+			t.Errorf("wrong hover at %d:%d. want=%q, got=%q", tt.line, tt.character, tt.expected, got)
+		}
+	}
+
+	if hover := c.request("textDocument/hover", positionParams(3, 0)); hover != nil {
+		t.Errorf("hover with no identifier: %v", hover)
+	}
+
+	c.close()
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	c := newClient(t)
+	c.open(analyzedInput)
+
+	var describe func(symbols []any) string
+	describe = func(symbols []any) string {
+		var names []string
+		for _, s := range symbols {
+			s := s.(map[string]any)
+			name := fmt.Sprintf("%s:%v@%s", s["name"], s["kind"], describePosition(s["range"].(map[string]any)["start"]))
+			if children, ok := s["children"].([]any); ok {
+				name += "[" + describe(children) + "]"
+			}
+			names = append(names, name)
+		}
+		return strings.Join(names, " ")
+	}
+
+	symbols := c.request("textDocument/documentSymbol", map[string]any{"textDocument": map[string]any{"uri": uri}}).([]any)
+	expected := "add:12@0:0[sum:13@1:2] makeAdder:12@4:0 fib:12@7:0 x:13@8:0"
+	if got := describe(symbols); got != expected {
+		t.Errorf("wrong symbols.\nwant=%s\ngot=%s", expected, got)
+	}
+
+	c.close()
+}
+
+func TestCompletion(t *testing.T) {
+	c := newClient(t)
+	c.open(analyzedInput)
+
+	labels := map[string]float64{}
+	for _, item := range c.request("textDocument/completion", positionParams(9, 1)).([]any) {
+		item := item.(map[string]any)
+		if _, ok := labels[item["label"].(string)]; ok {
+			t.Errorf("duplicate completion %s", item["label"])
+		}
+		labels[item["label"].(string)] = item["kind"].(float64)
+	}
+
+	expected := map[string]float64{
+		"let": keywordCompletion, "fn": keywordCompletion, "return": keywordCompletion,
+		"len": functionCompletion, "spawn": functionCompletion,
+		"add": functionCompletion, "sum": variableCompletion, "a": variableCompletion, "x": variableCompletion,
+	}
+	for label, kind := range expected {
+		if labels[label] != kind {
+			t.Errorf("wrong completion %s. want kind=%v, got=%v", label, kind, labels[label])
+		}
+	}
+
+	c.close()
+}
+
+func TestInvalidRequests(t *testing.T) {
+	c := newClient(t)
+
+	tests := []struct {
+		method string
+		params any
+		code   float64
+	}{
+		{"textDocument/hover", positionParams(0, 0), invalidParams},
+		{"textDocument/definition", "invalid", invalidParams},
+		{"workspace/symbol", nil, methodNotFound},
+	}
+
+	for _, tt := range tests {
+		response := c.send(tt.method, tt.params)
+		responseError, ok := response["error"].(map[string]any)
+		if !ok || responseError["code"] != tt.code {
+			t.Errorf("wrong response to %s. got=%v", tt.method, response)
+		}
+	}
+
+	c.request("shutdown", nil)
+	if response := c.send("textDocument/hover", positionParams(0, 0)); response["error"].(map[string]any)["code"] != float64(invalidRequest) {
+		t.Errorf("request after shutdown did not fail: %v", response)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("server failed: %s", err)
+	}
+
+	c = newClient(t)
+	c.notify("exit", nil)
+	if err := <-c.done; err == nil {
+		t.Errorf("exit before shutdown did not fail")
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	for _, b := range object.Builtins {
+		if _, ok := builtins[b.Name]; !ok {
+			t.Errorf("builtin %s is not documented", b.Name)
+		}
+	}
+}
@@ -12,3 +12,10 @@ func (*Boolean) Type() Type { return BOOLEAN_OBJ }
 
 // Inspect inspect
 func (b *Boolean) Inspect() string { return fmt.Sprintf("%t", b.Value) }
+
+var (
+	// TRUE is the true object shared by all the engines
+	TRUE = &Boolean{Value: true}
+	// FALSE is the false object shared by all the engines
+	FALSE = &Boolean{Value: false}
+)
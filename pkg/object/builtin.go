@@ -1,7 +1,18 @@
 package object
 
+// ExecutionContext gives builtins access to the engine running them
+type ExecutionContext interface {
+	// Call calls a function, closure or builtin with the given arguments
+	Call(fn Object, args ...Object) (Object, error)
+	// IO returns the streams builtins must read from and write to
+	IO() *IO
+	// Fork returns an independent context, sharing the globals, that can
+	// run concurrently with this one
+	Fork() ExecutionContext
+}
+
 // BuiltinFunction builtin function
-type BuiltinFunction func(args ...Object) (Object, error)
+type BuiltinFunction func(ctx ExecutionContext, args ...Object) (Object, error)
 
 // Builtin builtin
 type Builtin struct {
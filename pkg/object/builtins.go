@@ -2,6 +2,8 @@ package object
 
 import (
 	"fmt"
+	"io"
+	"sort"
 )
 
 // Builtins builtins
@@ -12,16 +14,16 @@ var Builtins = []struct {
 	{
 		"len",
 		&Builtin{
-			Fn: func(args ...Object) (Object, error) {
+			Fn: func(_ ExecutionContext, args ...Object) (Object, error) {
 				if len(args) != 1 {
 					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=1", len(args))
 				}
 
 				switch arg := args[0].(type) {
 				case *String:
-					return &Integer{Value: int64(len(arg.Value))}, nil
+					return NewInteger(int64(len(arg.Value))), nil
 				case *Array:
-					return &Integer{Value: int64(len(arg.Elements))}, nil
+					return NewInteger(int64(len(arg.Elements))), nil
 				default:
 					return nil, fmt.Errorf("argument to `len` not supported, got %s", args[0].Type())
 				}
@@ -31,9 +33,9 @@ var Builtins = []struct {
 	{
 		"puts",
 		&Builtin{
-			Fn: func(args ...Object) (Object, error) {
+			Fn: func(ctx ExecutionContext, args ...Object) (Object, error) {
 				for _, arg := range args {
-					_, err := fmt.Println(arg.Inspect())
+					_, err := fmt.Fprintln(ctx.IO().Out, arg.Inspect())
 					if err != nil {
 						return nil, err
 					}
@@ -45,7 +47,7 @@ var Builtins = []struct {
 	{
 		"first",
 		&Builtin{
-			Fn: func(args ...Object) (Object, error) {
+			Fn: func(_ ExecutionContext, args ...Object) (Object, error) {
 				if len(args) != 1 {
 					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=1", len(args))
 				}
@@ -71,7 +73,7 @@ var Builtins = []struct {
 	{
 		"last",
 		&Builtin{
-			Fn: func(args ...Object) (Object, error) {
+			Fn: func(_ ExecutionContext, args ...Object) (Object, error) {
 				if len(args) != 1 {
 					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=1", len(args))
 				}
@@ -99,7 +101,7 @@ var Builtins = []struct {
 	{
 		"rest",
 		&Builtin{
-			Fn: func(args ...Object) (Object, error) {
+			Fn: func(_ ExecutionContext, args ...Object) (Object, error) {
 				if len(args) != 1 {
 					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=1", len(args))
 				}
@@ -129,7 +131,7 @@ var Builtins = []struct {
 	{
 		"push",
 		&Builtin{
-			Fn: func(args ...Object) (Object, error) {
+			Fn: func(_ ExecutionContext, args ...Object) (Object, error) {
 				if len(args) != 2 {
 					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=2", len(args))
 				}
@@ -154,6 +156,315 @@ var Builtins = []struct {
 			},
 		},
 	},
+	{
+		"map",
+		&Builtin{
+			Fn: func(ctx ExecutionContext, args ...Object) (Object, error) {
+				arr, err := arrayAndFunctionArgs("map", args)
+				if err != nil {
+					return nil, err
+				}
+
+				newElements := make([]Object, len(arr.Elements))
+				for i, e := range arr.Elements {
+					result, err := ctx.Call(args[1], e)
+					if err != nil {
+						return nil, err
+					}
+					newElements[i] = result
+				}
+
+				return &Array{Elements: newElements}, nil
+			},
+		},
+	},
+	{
+		"filter",
+		&Builtin{
+			Fn: func(ctx ExecutionContext, args ...Object) (Object, error) {
+				arr, err := arrayAndFunctionArgs("filter", args)
+				if err != nil {
+					return nil, err
+				}
+
+				newElements := []Object{}
+				for _, e := range arr.Elements {
+					result, err := ctx.Call(args[1], e)
+					if err != nil {
+						return nil, err
+					}
+					if isTruthy(result) {
+						newElements = append(newElements, e)
+					}
+				}
+
+				return &Array{Elements: newElements}, nil
+			},
+		},
+	},
+	{
+		"reduce",
+		&Builtin{
+			Fn: func(ctx ExecutionContext, args ...Object) (Object, error) {
+				if len(args) != 3 {
+					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=3", len(args))
+				}
+
+				arr, err := arrayAndFunctionArgs("reduce", []Object{args[0], args[2]})
+				if err != nil {
+					return nil, err
+				}
+
+				accumulator := args[1]
+				for _, e := range arr.Elements {
+					accumulator, err = ctx.Call(args[2], accumulator, e)
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				return accumulator, nil
+			},
+		},
+	},
+	{
+		"each",
+		&Builtin{
+			Fn: func(ctx ExecutionContext, args ...Object) (Object, error) {
+				arr, err := arrayAndFunctionArgs("each", args)
+				if err != nil {
+					return nil, err
+				}
+
+				for _, e := range arr.Elements {
+					_, err := ctx.Call(args[1], e)
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				return nil, nil
+			},
+		},
+	},
+	{
+		"sort_by",
+		&Builtin{
+			Fn: func(ctx ExecutionContext, args ...Object) (Object, error) {
+				arr, err := arrayAndFunctionArgs("sort_by", args)
+				if err != nil {
+					return nil, err
+				}
+
+				keys := make([]Object, len(arr.Elements))
+				for i, e := range arr.Elements {
+					keys[i], err = ctx.Call(args[1], e)
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				return sortByKeys(arr.Elements, keys)
+			},
+		},
+	},
+	{
+		"print",
+		&Builtin{
+			Fn: func(ctx ExecutionContext, args ...Object) (Object, error) {
+				return nil, write(ctx.IO().Out, args)
+			},
+		},
+	},
+	{
+		"eprint",
+		&Builtin{
+			Fn: func(ctx ExecutionContext, args ...Object) (Object, error) {
+				return nil, write(ctx.IO().Err, args)
+			},
+		},
+	},
+	{
+		"read_line",
+		&Builtin{
+			Fn: func(ctx ExecutionContext, args ...Object) (Object, error) {
+				if len(args) != 0 {
+					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=0", len(args))
+				}
+
+				line, ok, err := ctx.IO().ReadLine()
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					// null signals the end of the input
+					return nil, nil
+				}
+
+				return &String{Value: line}, nil
+			},
+		},
+	},
+	{
+		"read_all",
+		&Builtin{
+			Fn: func(ctx ExecutionContext, args ...Object) (Object, error) {
+				if len(args) != 0 {
+					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=0", len(args))
+				}
+
+				content, err := ctx.IO().ReadAll()
+				if err != nil {
+					return nil, err
+				}
+
+				return &String{Value: content}, nil
+			},
+		},
+	},
+	{
+		"spawn",
+		&Builtin{
+			Fn: func(ctx ExecutionContext, args ...Object) (Object, error) {
+				if len(args) < 1 {
+					return nil, fmt.Errorf("wrong number of arguments. got=%d, want>=1", len(args))
+				}
+
+				if !isCallable(args[0]) {
+					return nil, fmt.Errorf("argument to `spawn` must be a function, got %s", args[0].Type())
+				}
+
+				spawnArgs := make([]Object, len(args)-1)
+				copy(spawnArgs, args[1:])
+
+				return Spawn(ctx, args[0], spawnArgs), nil
+			},
+		},
+	},
+	{
+		"wait",
+		&Builtin{
+			Fn: func(_ ExecutionContext, args ...Object) (Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				switch arg := args[0].(type) {
+				case *Task:
+					return arg.Wait()
+				case *Array:
+					return waitAll(arg)
+				default:
+					return nil, fmt.Errorf("argument to `wait` must be TASK or ARRAY, got %s", args[0].Type())
+				}
+			},
+		},
+	},
+	{
+		"chan",
+		&Builtin{
+			Fn: func(_ ExecutionContext, args ...Object) (Object, error) {
+				if len(args) > 1 {
+					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=0 or 1", len(args))
+				}
+
+				size := int64(0)
+				if len(args) == 1 {
+					integer, ok := args[0].(*Integer)
+					if !ok || integer.Value < 0 {
+						return nil, fmt.Errorf("argument to `chan` must be a non-negative INTEGER, got %s", args[0].Inspect())
+					}
+					size = integer.Value
+				}
+
+				return NewChannel(int(size)), nil
+			},
+		},
+	},
+	{
+		"send",
+		&Builtin{
+			Fn: func(_ ExecutionContext, args ...Object) (Object, error) {
+				if len(args) != 2 {
+					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=2", len(args))
+				}
+
+				ch, err := channelArg("send", args[0])
+				if err != nil {
+					return nil, err
+				}
+
+				return nil, ch.Send(args[1])
+			},
+		},
+	},
+	{
+		"recv",
+		&Builtin{
+			Fn: func(_ ExecutionContext, args ...Object) (Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				ch, err := channelArg("recv", args[0])
+				if err != nil {
+					return nil, err
+				}
+
+				value, _ := ch.Receive()
+
+				return value, nil
+			},
+		},
+	},
+	{
+		"close",
+		&Builtin{
+			Fn: func(_ ExecutionContext, args ...Object) (Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				ch, err := channelArg("close", args[0])
+				if err != nil {
+					return nil, err
+				}
+
+				return nil, ch.Close()
+			},
+		},
+	},
+	{
+		"select",
+		&Builtin{
+			Fn: func(_ ExecutionContext, args ...Object) (Object, error) {
+				if len(args) != 1 {
+					return nil, fmt.Errorf("wrong number of arguments. got=%d, want=1", len(args))
+				}
+
+				arr, ok := args[0].(*Array)
+				if !ok || len(arr.Elements) == 0 {
+					return nil, fmt.Errorf("argument to `select` must be a non-empty ARRAY of channels, got %s", args[0].Inspect())
+				}
+
+				channels := make([]*Channel, len(arr.Elements))
+				for i, e := range arr.Elements {
+					ch, err := channelArg("select", e)
+					if err != nil {
+						return nil, err
+					}
+					channels[i] = ch
+				}
+
+				index, value, ok := Select(channels)
+				if !ok {
+					value = NULL
+				}
+
+				return &Array{Elements: []Object{NewInteger(int64(index)), value}}, nil
+			},
+		},
+	},
 }
 
 // GetBuiltinByName get builtin by name
@@ -165,3 +476,126 @@ func GetBuiltinByName(name string) *Builtin {
 	}
 	return nil
 }
+
+// arrayAndFunctionArgs validates the arguments of the higher-order builtins,
+// which take an array and a function to call on its elements
+func arrayAndFunctionArgs(name string, args []Object) (*Array, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("wrong number of arguments. got=%d, want=2", len(args))
+	}
+
+	arr, ok := args[0].(*Array)
+	if !ok {
+		return nil, fmt.Errorf("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+
+	if !isCallable(args[1]) {
+		return nil, fmt.Errorf("second argument to `%s` must be a function, got %s", name, args[1].Type())
+	}
+
+	return arr, nil
+}
+
+func isCallable(obj Object) bool {
+	switch obj.Type() {
+	case FUNCTION_OBJ, CLOSURE_OBJ, BUILTIN_OBJ:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTruthy reports whether a callback result counts as true: only null and
+// false are falsy
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case nil, *Null:
+		return false
+	case *Boolean:
+		return obj.Value
+	default:
+		return true
+	}
+}
+
+// sortByKeys returns a new array with the elements sorted by their keys, which
+// must be all integers or all strings. The sort is stable.
+func sortByKeys(elements, keys []Object) (Object, error) {
+	indexes := make([]int, len(elements))
+	for i := range indexes {
+		indexes[i] = i
+	}
+
+	var less func(a, b int) bool
+
+	if len(keys) > 0 {
+		keyType := keys[0].Type()
+		for _, k := range keys {
+			if k.Type() != keyType || (keyType != INTEGER_OBJ && keyType != STRING_OBJ) {
+				return nil, fmt.Errorf("`sort_by` keys must be all INTEGER or all STRING, got %s", k.Type())
+			}
+		}
+
+		if keyType == INTEGER_OBJ {
+			less = func(a, b int) bool { return keys[a].(*Integer).Value < keys[b].(*Integer).Value }
+		} else {
+			less = func(a, b int) bool { return keys[a].(*String).Value < keys[b].(*String).Value }
+		}
+	}
+
+	sort.SliceStable(indexes, func(i, j int) bool { return less(indexes[i], indexes[j]) })
+
+	sorted := make([]Object, len(elements))
+	for i, index := range indexes {
+		sorted[i] = elements[index]
+	}
+
+	return &Array{Elements: sorted}, nil
+}
+
+// write writes the arguments to out without any separator
+func write(out io.Writer, args []Object) error {
+	for _, arg := range args {
+		_, err := io.WriteString(out, arg.Inspect())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func channelArg(name string, arg Object) (*Channel, error) {
+	ch, ok := arg.(*Channel)
+	if !ok {
+		return nil, fmt.Errorf("argument to `%s` must be CHANNEL, got %s", name, arg.Type())
+	}
+
+	return ch, nil
+}
+
+// waitAll waits for all the tasks in the array to finish. When several of them
+// fail, the error of the first one in the array is reported.
+func waitAll(tasks *Array) (Object, error) {
+	results := make([]Object, len(tasks.Elements))
+	var firstErr error
+
+	for i, e := range tasks.Elements {
+		task, ok := e.(*Task)
+		if !ok {
+			return nil, fmt.Errorf("argument to `wait` must be an ARRAY of tasks, got %s", e.Type())
+		}
+
+		result, err := task.Wait()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		results[i] = result
+	}
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	return &Array{Elements: results}, nil
+}
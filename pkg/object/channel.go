@@ -0,0 +1,71 @@
+package object
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Channel is a Go channel of objects, used to communicate between tasks
+type Channel struct {
+	ch chan Object
+}
+
+// NewChannel creates a channel with the given buffer size
+func NewChannel(size int) *Channel {
+	return &Channel{ch: make(chan Object, size)}
+}
+
+// Type type
+func (*Channel) Type() Type { return CHANNEL_OBJ }
+
+// Inspect inspect
+func (c *Channel) Inspect() string { return fmt.Sprintf("Channel[%p]", c) }
+
+// Send sends a value, blocking until there is room for it
+func (c *Channel) Send(value Object) (err error) {
+	defer func() {
+		if recover() != nil {
+			err = fmt.Errorf("send on closed channel")
+		}
+	}()
+
+	c.ch <- value
+
+	return nil
+}
+
+// Receive receives a value, blocking until one is available. ok is false when
+// the channel is closed and drained.
+func (c *Channel) Receive() (value Object, ok bool) {
+	value, ok = <-c.ch
+	return value, ok
+}
+
+// Close closes the channel
+func (c *Channel) Close() (err error) {
+	defer func() {
+		if recover() != nil {
+			err = fmt.Errorf("close of closed channel")
+		}
+	}()
+
+	close(c.ch)
+
+	return nil
+}
+
+// Select blocks until one of the channels can receive, and returns its index
+// and the received value. ok is false when that channel is closed.
+func Select(channels []*Channel) (index int, value Object, ok bool) {
+	cases := make([]reflect.SelectCase, len(channels))
+	for i, c := range channels {
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.ch)}
+	}
+
+	index, received, ok := reflect.Select(cases)
+	if ok {
+		value = received.Interface().(Object)
+	}
+
+	return index, value, ok
+}
@@ -11,6 +11,16 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	// Name is the name the function literal was bound to by a let, if any
+	Name string
+	// Line is the line the function literal starts at
+	Line int
+	// SourceMap maps the instructions to the source they were compiled from
+	SourceMap code.SourceMap
+	// LocalNames and FreeNames are the names of the locals and of the free
+	// variables of the function, by index
+	LocalNames []string
+	FreeNames  []string
 }
 
 // Type type
@@ -0,0 +1,367 @@
+package object
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// tagName is the struct tag used to customize how struct fields are converted.
+// It follows the encoding/json conventions: `monkey:"name,omitempty"` renames
+// the field and skips it when empty, `monkey:"-"` ignores it.
+const tagName = "monkey"
+
+var objectType = reflect.TypeOf((*Object)(nil)).Elem()
+
+// FromGo converts a native Go value into a Monkey object.
+//
+// Supported values are nil, booleans, integers, strings, slices and arrays,
+// structs and pointers to any of them. Monkey has no hashes, so structs become
+// arrays of [name, value] pairs, and maps are not supported. Values that
+// already are objects are returned untouched.
+func FromGo(value any) (Object, error) {
+	if value == nil {
+		return NULL, nil
+	}
+
+	return fromGoValue(reflect.ValueOf(value))
+}
+
+// ToGo converts a Monkey object into its natural Go representation: int64,
+// string, bool, nil and []any for arrays.
+func ToGo(obj Object) (any, error) {
+	switch obj := obj.(type) {
+	case nil, *Null:
+		return nil, nil
+	case *Integer:
+		return obj.Value, nil
+	case *String:
+		return obj.Value, nil
+	case *Boolean:
+		return obj.Value, nil
+	case *Array:
+		elements := make([]any, len(obj.Elements))
+		for i, e := range obj.Elements {
+			value, err := ToGo(e)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = value
+		}
+		return elements, nil
+	default:
+		return nil, fmt.Errorf("cannot convert %s to a Go value", obj.Type())
+	}
+}
+
+// ToGoInto converts a Monkey object into the Go value pointed to by target.
+func ToGoInto(obj Object, target any) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("target must be a non-nil pointer, got %T", target)
+	}
+
+	return toGoValue(obj, rv.Elem())
+}
+
+// ToGoAs converts a Monkey object into a Go value of type T.
+func ToGoAs[T any](obj Object) (T, error) {
+	var result T
+
+	err := ToGoInto(obj, &result)
+
+	return result, err
+}
+
+// FromGoSlice converts a slice of Go values into a Monkey array.
+func FromGoSlice[T any](values []T) (*Array, error) {
+	elements := make([]Object, len(values))
+	for i, v := range values {
+		obj, err := FromGo(v)
+		if err != nil {
+			return nil, err
+		}
+		elements[i] = obj
+	}
+
+	return &Array{Elements: elements}, nil
+}
+
+func fromGoValue(rv reflect.Value) (Object, error) {
+	if rv.IsValid() && rv.Type().Implements(objectType) {
+		if isNilValue(rv) {
+			return NULL, nil
+		}
+		return rv.Interface().(Object), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Invalid:
+		return NULL, nil
+	case reflect.Bool:
+		if rv.Bool() {
+			return TRUE, nil
+		}
+		return FALSE, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewInteger(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		value := rv.Uint()
+		if value > math.MaxInt64 {
+			return nil, fmt.Errorf("cannot convert %d to INTEGER: value overflows int64", value)
+		}
+		return NewInteger(int64(value)), nil
+	case reflect.String:
+		return &String{Value: rv.String()}, nil
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return NULL, nil
+		}
+		return fromGoValue(rv.Elem())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			return NULL, nil
+		}
+		elements := make([]Object, rv.Len())
+		for i := range elements {
+			obj, err := fromGoValue(rv.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = obj
+		}
+		return &Array{Elements: elements}, nil
+	case reflect.Struct:
+		return fromGoStruct(rv)
+	default:
+		return nil, fmt.Errorf("cannot convert Go type %s to a Monkey object", rv.Type())
+	}
+}
+
+// fromGoStruct converts a struct into an array of [name, value] pairs, in
+// the order of its fields
+func fromGoStruct(rv reflect.Value) (Object, error) {
+	pairs := []Object{}
+
+	for _, field := range structFields(rv.Type()) {
+		value := rv.FieldByIndex(field.index)
+		if field.omitEmpty && value.IsZero() {
+			continue
+		}
+
+		obj, err := fromGoValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.goName, err)
+		}
+
+		pair := []Object{&String{Value: field.name}, obj}
+		pairs = append(pairs, &Array{Elements: pair})
+	}
+
+	return &Array{Elements: pairs}, nil
+}
+
+func toGoValue(obj Object, rv reflect.Value) error {
+	if obj == nil {
+		obj = NULL
+	}
+
+	if rv.Type().Implements(objectType) && reflect.TypeOf(obj).AssignableTo(rv.Type()) {
+		rv.Set(reflect.ValueOf(obj))
+		return nil
+	}
+
+	if _, ok := obj.(*Null); ok {
+		switch rv.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice:
+			rv.SetZero()
+			return nil
+		}
+	}
+
+	switch rv.Kind() {
+	case reflect.Interface:
+		if rv.NumMethod() != 0 {
+			return conversionError(obj, rv.Type())
+		}
+		value, err := ToGo(obj)
+		if err != nil {
+			return err
+		}
+		if value != nil {
+			rv.Set(reflect.ValueOf(value))
+		}
+		return nil
+	case reflect.Pointer:
+		elem := reflect.New(rv.Type().Elem())
+		if err := toGoValue(obj, elem.Elem()); err != nil {
+			return err
+		}
+		rv.Set(elem)
+		return nil
+	case reflect.Bool:
+		b, ok := obj.(*Boolean)
+		if !ok {
+			return conversionError(obj, rv.Type())
+		}
+		rv.SetBool(b.Value)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*Integer)
+		if !ok {
+			return conversionError(obj, rv.Type())
+		}
+		if rv.OverflowInt(i.Value) {
+			return fmt.Errorf("cannot convert %d to %s: value out of range", i.Value, rv.Type())
+		}
+		rv.SetInt(i.Value)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := obj.(*Integer)
+		if !ok {
+			return conversionError(obj, rv.Type())
+		}
+		if i.Value < 0 || rv.OverflowUint(uint64(i.Value)) {
+			return fmt.Errorf("cannot convert %d to %s: value out of range", i.Value, rv.Type())
+		}
+		rv.SetUint(uint64(i.Value))
+		return nil
+	case reflect.String:
+		s, ok := obj.(*String)
+		if !ok {
+			return conversionError(obj, rv.Type())
+		}
+		rv.SetString(s.Value)
+		return nil
+	case reflect.Slice:
+		arr, ok := obj.(*Array)
+		if !ok {
+			return conversionError(obj, rv.Type())
+		}
+		slice := reflect.MakeSlice(rv.Type(), len(arr.Elements), len(arr.Elements))
+		for i, e := range arr.Elements {
+			if err := toGoValue(e, slice.Index(i)); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+		rv.Set(slice)
+		return nil
+	case reflect.Array:
+		arr, ok := obj.(*Array)
+		if !ok {
+			return conversionError(obj, rv.Type())
+		}
+		if len(arr.Elements) != rv.Len() {
+			return fmt.Errorf("cannot convert ARRAY of length %d to %s", len(arr.Elements), rv.Type())
+		}
+		for i, e := range arr.Elements {
+			if err := toGoValue(e, rv.Index(i)); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+		return nil
+	case reflect.Struct:
+		return toGoStruct(obj, rv)
+	default:
+		return fmt.Errorf("cannot convert to unsupported Go type %s", rv.Type())
+	}
+}
+
+// toGoStruct sets the fields of a struct from an array of [name, value]
+// pairs, skipping the pairs whose name matches no field
+func toGoStruct(obj Object, rv reflect.Value) error {
+	arr, ok := obj.(*Array)
+	if !ok {
+		return conversionError(obj, rv.Type())
+	}
+
+	fields := map[string]structField{}
+	for _, field := range structFields(rv.Type()) {
+		fields[field.name] = field
+	}
+
+	for i, e := range arr.Elements {
+		pair, ok := e.(*Array)
+		if !ok || len(pair.Elements) != 2 {
+			return fmt.Errorf("index %d: cannot convert %s to a [name, value] pair", i, e.Inspect())
+		}
+		name, ok := pair.Elements[0].(*String)
+		if !ok {
+			return fmt.Errorf("index %d: cannot convert %s to a field name", i, pair.Elements[0].Type())
+		}
+
+		field, ok := fields[name.Value]
+		if !ok {
+			continue
+		}
+		if err := toGoValue(pair.Elements[1], rv.FieldByIndex(field.index)); err != nil {
+			return fmt.Errorf("field %s: %w", field.goName, err)
+		}
+	}
+
+	return nil
+}
+
+type structField struct {
+	name      string
+	goName    string
+	index     []int
+	omitEmpty bool
+}
+
+func structFields(t reflect.Type) []structField {
+	fields := []structField{}
+
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous || promotedThroughPointer(t, f.Index) {
+			continue
+		}
+
+		tag := f.Tag.Get(tagName)
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+
+		fields = append(fields, structField{
+			name:      name,
+			goName:    f.Name,
+			index:     f.Index,
+			omitEmpty: slices.Contains(strings.Split(options, ","), "omitempty"),
+		})
+	}
+
+	return fields
+}
+
+// promotedThroughPointer reports whether a promoted field is reached through an
+// embedded pointer, which may be nil
+func promotedThroughPointer(t reflect.Type, index []int) bool {
+	for _, i := range index[:len(index)-1] {
+		t = t.Field(i).Type
+		if t.Kind() == reflect.Pointer {
+			return true
+		}
+	}
+
+	return false
+}
+
+func conversionError(obj Object, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %s to Go type %s", obj.Type(), t)
+}
+
+func isNilValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	default:
+		return false
+	}
+}
@@ -0,0 +1,227 @@
+package object
+
+import (
+	"reflect"
+	"testing"
+)
+
+type point struct {
+	X      int    `monkey:"x"`
+	Y      int    `monkey:"y"`
+	Label  string `monkey:"label,omitempty"`
+	Note   string `monkey:"note,string,omitempty"`
+	secret string
+	Skip   bool `monkey:"-"`
+}
+
+func TestFromGo(t *testing.T) {
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{nil, "null"},
+		{5, "5"},
+		{int8(-3), "-3"},
+		{uint16(7), "7"},
+		{"monkey", "monkey"},
+		{true, "true"},
+		{[]int{1, 2, 3}, "[1,2,3]"},
+		{[2]string{"a", "b"}, "[a,b]"},
+		{[]any{1, "two", false, nil}, "[1,two,false,null]"},
+		{point{X: 1, Y: 2}, "[[x,1],[y,2]]"},
+		{&point{X: 1, Y: 2, Label: "p"}, "[[x,1],[y,2],[label,p]]"},
+		{point{X: 1, Y: 2, Note: "n"}, "[[x,1],[y,2],[note,n]]"},
+		{(*point)(nil), "null"},
+		{&Integer{Value: 9}, "9"},
+	}
+
+	for _, tt := range tests {
+		obj, err := FromGo(tt.input)
+		if err != nil {
+			t.Errorf("FromGo(%#v) returned error: %s", tt.input, err)
+			continue
+		}
+
+		if obj.Inspect() != tt.expected {
+			t.Errorf("FromGo(%#v) wrong. want=%q, got=%q", tt.input, tt.expected, obj.Inspect())
+		}
+	}
+}
+
+func TestFromGoSingletons(t *testing.T) {
+	obj, _ := FromGo(true)
+	if obj != TRUE {
+		t.Errorf("FromGo(true) is not TRUE. got=%T (%+v)", obj, obj)
+	}
+
+	obj, _ = FromGo(false)
+	if obj != FALSE {
+		t.Errorf("FromGo(false) is not FALSE. got=%T (%+v)", obj, obj)
+	}
+
+	obj, _ = FromGo(nil)
+	if obj != NULL {
+		t.Errorf("FromGo(nil) is not NULL. got=%T (%+v)", obj, obj)
+	}
+}
+
+func TestFromGoErrors(t *testing.T) {
+	tests := []struct {
+		input    any
+		expected string
+	}{
+		{1.5, "cannot convert Go type float64 to a Monkey object"},
+		{uint64(1 << 63), "cannot convert 9223372036854775808 to INTEGER: value overflows int64"},
+		{map[string]int{"a": 1}, "cannot convert Go type map[string]int to a Monkey object"},
+		{struct{ F func() }{}, "field F: cannot convert Go type func() to a Monkey object"},
+	}
+
+	for _, tt := range tests {
+		_, err := FromGo(tt.input)
+		if err == nil {
+			t.Errorf("FromGo(%#v) expected error", tt.input)
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestToGo(t *testing.T) {
+	tests := []struct {
+		input    Object
+		expected any
+	}{
+		{NULL, nil},
+		{&Integer{Value: 5}, int64(5)},
+		{&String{Value: "monkey"}, "monkey"},
+		{FALSE, false},
+		{
+			&Array{Elements: []Object{&Integer{Value: 1}, &String{Value: "x"}}},
+			[]any{int64(1), "x"},
+		},
+	}
+
+	for _, tt := range tests {
+		value, err := ToGo(tt.input)
+		if err != nil {
+			t.Errorf("ToGo(%s) returned error: %s", tt.input.Inspect(), err)
+			continue
+		}
+
+		if !reflect.DeepEqual(value, tt.expected) {
+			t.Errorf("ToGo(%s) wrong. want=%#v, got=%#v", tt.input.Inspect(), tt.expected, value)
+		}
+	}
+
+	_, err := ToGo(&Builtin{})
+	if err == nil || err.Error() != "cannot convert BUILTIN to a Go value" {
+		t.Errorf("wrong error for BUILTIN. got=%v", err)
+	}
+}
+
+func TestToGoAs(t *testing.T) {
+	ints, err := ToGoAs[[]int](&Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}}})
+	if err != nil {
+		t.Fatalf("ToGoAs[[]int] returned error: %s", err)
+	}
+	if !reflect.DeepEqual(ints, []int{1, 2}) {
+		t.Errorf("ToGoAs[[]int] wrong. got=%#v", ints)
+	}
+
+	original := point{X: 3, Y: 4, Label: "p", Note: "n"}
+	obj, err := FromGo(original)
+	if err != nil {
+		t.Fatalf("FromGo returned error: %s", err)
+	}
+
+	p, err := ToGoAs[point](obj)
+	if err != nil {
+		t.Fatalf("ToGoAs[point] returned error: %s", err)
+	}
+	if p != original {
+		t.Errorf("round trip wrong. want=%+v, got=%+v", original, p)
+	}
+
+	unnamed := &Array{Elements: []Object{&Array{Elements: []Object{&String{Value: "z"}, TRUE}}}}
+	p, err = ToGoAs[point](unnamed)
+	if err != nil || p != (point{}) {
+		t.Errorf("ToGoAs[point] of unknown fields wrong. got=%+v, %v", p, err)
+	}
+
+	ptr, err := ToGoAs[*int](NULL)
+	if err != nil || ptr != nil {
+		t.Errorf("ToGoAs[*int](NULL) wrong. got=%v, %v", ptr, err)
+	}
+
+	arr, err := FromGoSlice([]string{"a", "b"})
+	if err != nil {
+		t.Fatalf("FromGoSlice returned error: %s", err)
+	}
+	if arr.Inspect() != "[a,b]" {
+		t.Errorf("FromGoSlice wrong. got=%s", arr.Inspect())
+	}
+}
+
+func TestToGoErrors(t *testing.T) {
+	tests := []struct {
+		input    Object
+		convert  func(Object) error
+		expected string
+	}{
+		{
+			&String{Value: "1"},
+			func(o Object) error { _, err := ToGoAs[int](o); return err },
+			"cannot convert STRING to Go type int",
+		},
+		{
+			&Integer{Value: 300},
+			func(o Object) error { _, err := ToGoAs[uint8](o); return err },
+			"cannot convert 300 to uint8: value out of range",
+		},
+		{
+			&Array{Elements: []Object{&Integer{Value: 1}, TRUE}},
+			func(o Object) error { _, err := ToGoAs[[]int](o); return err },
+			"index 1: cannot convert BOOLEAN to Go type int",
+		},
+		{
+			&Integer{Value: 1},
+			func(o Object) error { return ToGoInto(o, 1) },
+			"target must be a non-nil pointer, got int",
+		},
+		{
+			&Array{},
+			func(o Object) error { _, err := ToGoAs[map[string]int](o); return err },
+			"cannot convert to unsupported Go type map[string]int",
+		},
+		{
+			&Array{Elements: []Object{&Integer{Value: 1}}},
+			func(o Object) error { _, err := ToGoAs[point](o); return err },
+			"index 0: cannot convert 1 to a [name, value] pair",
+		},
+		{
+			&Array{Elements: []Object{&Array{Elements: []Object{TRUE, TRUE}}}},
+			func(o Object) error { _, err := ToGoAs[point](o); return err },
+			"index 0: cannot convert BOOLEAN to a field name",
+		},
+		{
+			&Array{Elements: []Object{&Array{Elements: []Object{&String{Value: "x"}, TRUE}}}},
+			func(o Object) error { _, err := ToGoAs[point](o); return err },
+			"field X: cannot convert BOOLEAN to Go type int",
+		},
+	}
+
+	for _, tt := range tests {
+		err := tt.convert(tt.input)
+		if err == nil {
+			t.Errorf("expected error converting %s", tt.input.Inspect())
+			continue
+		}
+
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error. want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
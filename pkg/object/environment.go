@@ -1,5 +1,11 @@
 package object
 
+import (
+	"sync"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+)
+
 // NewEnvironment creates a new environment
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
@@ -13,15 +19,34 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 	return env
 }
 
-// Environment environment
+// Environment environment. It is safe for concurrent use, so spawned tasks
+// can share it.
 type Environment struct {
+	mutex sync.RWMutex
 	store map[string]Object
 	outer *Environment
+	io    *IO
+
+	tracer EvalTracer
+}
+
+// EvalTracer observes the evaluation of a program. It is called from the
+// goroutine evaluating it, and spawned tasks are not traced.
+type EvalTracer interface {
+	// OnNode is called before a node is evaluated in env
+	OnNode(node ast.Node, env *Environment)
+	// OnCall is called before a function or builtin is called, after its
+	// arguments are evaluated
+	OnCall(fn Object)
+	// OnReturn is called when a function or builtin returns
+	OnReturn(fn Object, result Object)
 }
 
 // Get gets an object from the environment
 func (e *Environment) Get(name string) (Object, bool) {
+	e.mutex.RLock()
 	obj, ok := e.store[name]
+	e.mutex.RUnlock()
 
 	if !ok && e.outer != nil {
 		obj, ok = e.outer.Get(name)
@@ -32,6 +57,56 @@ func (e *Environment) Get(name string) (Object, bool) {
 
 // Set sets an object in the environment
 func (e *Environment) Set(name string, val Object) Object {
+	e.mutex.Lock()
 	e.store[name] = val
+	e.mutex.Unlock()
+
 	return val
 }
+
+// Bindings returns a copy of the names bound in this environment, without
+// those of the enclosing ones
+func (e *Environment) Bindings() map[string]Object {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	bindings := make(map[string]Object, len(e.store))
+	for name, value := range e.store {
+		bindings[name] = value
+	}
+
+	return bindings
+}
+
+// Outer returns the enclosing environment, or nil
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// SetIO sets the streams used by the builtins evaluated in this environment
+// and the ones enclosed by it
+func (e *Environment) SetIO(io *IO) {
+	e.io = io
+}
+
+// IO returns the streams set on the closest environment, or the default ones
+func (e *Environment) IO() *IO {
+	for env := e; env != nil; env = env.outer {
+		if env.io != nil {
+			return env.io
+		}
+	}
+
+	return DefaultIO()
+}
+
+// SetTracer sets the tracer called when evaluating in this environment and
+// in the functions called from it, or removes it when nil
+func (e *Environment) SetTracer(tracer EvalTracer) {
+	e.tracer = tracer
+}
+
+// Tracer returns the tracer of the environment, or nil
+func (e *Environment) Tracer() EvalTracer {
+	return e.tracer
+}
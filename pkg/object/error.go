@@ -1,6 +1,10 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
+)
 
 // Error object
 type Error struct {
@@ -19,3 +23,8 @@ func (e *Error) Inspect() string {
 	}
 	return fmt.Sprintf("Error: %s at line %d column %d", e.Message, e.Line, e.Column)
 }
+
+// Diagnostic returns the diagnostic of the error, at its position
+func (e *Error) Diagnostic() *diagnostic.Diagnostic {
+	return diagnostic.At(diagnostic.RuntimeError, e.Line, e.Column, "%s", e.Message)
+}
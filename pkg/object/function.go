@@ -7,6 +7,8 @@ type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	// Name is the name the function literal was bound to by a let, if any
+	Name string
 }
 
 // Type object type
@@ -1,6 +1,9 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"sync/atomic"
+)
 
 // Integer integer
 type Integer struct {
@@ -12,3 +15,56 @@ func (*Integer) Type() Type { return INTEGER_OBJ }
 
 // Inspect inspect
 func (i *Integer) Inspect() string { return fmt.Sprintf("%d", i.Value) }
+
+const (
+	// DefaultSmallIntegerMin is the lowest integer cached by default
+	DefaultSmallIntegerMin = -128
+	// DefaultSmallIntegerMax is the highest integer cached by default
+	DefaultSmallIntegerMax = 1024
+)
+
+// integerCache holds preallocated integers from min to max, both included
+type integerCache struct {
+	min      int64
+	max      int64
+	integers []Integer
+}
+
+var smallIntegers atomic.Pointer[integerCache]
+
+func init() {
+	SetSmallIntegerRange(DefaultSmallIntegerMin, DefaultSmallIntegerMax)
+}
+
+// SetSmallIntegerRange sets the range of integers, min and max included,
+// shared by NewInteger instead of allocating them. An empty range, with
+// max lower than min, disables the cache.
+func SetSmallIntegerRange(min, max int64) {
+	cache := &integerCache{min: min, max: max}
+
+	if max >= min {
+		cache.integers = make([]Integer, max-min+1)
+		for i := range cache.integers {
+			cache.integers[i].Value = min + int64(i)
+		}
+	}
+
+	smallIntegers.Store(cache)
+}
+
+// SmallIntegerRange returns the range of integers shared by NewInteger
+func SmallIntegerRange() (min, max int64) {
+	cache := smallIntegers.Load()
+	return cache.min, cache.max
+}
+
+// NewInteger returns an integer with the given value. Small integers are
+// preallocated and shared, so integers must never be modified.
+func NewInteger(value int64) *Integer {
+	cache := smallIntegers.Load()
+	if value >= cache.min && value <= cache.max {
+		return &cache.integers[value-cache.min]
+	}
+
+	return &Integer{Value: value}
+}
@@ -0,0 +1,38 @@
+package object
+
+import "testing"
+
+func TestNewInteger(t *testing.T) {
+	min, max := SmallIntegerRange()
+	defer SetSmallIntegerRange(min, max)
+
+	SetSmallIntegerRange(-2, 10)
+
+	tests := []struct {
+		value  int64
+		shared bool
+	}{
+		{-3, false},
+		{-2, true},
+		{0, true},
+		{10, true},
+		{11, false},
+	}
+
+	for _, tt := range tests {
+		integer := NewInteger(tt.value)
+		if integer.Value != tt.value {
+			t.Errorf("wrong value. want=%d, got=%d", tt.value, integer.Value)
+		}
+
+		shared := NewInteger(tt.value) == integer
+		if shared != tt.shared {
+			t.Errorf("wrong sharing for %d. want=%t, got=%t", tt.value, tt.shared, shared)
+		}
+	}
+
+	SetSmallIntegerRange(1, 0)
+	if NewInteger(1) == NewInteger(1) {
+		t.Errorf("integers shared with the cache disabled")
+	}
+}
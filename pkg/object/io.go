@@ -0,0 +1,92 @@
+package object
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// IO holds the streams used by the builtins that read and write. Writes and
+// reads made through it are safe to use from concurrent tasks.
+type IO struct {
+	In  *bufio.Reader
+	Out io.Writer
+	Err io.Writer
+
+	inMutex sync.Mutex
+}
+
+var defaultIO = NewIO(os.Stdin, os.Stdout, os.Stderr)
+
+// NewIO creates a new IO. Nil streams default to the process standard ones
+func NewIO(in io.Reader, out, err io.Writer) *IO {
+	if in == nil {
+		in = os.Stdin
+	}
+
+	if out == nil {
+		out = os.Stdout
+	}
+
+	if err == nil {
+		err = os.Stderr
+	}
+
+	return &IO{
+		In:  bufio.NewReader(in),
+		Out: &lockedWriter{w: out},
+		Err: &lockedWriter{w: err},
+	}
+}
+
+// DefaultIO returns the IO bound to the process standard streams
+func DefaultIO() *IO {
+	return defaultIO
+}
+
+// ReadLine reads a line from the input, without the line terminator. ok is
+// false at the end of the input.
+func (s *IO) ReadLine() (line string, ok bool, err error) {
+	s.inMutex.Lock()
+	defer s.inMutex.Unlock()
+
+	line, err = s.In.ReadString('\n')
+	if err == io.EOF {
+		if line == "" {
+			return "", false, nil
+		}
+		err = nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+
+	return line, true, nil
+}
+
+// ReadAll reads the rest of the input
+func (s *IO) ReadAll() (string, error) {
+	s.inMutex.Lock()
+	defer s.inMutex.Unlock()
+
+	content, err := io.ReadAll(s.In)
+
+	return string(content), err
+}
+
+type lockedWriter struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mutex.Lock()
+	defer lw.mutex.Unlock()
+
+	return lw.w.Write(p)
+}
@@ -0,0 +1,29 @@
+package object
+
+import "github.com/jalopez/go-monkey-interpreter/pkg/ast"
+
+// Macro macro, called with the quoted code of its arguments before the
+// program runs
+type Macro struct {
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+}
+
+// Type object type
+func (*Macro) Type() Type { return MACRO_OBJ }
+
+// Inspect object
+func (m *Macro) Inspect() string {
+	out := "macro("
+	for i, p := range m.Parameters {
+		if i != 0 {
+			out += ", "
+		}
+		out += p.String()
+	}
+	out += ") {\n"
+	out += m.Body.String()
+	out += "\n}"
+	return out
+}
@@ -8,3 +8,6 @@ func (*Null) Type() Type { return NULL_OBJ }
 
 // Inspect inspect
 func (*Null) Inspect() string { return "null" }
+
+// NULL is the null object shared by all the engines
+var NULL = &Null{}
@@ -26,6 +26,14 @@ const (
 	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION_OBJ"
 	// nolint:revive
 	CLOSURE_OBJ = "CLOSURE"
+	// nolint:revive
+	CHANNEL_OBJ = "CHANNEL"
+	// nolint:revive
+	TASK_OBJ = "TASK"
+	// nolint:revive
+	QUOTE_OBJ = "QUOTE"
+	// nolint:revive
+	MACRO_OBJ = "MACRO"
 )
 
 // Object types
@@ -0,0 +1,16 @@
+package object
+
+import "github.com/jalopez/go-monkey-interpreter/pkg/ast"
+
+// Quote is code not evaluated, returned by quote
+type Quote struct {
+	Node ast.Node
+}
+
+// Type object type
+func (*Quote) Type() Type { return QUOTE_OBJ }
+
+// Inspect object
+func (q *Quote) Inspect() string {
+	return "QUOTE(" + q.Node.String() + ")"
+}
@@ -0,0 +1,50 @@
+package object
+
+import "fmt"
+
+// Task is a function running concurrently, created by the spawn builtin
+type Task struct {
+	done   chan struct{}
+	result Object
+	err    error
+}
+
+// Spawn calls fn with args on a forked execution context in a new goroutine
+func Spawn(ctx ExecutionContext, fn Object, args []Object) *Task {
+	task := &Task{done: make(chan struct{})}
+	child := ctx.Fork()
+
+	go func() {
+		defer close(task.done)
+		defer func() {
+			if r := recover(); r != nil {
+				task.err = fmt.Errorf("%v", r)
+			}
+		}()
+
+		task.result, task.err = child.Call(fn, args...)
+
+		if errObj, ok := task.result.(*Error); ok && task.err == nil {
+			task.err = fmt.Errorf("%s", errObj.Message)
+		}
+	}()
+
+	return task
+}
+
+// Wait blocks until the task finishes and returns its result
+func (t *Task) Wait() (Object, error) {
+	<-t.done
+
+	if t.err != nil {
+		return nil, fmt.Errorf("task failed: %w", t.err)
+	}
+
+	return t.result, nil
+}
+
+// Type type
+func (*Task) Type() Type { return TASK_OBJ }
+
+// Inspect inspect
+func (t *Task) Inspect() string { return fmt.Sprintf("Task[%p]", t) }
@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
 	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
 	"github.com/jalopez/go-monkey-interpreter/pkg/token"
 )
@@ -45,8 +46,16 @@ type Parser struct {
 
 	curToken  token.Token
 	peekToken token.Token
+	// prevToken is the token before the current one, and unread the token
+	// after the peek one when the parser backs up
+	prevToken token.Token
+	unread    *token.Token
 
-	errors []string
+	diagnostics []*diagnostic.Diagnostic
+	// failed is set when the statement being parsed fails to parse
+	failed bool
+	// blocks is the number of blocks being parsed
+	blocks int
 
 	prefixParseFns map[token.Type]prefixParseFn
 	infixParseFns  map[token.Type]infixParseFn
@@ -55,8 +64,8 @@ type Parser struct {
 // New creates a new parser
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
-		l:      l,
-		errors: []string{},
+		l:           l,
+		diagnostics: []*diagnostic.Diagnostic{},
 	}
 
 	p.prefixParseFns = make(map[token.Type]prefixParseFn)
@@ -70,6 +79,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 
 	p.infixParseFns = make(map[token.Type]infixParseFn)
@@ -107,9 +117,18 @@ func (p *Parser) ParseProgram() *ast.Program {
 	return program
 }
 
-// Errors returns the errors while parsing
+// Errors returns the errors while parsing, with their position
 func (p *Parser) Errors() []string {
-	return p.errors
+	errors := make([]string, len(p.diagnostics))
+	for i, d := range p.diagnostics {
+		errors[i] = fmt.Sprintf("%s (on line %d, col %d)", d.Message, d.Start.Line, d.Start.Column)
+	}
+	return errors
+}
+
+// Diagnostics returns the errors while parsing
+func (p *Parser) Diagnostics() []*diagnostic.Diagnostic {
+	return p.diagnostics
 }
 
 func (p *Parser) registerPrefix(tokenType token.Type, fn prefixParseFn) {
@@ -121,11 +140,72 @@ func (p *Parser) registerInfix(tokenType token.Type, fn infixParseFn) {
 }
 
 func (p *Parser) nextToken() {
+	p.prevToken = p.curToken
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	if p.unread != nil {
+		p.peekToken = *p.unread
+		p.unread = nil
+	} else {
+		p.peekToken = p.l.NextToken()
+	}
 }
 
+// backup moves back to the previous token, once
+func (p *Parser) backup() {
+	peek := p.peekToken
+	p.unread = &peek
+	p.peekToken = p.curToken
+	p.curToken = p.prevToken
+}
+
+// parseStatement parses a statement. A statement failing to parse reports
+// its first error only, as the others usually follow from it, and is
+// skipped up to its end and returned as a BadStatement.
 func (p *Parser) parseStatement() ast.Statement {
+	if p.failed {
+		// in a statement that failed, and is skipped anyway
+		return p.parseStatementByKind()
+	}
+
+	start := p.curToken
+	stmt := p.parseStatementByKind()
+	if !p.failed {
+		return stmt
+	}
+
+	p.synchronize()
+	p.failed = false
+	return &ast.BadStatement{Token: start, End: p.curToken}
+}
+
+// synchronize skips the tokens of a statement that failed to parse, up to
+// its last one: a semicolon, or the token before the brace closing the block
+// it is in, before another statement or before the end of the input. Blocks
+// opened in the statement are skipped with their contents.
+func (p *Parser) synchronize() {
+	depth := 0
+	for !p.curTokenIs(token.EOF) {
+		switch p.curToken.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth = max(depth-1, 0)
+		case token.SEMICOLON:
+			if depth == 0 {
+				return
+			}
+		}
+
+		if depth == 0 && (p.peekTokenIs(token.RBRACE) && p.blocks > 0 ||
+			p.peekTokenIs(token.LET) || p.peekTokenIs(token.RETURN) || p.peekTokenIs(token.EOF)) {
+			return
+		}
+
+		p.nextToken()
+	}
+}
+
+func (p *Parser) parseStatementByKind() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
 		return p.parseLetStatement()
@@ -197,8 +277,11 @@ func (p *Parser) parseIdentifier() ast.Expression {
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	parsePrefixFn := p.prefixParseFns[p.curToken.Type]
 	if parsePrefixFn == nil {
-		msg := fmt.Sprintf("unexpected %s found", p.curToken.Type)
-		p.appendError(p.curToken, msg)
+		p.appendError(diagnostic.New(diagnostic.UnexpectedToken, p.curToken, "unexpected %s found", p.curToken.Type))
+		if p.curTokenIs(token.RBRACE) && p.blocks > 0 {
+			// the brace closing the block is left to it
+			p.backup()
+		}
 		return nil
 	}
 	expression := parsePrefixFn()
@@ -222,8 +305,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.appendError(p.curToken, msg)
+		p.appendError(diagnostic.New(diagnostic.InvalidInteger, p.curToken, "could not parse %q as integer", p.curToken.Literal))
 		return nil
 	}
 
@@ -320,6 +402,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 	block.Statements = []ast.Statement{}
 
+	p.blocks++
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
@@ -331,6 +414,12 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 		p.nextToken()
 	}
+	p.blocks--
+	block.End = p.curToken
+
+	if p.curTokenIs(token.EOF) {
+		p.appendError(diagnostic.New(diagnostic.ExpectedToken, p.curToken, "expected %s, got %s instead", token.RBRACE, token.EOF))
+	}
 
 	return block
 }
@@ -353,6 +442,24 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	lit := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
 
@@ -469,11 +576,15 @@ func (p *Parser) curPrecedence() int {
 }
 
 func (p *Parser) peekError(t token.Type) {
-	msg := fmt.Sprintf("expected %s, got %s instead", t, p.peekToken.Type)
-	p.appendError(p.peekToken, msg)
+	p.appendError(diagnostic.New(diagnostic.ExpectedToken, p.peekToken, "expected %s, got %s instead", t, p.peekToken.Type))
 }
 
-func (p *Parser) appendError(erroredToken token.Token, msg string) {
-	msg = fmt.Sprintf("%s (on line %d, col %d)", msg, erroredToken.Line, erroredToken.Column)
-	p.errors = append(p.errors, msg)
+// appendError reports an error, unless the statement being parsed already
+// failed
+func (p *Parser) appendError(d *diagnostic.Diagnostic) {
+	if p.failed {
+		return
+	}
+	p.failed = true
+	p.diagnostics = append(p.diagnostics, d)
 }
@@ -1,10 +1,15 @@
 package parser
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
 	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
 )
 
@@ -519,6 +524,53 @@ func TestFunctionLiteralParsing(t *testing.T) {
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
 
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -683,6 +735,182 @@ func TestFunctionLiteralWithName(t *testing.T) {
 	}
 }
 
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		code     string
+		line     int
+		start    int // columns of the span
+		end      int
+		message  string
+		expected string
+	}{
+		{"let x 5;", diagnostic.ExpectedToken, 1, 7, 8,
+			"expected =, got INT instead", "expected =, got INT instead (on line 1, col 7)"},
+		{"let x = *;", diagnostic.UnexpectedToken, 1, 9, 10,
+			"unexpected * found", "unexpected * found (on line 1, col 9)"},
+		{"99999999999999999999", diagnostic.InvalidInteger, 1, 1, 21,
+			`could not parse "99999999999999999999" as integer`, `could not parse "99999999999999999999" as integer (on line 1, col 1)`},
+		{"let f = fn(a", diagnostic.ExpectedToken, 1, 13, 13,
+			"expected ), got EOF instead", "expected ), got EOF instead (on line 1, col 13)"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 {
+			t.Fatalf("no diagnostics for %q", tt.input)
+		}
+
+		d := diagnostics[0]
+		start := diagnostic.Position{Line: tt.line, Column: tt.start}
+		end := diagnostic.Position{Line: tt.line, Column: tt.end}
+		if d.Code != tt.code || d.Start != start || d.End != end || d.Message != tt.message {
+			t.Errorf("wrong diagnostic for %q. want=%s %v-%v %q, got=%s %v-%v %q",
+				tt.input, tt.code, start, end, tt.message, d.Code, d.Start, d.End, d.Message)
+		}
+
+		if p.Errors()[0] != tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected, p.Errors()[0])
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		errors   []string
+		expected string
+	}{
+		{
+			"let x 5;\nlet y = 10;\nlet = 3;",
+			[]string{"expected =, got INT instead (on line 1, col 7)", "expected IDENT, got = instead (on line 3, col 5)"},
+			"<bad statement>let y = 10;<bad statement>",
+		},
+		{
+			"let f = fn(x) {\n  let y = ;\n  x\n};\nf(1)",
+			[]string{"unexpected ; found (on line 2, col 11)"},
+			"let f = fn(<f>x) <bad statement>x;f(1)",
+		},
+		{
+			"let x = (1 + ;",
+			[]string{"unexpected ; found (on line 1, col 14)"},
+			"<bad statement>",
+		},
+		{
+			"foo(1, 2\nlet y = 3;",
+			[]string{"expected ), got LET instead (on line 2, col 1)"},
+			"<bad statement>let y = 3;",
+		},
+		{
+			"if (x { 1 }\nlet y = 2;",
+			[]string{"expected ), got { instead (on line 1, col 7)"},
+			"<bad statement>let y = 2;",
+		},
+		{
+			"fn() { 1 + }; 2",
+			[]string{"unexpected } found (on line 1, col 12)"},
+			"fn() <bad statement>2",
+		},
+		{
+			"fn() { return }; 3",
+			[]string{"unexpected } found (on line 1, col 15)"},
+			"fn() <bad statement>3",
+		},
+		{
+			"} 1; let z = 1",
+			[]string{"unexpected } found (on line 1, col 1)"},
+			"<bad statement>let z = 1;",
+		},
+		{
+			"let f = fn() { 1",
+			[]string{"expected }, got EOF instead (on line 1, col 17)"},
+			"<bad statement>",
+		},
+		{
+			"let x = 1 +;\nlet y = [1, 2;\nlet z = fn(a { a };\nz(1)",
+			[]string{
+				"unexpected ; found (on line 1, col 12)",
+				"expected ], got ; instead (on line 2, col 14)",
+				"expected ), got { instead (on line 3, col 14)",
+			},
+			"<bad statement><bad statement><bad statement>z(1)",
+		},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+
+		if fmt.Sprint(p.Errors()) != fmt.Sprint(tt.errors) {
+			t.Errorf("wrong errors for %q.\nwant=%q\ngot=%q", tt.input, tt.errors, p.Errors())
+		}
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q. want=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+}
+
+func TestBadStatementSpan(t *testing.T) {
+	p := New(lexer.New("let x = (1 + 2;\nx"))
+	program := p.ParseProgram()
+
+	bad, ok := program.Statements[0].(*ast.BadStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.BadStatement. got=%T", program.Statements[0])
+	}
+	if bad.Token.Literal != "let" || bad.End.Literal != ";" || bad.End.Column != 15 {
+		t.Errorf("wrong span. got=%+v-%+v", bad.Token, bad.End)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	inputs := []string{
+		"",
+		"let x = 5; return -x;",
+		`let s = "a \\ \"quoted\" string"; s + "!"`,
+		"if (a < b) { a } else { b }; if (true) { 1 }",
+		"let add = fn(a, b) { a + b }; add(1, 2 * 3); fn() {}()",
+		"[1, true, [\"x\"]][0][1]",
+		"let x 5; let y = 1;",
+		"let unless = macro(c, a) { quote(if (!(unquote(c))) { unquote(a) }) }; macro() {}",
+	}
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "examples", "*.monkey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, string(content))
+	}
+
+	for _, input := range inputs {
+		program := New(lexer.New(input)).ParseProgram()
+
+		data, err := json.Marshal(program)
+		if err != nil {
+			t.Fatalf("encoding %q: %s", input, err)
+		}
+		if !json.Valid([]byte(program.ToJSON())) {
+			t.Errorf("invalid JSON for %q: %s", input, program.ToJSON())
+		}
+
+		var decoded ast.Program
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("decoding %q: %s", input, err)
+		}
+		if !reflect.DeepEqual(&decoded, program) {
+			t.Errorf("wrong round trip of %q.\nwant=%s\ngot=%s", input, data, decoded.ToJSON())
+		}
+	}
+}
+
 func testLetStatement(t *testing.T, s ast.Statement, name string) bool {
 	if s.TokenLiteral() != "let" {
 		t.Errorf("s.TokenLiteral not 'let'. got=%q", s.TokenLiteral())
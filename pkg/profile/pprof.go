@@ -0,0 +1,155 @@
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+)
+
+// WritePprof writes the samples as a gzipped profile in the protocol buffer
+// format read by pprof, with the number of samples and the time of every
+// call stack.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	b := &pprofBuilder{strings: map[string]int{"": 0}, stringTable: []string{""}}
+
+	functionIDs := map[*Function]uint64{}
+	locationIDs := map[Location]uint64{}
+
+	var profile protoBuffer
+	profile.message(1, b.valueType("samples", "count"))
+	profile.message(1, b.valueType("time", "nanoseconds"))
+
+	for _, s := range p.Samples() {
+		ids := make([]uint64, len(s.Stack))
+		for i, location := range s.Stack {
+			id, ok := locationIDs[location]
+			if !ok {
+				fnID, ok := functionIDs[location.Function]
+				if !ok {
+					fnID = uint64(len(functionIDs) + 1)
+					functionIDs[location.Function] = fnID
+					profile.message(5, b.function(fnID, location.Function))
+				}
+
+				id = uint64(len(locationIDs) + 1)
+				locationIDs[location] = id
+				profile.message(4, b.location(id, fnID, location.Line))
+			}
+			ids[i] = id
+		}
+
+		var sample protoBuffer
+		sample.packed(1, ids)
+		sample.packed(2, []uint64{uint64(s.Count), uint64(s.Time.Nanoseconds())})
+		profile.message(2, sample)
+	}
+
+	periodType := b.valueType("time", "nanoseconds")
+	timeNanos := uint64(p.start.UnixNano())
+
+	for _, s := range b.stringTable {
+		profile.bytes(6, []byte(s))
+	}
+	profile.varint(9, timeNanos)
+	profile.varint(10, uint64(p.duration.Nanoseconds()))
+	profile.message(11, periodType)
+	profile.varint(12, uint64(p.interval.Nanoseconds()))
+
+	gz := gzip.NewWriter(w)
+	_, err := gz.Write(profile)
+	if err != nil {
+		return err
+	}
+
+	return gz.Close()
+}
+
+// pprofBuilder holds the string table of a profile
+type pprofBuilder struct {
+	strings     map[string]int
+	stringTable []string
+}
+
+func (b *pprofBuilder) string(s string) uint64 {
+	index, ok := b.strings[s]
+	if !ok {
+		index = len(b.stringTable)
+		b.strings[s] = index
+		b.stringTable = append(b.stringTable, s)
+	}
+
+	return uint64(index)
+}
+
+func (b *pprofBuilder) valueType(typ, unit string) protoBuffer {
+	var m protoBuffer
+	m.varint(1, b.string(typ))
+	m.varint(2, b.string(unit))
+	return m
+}
+
+func (b *pprofBuilder) function(id uint64, fn *Function) protoBuffer {
+	var m protoBuffer
+	m.varint(1, id)
+	m.varint(2, b.string(fn.Name))
+	m.varint(3, b.string(fn.Name))
+	m.varint(4, b.string(fn.Filename))
+	m.varint(5, uint64(fn.Line))
+	return m
+}
+
+func (b *pprofBuilder) location(id, functionID uint64, line int) protoBuffer {
+	var l protoBuffer
+	l.varint(1, functionID)
+	l.varint(2, uint64(line))
+
+	var m protoBuffer
+	m.varint(1, id)
+	m.message(4, l)
+	return m
+}
+
+// protoBuffer encodes a protocol buffer message
+type protoBuffer []byte
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (m *protoBuffer) key(field, wireType int) {
+	m.uvarint(uint64(field<<3 | wireType))
+}
+
+func (m *protoBuffer) uvarint(v uint64) {
+	for v >= 0x80 {
+		*m = append(*m, byte(v)|0x80)
+		v >>= 7
+	}
+	*m = append(*m, byte(v))
+}
+
+func (m *protoBuffer) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	m.key(field, wireVarint)
+	m.uvarint(v)
+}
+
+func (m *protoBuffer) bytes(field int, b []byte) {
+	m.key(field, wireBytes)
+	m.uvarint(uint64(len(b)))
+	*m = append(*m, b...)
+}
+
+func (m *protoBuffer) message(field int, message protoBuffer) {
+	m.bytes(field, message)
+}
+
+func (m *protoBuffer) packed(field int, values []uint64) {
+	var packed protoBuffer
+	for _, v := range values {
+		packed.uvarint(v)
+	}
+	m.bytes(field, packed)
+}
@@ -0,0 +1,378 @@
+package profile
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/code"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/vm"
+)
+
+// DefaultInterval is the default time between samples
+const DefaultInterval = time.Millisecond
+
+// checkEvery is the number of instructions or nodes run between checks of
+// the clock, to find whether a sample has to be taken
+const checkEvery = 256
+
+// Profiler attributes the time spent running a Monkey program to its
+// functions and lines, by sampling the call stack at regular intervals,
+// checked on the instructions or nodes run, and counts the calls to every
+// function. It is attached to the VM or to the evaluator as a tracer, and
+// profiles a single goroutine.
+type Profiler struct {
+	filename string
+	interval time.Duration
+
+	// ticks counts the instructions or nodes run until the next check of
+	// the clock
+	ticks int
+
+	start      time.Time
+	duration   time.Duration
+	lastSample time.Time
+
+	functions map[any]*Function
+	// stack is the call stack of the program, outermost call first
+	stack   []frame
+	samples map[string]*Sample
+}
+
+// Function holds the statistics of a function of the program.
+type Function struct {
+	Name     string
+	Filename string
+	Line     int
+
+	// Calls is the number of times the function was called
+	Calls int
+	// Time is the time spent in the outermost calls of the function, with
+	// the functions they call, measured on every call and return
+	Time time.Duration
+
+	active  int
+	entered time.Time
+}
+
+// Location is a line of a function.
+type Location struct {
+	Function *Function
+	Line     int
+}
+
+// Sample is a call stack found when sampling, innermost call first, with
+// the number of times it was found and the time attributed to it.
+type Sample struct {
+	Stack []Location
+	Count int
+	Time  time.Duration
+}
+
+// frame is a call to a function. Its current line is found from the last
+// instruction or node run, only when sampling.
+type frame struct {
+	function *Function
+	code     *object.CompiledFunction
+	ip       int
+	node     ast.Node
+
+	// depth is the VM frame depth of closures, and of the caller for
+	// builtins, which have no frame
+	depth   int
+	builtin bool
+}
+
+// New creates a profiler for a program read from filename, sampling at the
+// given interval.
+func New(filename string, interval time.Duration) *Profiler {
+	return &Profiler{
+		filename:  filename,
+		interval:  interval,
+		functions: map[any]*Function{},
+		samples:   map[string]*Sample{},
+	}
+}
+
+// Start starts sampling, before running the program.
+func (p *Profiler) Start() {
+	p.start = time.Now()
+	p.lastSample = p.start
+	p.ticks = 0
+}
+
+// Stop stops sampling, after running the program.
+func (p *Profiler) Stop() {
+	p.duration = time.Since(p.start)
+
+	// calls interrupted by errors
+	now := time.Now()
+	for _, fn := range p.functions {
+		if fn.active > 0 {
+			fn.Time += now.Sub(fn.entered)
+			fn.active = 0
+		}
+	}
+}
+
+// Duration returns the time between Start and Stop.
+func (p *Profiler) Duration() time.Duration {
+	return p.duration
+}
+
+// Functions returns the functions called, sorted by name and line.
+func (p *Profiler) Functions() []*Function {
+	functions := make([]*Function, 0, len(p.functions))
+	for _, fn := range p.functions {
+		functions = append(functions, fn)
+	}
+
+	sort.Slice(functions, func(i, j int) bool {
+		if functions[i].Name != functions[j].Name {
+			return functions[i].Name < functions[j].Name
+		}
+		return functions[i].Line < functions[j].Line
+	})
+
+	return functions
+}
+
+// Samples returns the call stacks sampled.
+func (p *Profiler) Samples() []*Sample {
+	samples := make([]*Sample, 0, len(p.samples))
+	for _, s := range p.samples {
+		samples = append(samples, s)
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].Time > samples[j].Time })
+
+	return samples
+}
+
+// VMTracer returns the tracer to set on the VM running the program.
+func (p *Profiler) VMTracer() vm.Tracer {
+	return vmTracer{p}
+}
+
+// EvalTracer returns the tracer to set on the environment the program is
+// evaluated in.
+func (p *Profiler) EvalTracer() object.EvalTracer {
+	return evalTracer{p}
+}
+
+func (p *Profiler) function(key any, name string, line int) *Function {
+	fn, ok := p.functions[key]
+	if !ok {
+		fn = &Function{Name: name, Filename: p.filename, Line: line}
+		p.functions[key] = fn
+	}
+
+	return fn
+}
+
+func (p *Profiler) main() *Function {
+	return p.function(p, "main", 1)
+}
+
+func (p *Profiler) builtin(b *object.Builtin) *Function {
+	fn, ok := p.functions[b]
+	if ok {
+		return fn
+	}
+
+	name := "builtin"
+	for _, def := range object.Builtins {
+		if def.Builtin == b {
+			name = def.Name
+		}
+	}
+
+	fn = &Function{Name: name, Filename: "<builtin>"}
+	p.functions[b] = fn
+
+	return fn
+}
+
+func (p *Profiler) enter(fn *Function, f frame) {
+	fn.Calls++
+	if fn.active == 0 {
+		fn.entered = time.Now()
+	}
+	fn.active++
+
+	f.function = fn
+	p.stack = append(p.stack, f)
+}
+
+func (p *Profiler) leave() {
+	if len(p.stack) == 0 {
+		return
+	}
+
+	fn := p.stack[len(p.stack)-1].function
+	p.stack = p.stack[:len(p.stack)-1]
+
+	fn.active--
+	if fn.active == 0 {
+		fn.Time += time.Since(fn.entered)
+	}
+}
+
+// tick takes a sample when the interval has passed since the last one
+func (p *Profiler) tick() {
+	p.ticks++
+	if p.ticks < checkEvery {
+		return
+	}
+	p.ticks = 0
+
+	if time.Since(p.lastSample) >= p.interval {
+		p.takeSample()
+	}
+}
+
+// takeSample attributes the time since the last sample to the current
+// call stack
+func (p *Profiler) takeSample() {
+	now := time.Now()
+	elapsed := now.Sub(p.lastSample)
+	p.lastSample = now
+
+	stack := make([]Location, len(p.stack))
+	var key strings.Builder
+	for i := range p.stack {
+		f := p.stack[len(p.stack)-1-i]
+
+		line := f.function.Line
+		if f.code != nil {
+			line, _ = f.code.SourceMap.Lookup(f.ip)
+		} else if f.node != nil {
+			line, _ = ast.Position(f.node)
+		}
+
+		stack[i] = Location{Function: f.function, Line: line}
+		fmt.Fprintf(&key, "%p:%d;", f.function, line)
+	}
+
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &Sample{Stack: stack}
+		p.samples[key.String()] = s
+	}
+	s.Count++
+	s.Time += elapsed
+}
+
+func functionName(name string, line int) string {
+	if name != "" {
+		return name
+	}
+	return fmt.Sprintf("fn@%d", line)
+}
+
+type vmTracer struct {
+	p *Profiler
+}
+
+func (t vmTracer) OnInstruction(e vm.TraceEvent) {
+	p := t.p
+
+	// calls left by errors and pauses, which have no return
+	for len(p.stack) > 0 && p.stack[len(p.stack)-1].depth > e.Depth {
+		p.leave()
+	}
+	if len(p.stack) == 0 {
+		p.enter(p.main(), frame{code: e.Function, depth: 1})
+	}
+
+	p.stack[len(p.stack)-1].ip = e.IP
+
+	p.tick()
+}
+
+func (t vmTracer) OnCall(e vm.TraceEvent) {
+	p := t.p
+	if len(p.stack) == 0 {
+		p.enter(p.main(), frame{code: e.Function, depth: 1})
+	}
+	if e.IP >= 0 {
+		p.stack[len(p.stack)-1].ip = e.IP
+	}
+
+	switch callee := e.Callee.(type) {
+	case *object.Closure:
+		line := callee.Fn.Line
+		fn := p.function(callee.Fn, functionName(callee.Fn.Name, line), line)
+		p.enter(fn, frame{code: callee.Fn, depth: e.Depth})
+	case *object.Builtin:
+		p.enter(p.builtin(callee), frame{depth: e.Depth - 1, builtin: true})
+	}
+}
+
+func (t vmTracer) OnReturn(e vm.TraceEvent) {
+	p := t.p
+
+	switch e.Op {
+	case code.OpReturnValue, code.OpReturn:
+		for len(p.stack) > 0 && p.stack[len(p.stack)-1].depth >= e.Depth {
+			p.leave()
+		}
+	default:
+		// builtins, after the calls to closures they made
+		for len(p.stack) > 0 {
+			top := p.stack[len(p.stack)-1]
+			p.leave()
+			if top.builtin && top.depth == e.Depth-1 {
+				break
+			}
+		}
+	}
+}
+
+func (t vmTracer) OnError(vm.TraceEvent, error) {}
+
+type evalTracer struct {
+	p *Profiler
+}
+
+func (t evalTracer) OnNode(node ast.Node, _ *object.Environment) {
+	p := t.p
+	if len(p.stack) == 0 {
+		p.enter(p.main(), frame{})
+	}
+
+	// the lines of programs and blocks are those of their statements
+	switch node.(type) {
+	case *ast.Program, *ast.BlockStatement:
+		return
+	}
+
+	p.stack[len(p.stack)-1].node = node
+	p.tick()
+}
+
+func (t evalTracer) OnCall(callee object.Object) {
+	p := t.p
+	if len(p.stack) == 0 {
+		p.enter(p.main(), frame{})
+	}
+
+	switch callee := callee.(type) {
+	case *object.Function:
+		line, _ := ast.Position(callee.Body)
+		fn := p.function(callee.Body, functionName(callee.Name, line), line)
+		p.enter(fn, frame{})
+	case *object.Builtin:
+		p.enter(p.builtin(callee), frame{})
+	default:
+		// not a function, returns an error right away
+		p.enter(p.function(callee, callee.Inspect(), 0), frame{})
+	}
+}
+
+func (t evalTracer) OnReturn(object.Object, object.Object) {
+	t.p.leave()
+}
@@ -0,0 +1,171 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/compiler"
+	"github.com/jalopez/go-monkey-interpreter/pkg/eval"
+	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+	"github.com/jalopez/go-monkey-interpreter/pkg/vm"
+)
+
+const profiledInput = `let fibonacci = fn(x) {
+  if (x < 2) { return x; }
+  fibonacci(x - 1) + fibonacci(x - 2)
+};
+let double = fn(x) { x * 2 };
+map([1, 2, 3], fn(x) { double(x) });
+len([1, 2]);
+fibonacci(15);
+`
+
+func profileProgram(t *testing.T, engine string, input string) *Profiler {
+	t.Helper()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	// sample every check of the clock
+	profiler := New("test.monkey", 0)
+
+	switch engine {
+	case "vm":
+		comp := compiler.New()
+		if err := comp.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		machine := vm.New(comp.Bytecode())
+		machine.SetTracer(profiler.VMTracer())
+		profiler.Start()
+		err := machine.Run()
+		profiler.Stop()
+		if err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+	case "eval":
+		env := object.NewEnvironment()
+		env.SetTracer(profiler.EvalTracer())
+		profiler.Start()
+		result := eval.Eval(program, env)
+		profiler.Stop()
+		if result != nil && result.Type() == object.ERROR_OBJ {
+			t.Fatalf("eval error: %s", result.Inspect())
+		}
+	}
+
+	return profiler
+}
+
+func TestProfilerCalls(t *testing.T) {
+	expected := map[string]int{
+		"main":      1,
+		"fibonacci": 1973,
+		"double":    3,
+		"fn@6":      3,
+		"map":       1,
+		"len":       1,
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		profiler := profileProgram(t, engine, profiledInput)
+
+		calls := map[string]int{}
+		for _, fn := range profiler.Functions() {
+			calls[fn.Name] = fn.Calls
+		}
+
+		for name, want := range expected {
+			if calls[name] != want {
+				t.Errorf("%s: wrong calls to %s. want=%d, got=%d", engine, name, want, calls[name])
+			}
+		}
+
+		if len(profiler.stack) != 1 || profiler.stack[0].function.Name != "main" {
+			t.Errorf("%s: call stack not back to main after the program: %d frames", engine, len(profiler.stack))
+		}
+	}
+}
+
+func TestProfilerSamples(t *testing.T) {
+	for _, engine := range []string{"vm", "eval"} {
+		profiler := profileProgram(t, engine, profiledInput)
+
+		samples := profiler.Samples()
+		if len(samples) == 0 {
+			t.Fatalf("%s: no samples taken", engine)
+		}
+
+		foundFibonacci := false
+		for _, s := range samples {
+			if len(s.Stack) == 0 {
+				t.Fatalf("%s: empty call stack sampled", engine)
+			}
+			if outermost := s.Stack[len(s.Stack)-1].Function.Name; outermost != "main" {
+				t.Errorf("%s: wrong outermost function. want=main, got=%s", engine, outermost)
+			}
+
+			if s.Stack[0].Function.Name == "fibonacci" {
+				foundFibonacci = true
+				if line := s.Stack[0].Line; line < 2 || line > 3 {
+					t.Errorf("%s: wrong line sampled in fibonacci. got=%d", engine, line)
+				}
+			}
+		}
+
+		if !foundFibonacci {
+			t.Errorf("%s: fibonacci not sampled", engine)
+		}
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	profiler := profileProgram(t, "vm", profiledInput)
+
+	var out bytes.Buffer
+	if err := profiler.WriteReport(&out, 3); err != nil {
+		t.Fatalf("error writing report: %s", err)
+	}
+
+	report := out.String()
+	for _, want := range []string{"Top 3 functions:", "Top 3 lines:", "fibonacci test.monkey:1\n", "1973"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report does not contain %q:\n%s", want, report)
+		}
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	profiler := profileProgram(t, "eval", profiledInput)
+
+	var out bytes.Buffer
+	if err := profiler.WritePprof(&out); err != nil {
+		t.Fatalf("error writing profile: %s", err)
+	}
+
+	r, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("profile not gzipped: %s", err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("error reading profile: %s", err)
+	}
+
+	// string_table entries, field 6
+	for _, want := range []string{"samples", "nanoseconds", "fibonacci", "test.monkey"} {
+		entry := append([]byte{6<<3 | 2, byte(len(want))}, want...)
+		if !bytes.Contains(data, entry) {
+			t.Errorf("profile string table does not contain %q", want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package profile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// WriteReport writes the n functions and lines the most time was spent in,
+// with the time spent in them and in the functions they call, as found
+// when sampling, and the calls to every function.
+func (p *Profiler) WriteReport(w io.Writer, n int) error {
+	flat := map[*Function]time.Duration{}
+	cum := map[*Function]time.Duration{}
+	lines := map[Location]time.Duration{}
+	var total time.Duration
+	count := 0
+
+	for _, s := range p.samples {
+		total += s.Time
+		count += s.Count
+
+		if len(s.Stack) == 0 {
+			continue
+		}
+		flat[s.Stack[0].Function] += s.Time
+		lines[s.Stack[0]] += s.Time
+
+		// recursive calls count once
+		seen := map[*Function]bool{}
+		for _, location := range s.Stack {
+			if !seen[location.Function] {
+				seen[location.Function] = true
+				cum[location.Function] += s.Time
+			}
+		}
+	}
+
+	functions := p.Functions()
+	sort.SliceStable(functions, func(i, j int) bool {
+		if flat[functions[i]] != flat[functions[j]] {
+			return flat[functions[i]] > flat[functions[j]]
+		}
+		return cum[functions[i]] > cum[functions[j]]
+	})
+
+	locations := make([]Location, 0, len(lines))
+	for location := range lines {
+		locations = append(locations, location)
+	}
+	sort.Slice(locations, func(i, j int) bool {
+		if lines[locations[i]] != lines[locations[j]] {
+			return lines[locations[i]] > lines[locations[j]]
+		}
+		if locations[i].Function.Name != locations[j].Function.Name {
+			return locations[i].Function.Name < locations[j].Function.Name
+		}
+		return locations[i].Line < locations[j].Line
+	})
+
+	_, err := fmt.Fprintf(w, "Duration: %s, %d samples, %s sampled\n", p.duration.Round(time.Millisecond), count, total.Round(time.Millisecond))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nTop %d functions:\n", n)
+	fmt.Fprintf(w, "%10s %6s %10s %6s %10s %10s  %s\n", "flat", "flat%", "cum", "cum%", "calls", "time", "function")
+	for _, fn := range functions[:min(n, len(functions))] {
+		fmt.Fprintf(w, "%10s %6s %10s %6s %10d %10s  %s %s\n",
+			round(flat[fn]), percent(flat[fn], total), round(cum[fn]), percent(cum[fn], total),
+			fn.Calls, round(fn.Time), fn.Name, location(fn.Filename, fn.Line))
+	}
+
+	fmt.Fprintf(w, "\nTop %d lines:\n", n)
+	fmt.Fprintf(w, "%10s %6s  %s\n", "flat", "flat%", "line")
+	for _, l := range locations[:min(n, len(locations))] {
+		_, err = fmt.Fprintf(w, "%10s %6s  %s %s\n", round(lines[l]), percent(lines[l], total), l.Function.Name, location(l.Function.Filename, l.Line))
+	}
+
+	return err
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
+
+func percent(d, total time.Duration) string {
+	if total == 0 {
+		return "0.0%"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(d)/float64(total))
+}
+
+func location(filename string, line int) string {
+	if line == 0 {
+		return filename
+	}
+	return fmt.Sprintf("%s:%d", filename, line)
+}
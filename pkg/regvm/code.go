@@ -0,0 +1,166 @@
+package regvm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Opcode is the operation of an instruction.
+type Opcode byte
+
+// Opcodes of the register machine. R[x] is the register x of the current
+// frame, K[x] the constant x and RK[x] a register when x >= 0 or the constant
+// -x-1 otherwise.
+const (
+	// OpLoadConstant A B: R[A] = K[B]
+	OpLoadConstant Opcode = iota
+	// OpLoadTrue A: R[A] = true
+	OpLoadTrue
+	// OpLoadFalse A: R[A] = false
+	OpLoadFalse
+	// OpLoadNull A: R[A] = null
+	OpLoadNull
+	// OpMove A B: R[A] = R[B]
+	OpMove
+	// OpGetGlobal A B: R[A] = globals[B]
+	OpGetGlobal
+	// OpSetGlobal A B: globals[B] = R[A]
+	OpSetGlobal
+	// OpGetBuiltin A B: R[A] = builtins[B]
+	OpGetBuiltin
+	// OpGetFree A B: R[A] = free[B] of the current closure
+	OpGetFree
+	// OpCurrentClosure A: R[A] = current closure
+	OpCurrentClosure
+	// OpAdd A B C: R[A] = RK[B] + RK[C]
+	OpAdd
+	// OpSub A B C: R[A] = RK[B] - RK[C]
+	OpSub
+	// OpMul A B C: R[A] = RK[B] * RK[C]
+	OpMul
+	// OpDiv A B C: R[A] = RK[B] / RK[C]
+	OpDiv
+	// OpEqual A B C: R[A] = RK[B] == RK[C]
+	OpEqual
+	// OpNotEqual A B C: R[A] = RK[B] != RK[C]
+	OpNotEqual
+	// OpGreaterThan A B C: R[A] = RK[B] > RK[C]
+	OpGreaterThan
+	// OpMinus A B: R[A] = -R[B]
+	OpMinus
+	// OpBang A B: R[A] = !R[B]
+	OpBang
+	// OpJump A: jump to A
+	OpJump
+	// OpJumpNotTruthy A B: jump to B if R[A] is not truthy
+	OpJumpNotTruthy
+	// OpArray A B C: R[A] = [R[B], ..., R[B+C-1]]
+	OpArray
+	// OpIndex A B C: R[A] = R[B][R[C]]
+	OpIndex
+	// OpCall A B C: R[A] = R[B](R[B+1], ..., R[B+C])
+	OpCall
+	// OpReturn A: return R[A]
+	OpReturn
+	// OpReturnNull: return null
+	OpReturnNull
+	// OpClosure A B: R[A] = closure of the function K[B]
+	OpClosure
+	// OpPop A: R[A] is the result of a top-level expression statement
+	OpPop
+)
+
+// Definition holds the name and the number of operands of an opcode.
+type Definition struct {
+	Name        string
+	NumOperands int
+}
+
+// Definitions holds the definitions of all the opcodes.
+var Definitions = map[Opcode]*Definition{
+	OpLoadConstant:   {"OpLoadConstant", 2},
+	OpLoadTrue:       {"OpLoadTrue", 1},
+	OpLoadFalse:      {"OpLoadFalse", 1},
+	OpLoadNull:       {"OpLoadNull", 1},
+	OpMove:           {"OpMove", 2},
+	OpGetGlobal:      {"OpGetGlobal", 2},
+	OpSetGlobal:      {"OpSetGlobal", 2},
+	OpGetBuiltin:     {"OpGetBuiltin", 2},
+	OpGetFree:        {"OpGetFree", 2},
+	OpCurrentClosure: {"OpCurrentClosure", 1},
+	OpAdd:            {"OpAdd", 3},
+	OpSub:            {"OpSub", 3},
+	OpMul:            {"OpMul", 3},
+	OpDiv:            {"OpDiv", 3},
+	OpEqual:          {"OpEqual", 3},
+	OpNotEqual:       {"OpNotEqual", 3},
+	OpGreaterThan:    {"OpGreaterThan", 3},
+	OpMinus:          {"OpMinus", 2},
+	OpBang:           {"OpBang", 2},
+	OpJump:           {"OpJump", 1},
+	OpJumpNotTruthy:  {"OpJumpNotTruthy", 2},
+	OpArray:          {"OpArray", 3},
+	OpIndex:          {"OpIndex", 3},
+	OpCall:           {"OpCall", 3},
+	OpReturn:         {"OpReturn", 1},
+	OpReturnNull:     {"OpReturnNull", 0},
+	OpClosure:        {"OpClosure", 2},
+	OpPop:            {"OpPop", 1},
+}
+
+// Instruction is a single instruction of the register machine. Unlike the
+// stack machine bytecode, instructions have a fixed size and are decoded
+// just by reading their fields.
+type Instruction struct {
+	Op      Opcode
+	A, B, C int32
+}
+
+// Make creates an instruction from an opcode and its operands.
+func Make(op Opcode, operands ...int) Instruction {
+	ins := Instruction{Op: op}
+
+	fields := []*int32{&ins.A, &ins.B, &ins.C}
+	for i, operand := range operands {
+		*fields[i] = int32(operand)
+	}
+
+	return ins
+}
+
+// String returns a string representation of the instruction.
+func (ins Instruction) String() string {
+	def, ok := Definitions[ins.Op]
+	if !ok {
+		return fmt.Sprintf("ERROR: opcode %d undefined", ins.Op)
+	}
+
+	operands := []int32{ins.A, ins.B, ins.C}[:def.NumOperands]
+
+	var out strings.Builder
+	out.WriteString(def.Name)
+	for _, operand := range operands {
+		fmt.Fprintf(&out, " %d", operand)
+	}
+
+	return out.String()
+}
+
+// Instructions is a sequence of instructions.
+type Instructions []Instruction
+
+// String returns a string representation of the instructions.
+func (ins Instructions) String() string {
+	var out strings.Builder
+
+	for i, instruction := range ins {
+		fmt.Fprintf(&out, "%04d %s\n", i, instruction)
+	}
+
+	return out.String()
+}
+
+// constantOperand encodes a constant index as a RK operand.
+func constantOperand(index int) int {
+	return -index - 1
+}
@@ -0,0 +1,589 @@
+package regvm
+
+import (
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/code"
+	"github.com/jalopez/go-monkey-interpreter/pkg/compiler"
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/token"
+)
+
+// compilationScope holds the state of the function being compiled. Locals
+// live in the registers numbered after their symbol index, and temporaries
+// are allocated like a stack in the registers above them.
+type compilationScope struct {
+	instructions Instructions
+	sourceMap    code.SourceMap
+	symbolTable  *compiler.SymbolTable
+
+	nextRegister int
+	maxRegisters int
+}
+
+// Compiler compiles the AST into instructions for the register machine.
+type Compiler struct {
+	constants []object.Object
+
+	scopes []*compilationScope
+
+	// position is the source position of the node being compiled, which
+	// the instructions emitted are mapped to
+	position sourcePosition
+}
+
+type sourcePosition struct {
+	line, column int
+}
+
+// Bytecode holds the compiled program.
+type Bytecode struct {
+	Main      *Function
+	Constants []object.Object
+	// NumGlobals is the number of globals defined by the program and by the
+	// previous ones sharing its symbol table
+	NumGlobals int
+}
+
+// NewCompiler creates a new compiler.
+func NewCompiler() *Compiler {
+	symbolTable := compiler.NewSymbolTable()
+
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return NewCompilerWithState(symbolTable, []object.Object{})
+}
+
+// NewCompilerWithState creates a new compiler with a symbol table and
+// constants, to keep the globals defined by previous programs.
+func NewCompilerWithState(s *compiler.SymbolTable, constants []object.Object) *Compiler {
+	return &Compiler{
+		constants: constants,
+		scopes:    []*compilationScope{{symbolTable: s}},
+	}
+}
+
+// Compile compiles the program.
+func (c *Compiler) Compile(program *ast.Program) error {
+	for _, s := range program.Statements {
+		err := c.compileStatement(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Bytecode returns the compiled program.
+func (c *Compiler) Bytecode() *Bytecode {
+	main := c.scopes[0]
+
+	return &Bytecode{
+		Main: &Function{
+			Instructions: main.instructions,
+			SourceMap:    main.sourceMap,
+			NumRegisters: main.maxRegisters,
+		},
+		Constants:  c.constants,
+		NumGlobals: len(main.symbolTable.Names()),
+	}
+}
+
+func (c *Compiler) compileStatement(node ast.Statement) error {
+	if line, column := ast.Position(node); line > 0 {
+		previous := c.position
+		c.position = sourcePosition{line: line, column: column}
+		defer func() { c.position = previous }()
+	}
+
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		mark := c.scope().nextRegister
+		defer c.freeRegisters(mark)
+
+		reg := c.allocateRegister()
+		err := c.compileExpression(node.Expression, reg)
+		if err != nil {
+			return err
+		}
+
+		if c.isMainScope() {
+			c.emit(OpPop, reg)
+		}
+
+	case *ast.LetStatement:
+		mark := c.scope().nextRegister
+		defer c.freeRegisters(mark)
+
+		reg := c.allocateRegister()
+		err := c.compileExpression(node.Value, reg)
+		if err != nil {
+			return err
+		}
+
+		symbol := c.scope().symbolTable.Define(node.Name.Value)
+		if symbol.Scope == compiler.GlobalScope {
+			c.emit(OpSetGlobal, reg, symbol.Index)
+		} else {
+			c.emit(OpMove, symbol.Index, reg)
+		}
+
+	case *ast.ReturnStatement:
+		mark := c.scope().nextRegister
+		defer c.freeRegisters(mark)
+
+		reg, err := c.compileRegisterOperand(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+
+		c.emit(OpReturn, reg)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			err := c.compileStatement(s)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// compileBlock compiles a block whose value, the value of its last
+// expression statement, is stored in dst
+func (c *Compiler) compileBlock(block *ast.BlockStatement, dst int) error {
+	if block == nil || len(block.Statements) == 0 {
+		c.emit(OpLoadNull, dst)
+		return nil
+	}
+
+	last := len(block.Statements) - 1
+	for _, s := range block.Statements[:last] {
+		err := c.compileStatement(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	if s, ok := block.Statements[last].(*ast.ExpressionStatement); ok {
+		return c.compileExpression(s.Expression, dst)
+	}
+
+	err := c.compileStatement(block.Statements[last])
+	if err != nil {
+		return err
+	}
+	if _, ok := block.Statements[last].(*ast.ReturnStatement); !ok {
+		c.emit(OpLoadNull, dst)
+	}
+
+	return nil
+}
+
+// compileExpression compiles an expression whose value is stored in dst
+func (c *Compiler) compileExpression(node ast.Expression, dst int) error {
+	if line, column := ast.Position(node); line > 0 {
+		previous := c.position
+		c.position = sourcePosition{line: line, column: column}
+		defer func() { c.position = previous }()
+	}
+
+	mark := c.scope().nextRegister
+	defer c.freeRegisters(mark)
+
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		c.emit(OpLoadConstant, dst, c.addConstant(object.NewInteger(node.Value)))
+
+	case *ast.StringLiteral:
+		c.emit(OpLoadConstant, dst, c.addConstant(&object.String{Value: node.Value}))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(OpLoadTrue, dst)
+		} else {
+			c.emit(OpLoadFalse, dst)
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.scope().symbolTable.Resolve(node.Value)
+		if !ok {
+			return diagnostic.New(diagnostic.UndefinedVariable, node.Token, "undefined variable %s", node.Value)
+		}
+
+		c.loadSymbol(symbol, dst)
+
+	case *ast.PrefixExpression:
+		right, err := c.compileRegisterOperand(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case token.MINUS:
+			c.emit(OpMinus, dst, right)
+		case token.BANG:
+			c.emit(OpBang, dst, right)
+		default:
+			return diagnostic.New(diagnostic.UnknownOperator, node.Token, "unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		if node.Operator == token.LT {
+			right, err := c.compileOperand(node.Right)
+			if err != nil {
+				return err
+			}
+			left, err := c.compileOperand(node.Left)
+			if err != nil {
+				return err
+			}
+			c.emit(OpGreaterThan, dst, right, left)
+			return nil
+		}
+
+		left, err := c.compileOperand(node.Left)
+		if err != nil {
+			return err
+		}
+		right, err := c.compileOperand(node.Right)
+		if err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case token.PLUS:
+			c.emit(OpAdd, dst, left, right)
+		case token.MINUS:
+			c.emit(OpSub, dst, left, right)
+		case token.ASTERISK:
+			c.emit(OpMul, dst, left, right)
+		case token.SLASH:
+			c.emit(OpDiv, dst, left, right)
+		case token.EQ:
+			c.emit(OpEqual, dst, left, right)
+		case token.NOTEQ:
+			c.emit(OpNotEqual, dst, left, right)
+		case token.GT:
+			c.emit(OpGreaterThan, dst, left, right)
+		default:
+			return diagnostic.New(diagnostic.UnknownOperator, node.Token, "unknown operator %s", node.Operator)
+		}
+
+	case *ast.IfExpression:
+		condition, err := c.compileRegisterOperand(node.Condition)
+		if err != nil {
+			return err
+		}
+
+		jumpNotTruthyPos := c.emit(OpJumpNotTruthy, condition, 9999)
+		c.freeRegisters(mark)
+
+		err = c.compileBlock(node.Consequence, dst)
+		if err != nil {
+			return err
+		}
+
+		jumpPos := c.emit(OpJump, 9999)
+		c.changeJumpTarget(jumpNotTruthyPos, len(c.scope().instructions))
+
+		if node.Alternative == nil {
+			c.emit(OpLoadNull, dst)
+		} else {
+			err := c.compileBlock(node.Alternative, dst)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.changeJumpTarget(jumpPos, len(c.scope().instructions))
+
+	case *ast.ArrayLiteral:
+		first := c.scope().nextRegister
+		for _, el := range node.Elements {
+			err := c.compileExpression(el, c.allocateRegister())
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(OpArray, dst, first, len(node.Elements))
+
+	case *ast.IndexExpression:
+		left, err := c.compileRegisterOperand(node.Left)
+		if err != nil {
+			return err
+		}
+		index, err := c.compileRegisterOperand(node.Index)
+		if err != nil {
+			return err
+		}
+
+		c.emit(OpIndex, dst, left, index)
+
+	case *ast.CallExpression:
+		// the callee and the arguments are stored in consecutive registers,
+		// so the arguments become the first registers of the called function
+		callee := c.allocateRegister()
+		err := c.compileExpression(node.Function, callee)
+		if err != nil {
+			return err
+		}
+
+		for _, arg := range node.Arguments {
+			err := c.compileExpression(arg, c.allocateRegister())
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(OpCall, dst, callee, len(node.Arguments))
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, dst)
+
+	case *ast.MacroLiteral:
+		return diagnostic.New(diagnostic.InvalidMacro, node.Token, "macros can only be bound by let statements at the top level")
+
+	default:
+		c.emit(OpLoadNull, dst)
+	}
+
+	return nil
+}
+
+// compileOperand compiles an operand of an arithmetic or comparison
+// instruction. Locals and literals are used in place, without copying them
+// to a temporary register.
+func (c *Compiler) compileOperand(node ast.Expression) (int, error) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return constantOperand(c.addConstant(object.NewInteger(node.Value))), nil
+	case *ast.StringLiteral:
+		return constantOperand(c.addConstant(&object.String{Value: node.Value})), nil
+	default:
+		return c.compileRegisterOperand(node)
+	}
+}
+
+// compileRegisterOperand compiles an operand that must be in a register. The
+// temporary register, if any, is released by the caller.
+func (c *Compiler) compileRegisterOperand(node ast.Expression) (int, error) {
+	if ident, ok := node.(*ast.Identifier); ok {
+		symbol, ok := c.scope().symbolTable.Resolve(ident.Value)
+		if ok && symbol.Scope == compiler.LocalScope {
+			return symbol.Index, nil
+		}
+	}
+
+	reg := c.allocateRegister()
+	err := c.compileExpression(node, reg)
+
+	return reg, err
+}
+
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, dst int) error {
+	symbolTable := compiler.NewEnclosedSymbolTable(c.scope().symbolTable)
+
+	if node.Name != "" {
+		symbolTable.DefineFunctionName(node.Name)
+	}
+
+	for _, p := range node.Parameters {
+		symbolTable.Define(p.Value)
+	}
+
+	numLocals := len(node.Parameters) + countLocals(node.Body)
+	c.scopes = append(c.scopes, &compilationScope{
+		symbolTable:  symbolTable,
+		nextRegister: numLocals,
+		maxRegisters: numLocals,
+	})
+
+	err := c.compileFunctionBody(node.Body)
+	if err != nil {
+		return err
+	}
+
+	scope := c.scope()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+
+	captures := make([]Capture, len(symbolTable.FreeSymbols))
+	for i, s := range symbolTable.FreeSymbols {
+		switch s.Scope {
+		case compiler.LocalScope:
+			captures[i] = Capture{Kind: CaptureLocal, Index: s.Index}
+		case compiler.FreeScope:
+			captures[i] = Capture{Kind: CaptureFree, Index: s.Index}
+		case compiler.FunctionScope:
+			captures[i] = Capture{Kind: CaptureCurrentClosure}
+		default:
+			return diagnostic.New(diagnostic.UncapturedVariable, node.Token, "cannot capture %s variable %s", s.Scope, s.Name)
+		}
+	}
+
+	fn := &Function{
+		Name:          node.Name,
+		Instructions:  scope.instructions,
+		SourceMap:     scope.sourceMap,
+		NumRegisters:  scope.maxRegisters,
+		NumParameters: len(node.Parameters),
+		Captures:      captures,
+	}
+	c.emit(OpClosure, dst, c.addConstant(fn))
+
+	return nil
+}
+
+// compileFunctionBody compiles the body of a function, which returns the
+// value of its last expression statement
+func (c *Compiler) compileFunctionBody(body *ast.BlockStatement) error {
+	if body == nil || len(body.Statements) == 0 {
+		c.emit(OpReturnNull)
+		return nil
+	}
+
+	last := len(body.Statements) - 1
+	for _, s := range body.Statements[:last] {
+		err := c.compileStatement(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	switch s := body.Statements[last].(type) {
+	case *ast.ExpressionStatement:
+		mark := c.scope().nextRegister
+		reg, err := c.compileRegisterOperand(s.Expression)
+		c.freeRegisters(mark)
+		if err != nil {
+			return err
+		}
+		c.emit(OpReturn, reg)
+	case *ast.ReturnStatement:
+		return c.compileStatement(s)
+	default:
+		err := c.compileStatement(s)
+		if err != nil {
+			return err
+		}
+		c.emit(OpReturnNull)
+	}
+
+	return nil
+}
+
+func (c *Compiler) loadSymbol(s compiler.Symbol, dst int) {
+	switch s.Scope {
+	case compiler.GlobalScope:
+		c.emit(OpGetGlobal, dst, s.Index)
+	case compiler.LocalScope:
+		if s.Index != dst {
+			c.emit(OpMove, dst, s.Index)
+		}
+	case compiler.BuiltinScope:
+		c.emit(OpGetBuiltin, dst, s.Index)
+	case compiler.FreeScope:
+		c.emit(OpGetFree, dst, s.Index)
+	case compiler.FunctionScope:
+		c.emit(OpCurrentClosure, dst)
+	}
+}
+
+func (c *Compiler) scope() *compilationScope {
+	return c.scopes[len(c.scopes)-1]
+}
+
+func (c *Compiler) isMainScope() bool {
+	return len(c.scopes) == 1
+}
+
+func (c *Compiler) allocateRegister() int {
+	scope := c.scope()
+
+	reg := scope.nextRegister
+	scope.nextRegister++
+	scope.maxRegisters = max(scope.maxRegisters, scope.nextRegister)
+
+	return reg
+}
+
+func (c *Compiler) freeRegisters(mark int) {
+	c.scope().nextRegister = mark
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op Opcode, operands ...int) int {
+	scope := c.scope()
+	scope.instructions = append(scope.instructions, Make(op, operands...))
+	pos := len(scope.instructions) - 1
+
+	if c.position.line > 0 {
+		scope.sourceMap = scope.sourceMap.Add(pos, c.position.line, c.position.column)
+	}
+
+	return pos
+}
+
+func (c *Compiler) changeJumpTarget(pos int, target int) {
+	ins := &c.scope().instructions[pos]
+
+	switch ins.Op {
+	case OpJump:
+		ins.A = int32(target)
+	case OpJumpNotTruthy:
+		ins.B = int32(target)
+	}
+}
+
+// countLocals counts the locals defined by the let statements of a function
+// body, without the ones of nested functions, so registers for temporaries
+// can be allocated after them
+func countLocals(node ast.Node) int {
+	count := 0
+
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		if node == nil {
+			return 0
+		}
+		for _, s := range node.Statements {
+			count += countLocals(s)
+		}
+	case *ast.LetStatement:
+		count = 1 + countLocals(node.Value)
+	case *ast.ExpressionStatement:
+		count = countLocals(node.Expression)
+	case *ast.ReturnStatement:
+		count = countLocals(node.ReturnValue)
+	case *ast.PrefixExpression:
+		count = countLocals(node.Right)
+	case *ast.InfixExpression:
+		count = countLocals(node.Left) + countLocals(node.Right)
+	case *ast.IfExpression:
+		count = countLocals(node.Condition) + countLocals(node.Consequence) + countLocals(node.Alternative)
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			count += countLocals(el)
+		}
+	case *ast.IndexExpression:
+		count = countLocals(node.Left) + countLocals(node.Index)
+	case *ast.CallExpression:
+		count = countLocals(node.Function)
+		for _, arg := range node.Arguments {
+			count += countLocals(arg)
+		}
+	}
+
+	return count
+}
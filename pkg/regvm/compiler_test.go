@@ -0,0 +1,184 @@
+package regvm
+
+import (
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedInstructions []Instruction
+	expectedFunctions    map[int]*Function
+}
+
+func TestCompileExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "1 + 2",
+			expectedInstructions: []Instruction{
+				Make(OpAdd, 0, constantOperand(0), constantOperand(1)),
+				Make(OpPop, 0),
+			},
+		},
+		{
+			input: "let a = 1; a < 3",
+			expectedInstructions: []Instruction{
+				Make(OpLoadConstant, 0, 0),
+				Make(OpSetGlobal, 0, 0),
+				Make(OpGetGlobal, 1, 0),
+				Make(OpGreaterThan, 0, constantOperand(1), 1),
+				Make(OpPop, 0),
+			},
+		},
+		{
+			input: "if (true) { 10 } else { 20 }",
+			expectedInstructions: []Instruction{
+				Make(OpLoadTrue, 1),
+				Make(OpJumpNotTruthy, 1, 4),
+				Make(OpLoadConstant, 0, 0),
+				Make(OpJump, 5),
+				Make(OpLoadConstant, 0, 1),
+				Make(OpPop, 0),
+			},
+		},
+		{
+			input: "[1, -2][0]",
+			expectedInstructions: []Instruction{
+				Make(OpLoadConstant, 2, 0),
+				Make(OpLoadConstant, 4, 1),
+				Make(OpMinus, 3, 4),
+				Make(OpArray, 1, 2, 2),
+				Make(OpLoadConstant, 2, 2),
+				Make(OpIndex, 0, 1, 2),
+				Make(OpPop, 0),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestCompileFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn(a, b) { let c = a + 1; c * b }(1, 2)",
+			expectedInstructions: []Instruction{
+				Make(OpClosure, 1, 1),
+				Make(OpLoadConstant, 2, 2),
+				Make(OpLoadConstant, 3, 3),
+				Make(OpCall, 0, 1, 2),
+				Make(OpPop, 0),
+			},
+			expectedFunctions: map[int]*Function{
+				1: {
+					Instructions: Instructions{
+						Make(OpAdd, 3, 0, constantOperand(0)),
+						Make(OpMove, 2, 3),
+						Make(OpMul, 3, 2, 1),
+						Make(OpReturn, 3),
+					},
+					NumRegisters:  4,
+					NumParameters: 2,
+				},
+			},
+		},
+		{
+			input: "fn(x) { fn(y) { x + y } }",
+			expectedInstructions: []Instruction{
+				Make(OpClosure, 0, 1),
+				Make(OpPop, 0),
+			},
+			expectedFunctions: map[int]*Function{
+				0: {
+					Instructions: Instructions{
+						Make(OpGetFree, 2, 0),
+						Make(OpAdd, 1, 2, 0),
+						Make(OpReturn, 1),
+					},
+					NumRegisters:  3,
+					NumParameters: 1,
+					Captures:      []Capture{{Kind: CaptureLocal, Index: 0}},
+				},
+				1: {
+					Instructions: Instructions{
+						Make(OpClosure, 1, 0),
+						Make(OpReturn, 1),
+					},
+					NumRegisters:  2,
+					NumParameters: 1,
+				},
+			},
+		},
+		{
+			input: "let f = fn(x) { if (x > 0) { return f(x - 1); } };",
+			expectedInstructions: []Instruction{
+				Make(OpClosure, 0, 2),
+				Make(OpSetGlobal, 0, 0),
+			},
+			expectedFunctions: map[int]*Function{
+				2: {
+					Instructions: Instructions{
+						Make(OpGreaterThan, 2, 0, constantOperand(0)),
+						Make(OpJumpNotTruthy, 2, 7),
+						Make(OpCurrentClosure, 3),
+						Make(OpSub, 4, 0, constantOperand(1)),
+						Make(OpCall, 2, 3, 1),
+						Make(OpReturn, 2),
+						Make(OpJump, 8),
+						Make(OpLoadNull, 1),
+						Make(OpReturn, 1),
+					},
+					NumRegisters:  5,
+					NumParameters: 1,
+				},
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		comp := NewCompiler()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := comp.Bytecode()
+		testInstructions(t, tt.input, tt.expectedInstructions, bytecode.Main.Instructions)
+
+		for index, expected := range tt.expectedFunctions {
+			fn, ok := bytecode.Constants[index].(*Function)
+			if !ok {
+				t.Fatalf("%q: constant %d is not a Function: %T", tt.input, index, bytecode.Constants[index])
+			}
+
+			testInstructions(t, tt.input, expected.Instructions, fn.Instructions)
+
+			if fn.NumRegisters != expected.NumRegisters || fn.NumParameters != expected.NumParameters {
+				t.Errorf("%q: wrong function %d. want registers=%d parameters=%d, got registers=%d parameters=%d",
+					tt.input, index, expected.NumRegisters, expected.NumParameters, fn.NumRegisters, fn.NumParameters)
+			}
+
+			if len(fn.Captures) != len(expected.Captures) {
+				t.Fatalf("%q: wrong captures. want=%v, got=%v", tt.input, expected.Captures, fn.Captures)
+			}
+			for i, capture := range expected.Captures {
+				if fn.Captures[i] != capture {
+					t.Errorf("%q: wrong capture %d. want=%v, got=%v", tt.input, i, capture, fn.Captures[i])
+				}
+			}
+		}
+	}
+}
+
+func testInstructions(t *testing.T, input string, expected, actual Instructions) {
+	t.Helper()
+
+	if expected.String() != actual.String() {
+		t.Errorf("%q: wrong instructions.\nwant=\n%s\ngot=\n%s", input, expected, actual)
+	}
+}
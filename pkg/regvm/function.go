@@ -0,0 +1,57 @@
+package regvm
+
+import (
+	"fmt"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/code"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+)
+
+// CaptureKind tells where a closure finds one of its free variables when it
+// is created.
+type CaptureKind byte
+
+const (
+	// CaptureLocal captures a register of the enclosing frame.
+	CaptureLocal CaptureKind = iota
+	// CaptureFree captures a free variable of the enclosing closure.
+	CaptureFree
+	// CaptureCurrentClosure captures the enclosing closure itself.
+	CaptureCurrentClosure
+)
+
+// Capture describes a free variable of a function.
+type Capture struct {
+	Kind  CaptureKind
+	Index int
+}
+
+// Function is a function compiled for the register machine.
+type Function struct {
+	Instructions  Instructions
+	NumRegisters  int
+	NumParameters int
+	Captures      []Capture
+	// Name is the name the function literal was bound to by a let, if any
+	Name string
+	// SourceMap maps the instructions to the source they were compiled from
+	SourceMap code.SourceMap
+}
+
+// Type type
+func (*Function) Type() object.Type { return object.COMPILED_FUNCTION_OBJ }
+
+// Inspect inspect
+func (fn *Function) Inspect() string { return fmt.Sprintf("Function[%p]", fn) }
+
+// Closure is a function with the free variables it captured.
+type Closure struct {
+	Fn   *Function
+	Free []object.Object
+}
+
+// Type type
+func (*Closure) Type() object.Type { return object.CLOSURE_OBJ }
+
+// Inspect inspect
+func (c *Closure) Inspect() string { return fmt.Sprintf("Closure[%p]", c) }
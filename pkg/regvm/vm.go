@@ -0,0 +1,537 @@
+package regvm
+
+import (
+	"fmt"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+)
+
+// GlobalsSize is the size of the globals.
+const GlobalsSize = 65536
+
+// MaxRegisters is the maximum number of registers of all the active frames.
+const MaxRegisters = 65536
+
+// MaxFrames is the maximum number of frames.
+const MaxFrames = 1024
+
+// initialRegisters is the number of registers allocated when the VM is
+// created, which grow as deeper calls need them
+const initialRegisters = 1024
+
+// Frame is an active function call. Its registers are the window of the
+// register file starting at base.
+type Frame struct {
+	cl   *Closure
+	ip   int
+	base int
+	// ret is the register of the caller the result is stored in, or -1
+	// when the result is returned to the host
+	ret int
+}
+
+// VM is the register based virtual machine. It is not safe for concurrent
+// use.
+type VM struct {
+	constants []object.Object
+	main      *Closure
+
+	registers  []object.Object
+	globals    []object.Object
+	numGlobals int
+
+	frames      []Frame
+	framesIndex int
+
+	lastPopped object.Object
+
+	io *object.IO
+}
+
+// New creates a new VM.
+func New(bytecode *Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobalsStore creates a new VM with a global store. The store is not
+// synchronized, so it can only be reused by VMs running one after the other,
+// as the REPL does.
+func NewWithGlobalsStore(bytecode *Bytecode, globals []object.Object) *VM {
+	vm := &VM{
+		constants: bytecode.Constants,
+		main:      &Closure{Fn: bytecode.Main},
+
+		registers:  make([]object.Object, max(initialRegisters, bytecode.Main.NumRegisters)),
+		globals:    globals,
+		numGlobals: bytecode.NumGlobals,
+
+		frames: make([]Frame, MaxFrames),
+
+		io: object.DefaultIO(),
+	}
+
+	vm.frames[0] = Frame{cl: vm.main, ret: -1}
+	vm.framesIndex = 1
+
+	return vm
+}
+
+// SetIO sets the streams used by the builtins run by the VM.
+func (vm *VM) SetIO(io *object.IO) {
+	vm.io = io
+}
+
+// IO returns the streams used by the builtins run by the VM.
+func (vm *VM) IO() *object.IO {
+	return vm.io
+}
+
+// Fork returns a new VM running the same program, sharing the streams of
+// this one, with its own registers and frames, to run spawned tasks
+// concurrently. As the globals are not synchronized, the new VM gets a copy
+// of them, which tasks only read, as functions set no globals.
+func (vm *VM) Fork() object.ExecutionContext {
+	globals := make([]object.Object, vm.numGlobals)
+	copy(globals, vm.globals)
+
+	forked := NewWithGlobalsStore(
+		&Bytecode{Main: vm.main.Fn, Constants: vm.constants, NumGlobals: vm.numGlobals},
+		globals,
+	)
+	forked.io = vm.io
+
+	return forked
+}
+
+// LastPoppedStackElem returns the value of the last top-level expression or
+// let statement, like the stack VM does, or null if there was none.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	if vm.lastPopped == nil {
+		return object.NULL
+	}
+	return vm.lastPopped
+}
+
+// Run runs the VM. Its errors are diagnostics at the source of the
+// instruction failing.
+func (vm *VM) Run() error {
+	err := vm.run(0)
+	if err != nil {
+		return vm.diagnose(err)
+	}
+	return nil
+}
+
+// maxCallNotes is the number of calls noted in the diagnostics of runtime
+// errors
+const maxCallNotes = 8
+
+// diagnose turns a runtime error into a diagnostic at the source of the
+// instruction of the current frame, noting the calls leading to it. The
+// instruction pointers of the frames are past the instructions they run.
+func (vm *VM) diagnose(err error) error {
+	if _, ok := err.(*diagnostic.Diagnostic); ok {
+		return err
+	}
+
+	frame := vm.frames[vm.framesIndex-1]
+	line, column := frame.cl.Fn.SourceMap.Lookup(frame.ip - 1)
+	d := diagnostic.At(diagnostic.RuntimeError, line, column, "%s", err)
+
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		if len(d.Notes) == maxCallNotes {
+			d.Notes = append(d.Notes, fmt.Sprintf("and %d more calls", i))
+			break
+		}
+
+		name := vm.frames[i].cl.Fn.Name
+		if name == "" {
+			name = "anonymous function"
+		}
+		caller := vm.frames[i-1]
+		line, column := caller.cl.Fn.SourceMap.Lookup(caller.ip - 1)
+		d.Notes = append(d.Notes, fmt.Sprintf("in %s, called at line %d, column %d", name, line, column))
+	}
+
+	return d
+}
+
+// Call calls a closure or builtin, usually one returned by a script, with the
+// given arguments and returns its result.
+func (vm *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	switch fn := fn.(type) {
+	case *Closure:
+		return vm.callClosureFromHost(fn, args)
+	case *object.Builtin:
+		result, err := fn.Fn(vm, args...)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			return object.NULL, nil
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("calling non-function and non-built-in")
+	}
+}
+
+func (vm *VM) callClosureFromHost(cl *Closure, args []object.Object) (object.Object, error) {
+	framesIndex := vm.framesIndex
+	caller := &vm.frames[framesIndex-1]
+
+	// the result is stored in the first register after the caller ones, and
+	// the arguments after it
+	result := caller.base + caller.cl.Fn.NumRegisters
+	for i, arg := range args {
+		err := vm.ensureRegisters(result + 2 + i)
+		if err != nil {
+			return nil, err
+		}
+		vm.registers[result+1+i] = arg
+	}
+
+	err := vm.pushFrame(cl, result+1, len(args), result)
+	if err == nil {
+		err = vm.run(framesIndex)
+	}
+	if err != nil {
+		vm.framesIndex = framesIndex
+		return nil, err
+	}
+
+	return vm.registers[result], nil
+}
+
+// run executes instructions until the frame at the given depth returns, or
+// until the main frame runs out of instructions when depth is 0. The current
+// frame, its instructions and registers are cached in locals and only written
+// back to the frame on calls and errors.
+func (vm *VM) run(depth int) (err error) {
+	frame := &vm.frames[vm.framesIndex-1]
+	instructions := frame.cl.Fn.Instructions
+	registers := vm.registers[frame.base:]
+	ip := frame.ip
+
+	defer func() {
+		if err != nil {
+			frame.ip = ip
+		}
+	}()
+
+	for ip < len(instructions) {
+		ins := instructions[ip]
+		ip++
+
+		switch ins.Op {
+		case OpLoadConstant:
+			registers[ins.A] = vm.constants[ins.B]
+		case OpLoadTrue:
+			registers[ins.A] = object.TRUE
+		case OpLoadFalse:
+			registers[ins.A] = object.FALSE
+		case OpLoadNull:
+			registers[ins.A] = object.NULL
+		case OpMove:
+			registers[ins.A] = registers[ins.B]
+		case OpGetGlobal:
+			registers[ins.A] = vm.globals[ins.B]
+		case OpSetGlobal:
+			// only top-level let statements set globals
+			vm.globals[ins.B] = registers[ins.A]
+			vm.lastPopped = registers[ins.A]
+		case OpGetBuiltin:
+			registers[ins.A] = object.Builtins[ins.B].Builtin
+		case OpGetFree:
+			registers[ins.A] = frame.cl.Free[ins.B]
+		case OpCurrentClosure:
+			registers[ins.A] = frame.cl
+		case OpPop:
+			vm.lastPopped = registers[ins.A]
+
+		case OpAdd, OpSub, OpMul, OpDiv:
+			left := vm.operand(registers, ins.B)
+			right := vm.operand(registers, ins.C)
+
+			result, err := executeBinaryOperation(ins.Op, left, right)
+			if err != nil {
+				return err
+			}
+			registers[ins.A] = result
+		case OpEqual, OpNotEqual, OpGreaterThan:
+			left := vm.operand(registers, ins.B)
+			right := vm.operand(registers, ins.C)
+
+			result, err := executeComparison(ins.Op, left, right)
+			if err != nil {
+				return err
+			}
+			registers[ins.A] = result
+		case OpMinus:
+			operand, ok := registers[ins.B].(*object.Integer)
+			if !ok {
+				return fmt.Errorf("unsupported type for negation: %s", registers[ins.B].Type())
+			}
+			registers[ins.A] = object.NewInteger(-operand.Value)
+		case OpBang:
+			switch registers[ins.B] {
+			case object.FALSE:
+				registers[ins.A] = object.TRUE
+			default:
+				registers[ins.A] = object.FALSE
+			}
+
+		case OpJump:
+			ip = int(ins.A)
+		case OpJumpNotTruthy:
+			if !isTruthy(registers[ins.A]) {
+				ip = int(ins.B)
+			}
+
+		case OpArray:
+			elements := make([]object.Object, ins.C)
+			copy(elements, registers[ins.B:ins.B+ins.C])
+			registers[ins.A] = &object.Array{Elements: elements}
+		case OpIndex:
+			result, err := executeIndexExpression(registers[ins.B], registers[ins.C])
+			if err != nil {
+				return err
+			}
+			registers[ins.A] = result
+
+		case OpCall:
+			frame.ip = ip
+
+			switch callee := registers[ins.B].(type) {
+			case *Closure:
+				base := frame.base + int(ins.B) + 1
+				err := vm.pushFrame(callee, base, int(ins.C), frame.base+int(ins.A))
+				if err != nil {
+					return err
+				}
+			case *object.Builtin:
+				args := registers[ins.B+1 : ins.B+1+ins.C]
+				result, err := callee.Fn(vm, args...)
+				if err != nil {
+					result = &object.Error{Message: err.Error()}
+				} else if result == nil {
+					result = object.NULL
+				}
+				// builtins calling back into the VM may grow the registers
+				vm.registers[frame.base+int(ins.A)] = result
+			default:
+				return fmt.Errorf("calling non-function and non-built-in")
+			}
+
+			frame = &vm.frames[vm.framesIndex-1]
+			instructions = frame.cl.Fn.Instructions
+			registers = vm.registers[frame.base:]
+			ip = frame.ip
+
+		case OpReturn, OpReturnNull:
+			var result object.Object = object.NULL
+			if ins.Op == OpReturn {
+				result = registers[ins.A]
+			}
+
+			vm.framesIndex--
+			if frame.ret < 0 {
+				vm.lastPopped = result
+			} else {
+				vm.registers[frame.ret] = result
+			}
+
+			if vm.framesIndex == depth {
+				return nil
+			}
+
+			frame = &vm.frames[vm.framesIndex-1]
+			instructions = frame.cl.Fn.Instructions
+			registers = vm.registers[frame.base:]
+			ip = frame.ip
+
+		case OpClosure:
+			fn := vm.constants[ins.B].(*Function)
+
+			free := make([]object.Object, len(fn.Captures))
+			for i, capture := range fn.Captures {
+				switch capture.Kind {
+				case CaptureLocal:
+					free[i] = registers[capture.Index]
+				case CaptureFree:
+					free[i] = frame.cl.Free[capture.Index]
+				case CaptureCurrentClosure:
+					free[i] = frame.cl
+				}
+			}
+
+			registers[ins.A] = &Closure{Fn: fn, Free: free}
+
+		default:
+			return fmt.Errorf("opcode %d undefined", ins.Op)
+		}
+	}
+
+	frame.ip = ip
+
+	return nil
+}
+
+// operand returns the value of a RK operand
+func (vm *VM) operand(registers []object.Object, operand int32) object.Object {
+	if operand >= 0 {
+		return registers[operand]
+	}
+
+	return vm.constants[-operand-1]
+}
+
+// pushFrame makes a closure the current frame, with its arguments already
+// stored in the registers starting at base
+func (vm *VM) pushFrame(cl *Closure, base, numArgs, ret int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return fmt.Errorf("wrong number of arguments: want=%d, got=%d",
+			cl.Fn.NumParameters, numArgs)
+	}
+
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+
+	err := vm.ensureRegisters(base + cl.Fn.NumRegisters)
+	if err != nil {
+		return err
+	}
+
+	vm.frames[vm.framesIndex] = Frame{cl: cl, base: base, ret: ret}
+	vm.framesIndex++
+
+	return nil
+}
+
+func (vm *VM) ensureRegisters(size int) error {
+	if size <= len(vm.registers) {
+		return nil
+	}
+
+	if size > MaxRegisters {
+		return fmt.Errorf("stack overflow")
+	}
+
+	registers := make([]object.Object, min(max(size, 2*len(vm.registers)), MaxRegisters))
+	copy(registers, vm.registers)
+	vm.registers = registers
+
+	return nil
+}
+
+func executeBinaryOperation(op Opcode, left, right object.Object) (object.Object, error) {
+	switch left := left.(type) {
+	case *object.Integer:
+		if right, ok := right.(*object.Integer); ok {
+			return executeBinaryIntegerOperation(op, left.Value, right.Value)
+		}
+	case *object.String:
+		if right, ok := right.(*object.String); ok {
+			if op != OpAdd {
+				return nil, fmt.Errorf("unknown string operator: %d", op)
+			}
+			return &object.String{Value: left.Value + right.Value}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported types for binary operation: %s %s", left.Type(), right.Type())
+}
+
+func executeBinaryIntegerOperation(op Opcode, left, right int64) (object.Object, error) {
+	var result int64
+
+	switch op {
+	case OpAdd:
+		result = left + right
+	case OpSub:
+		result = left - right
+	case OpMul:
+		result = left * right
+	case OpDiv:
+		if right == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		result = left / right
+	default:
+		return nil, fmt.Errorf("unknown integer operator: %d", op)
+	}
+
+	return object.NewInteger(result), nil
+}
+
+func executeComparison(op Opcode, left, right object.Object) (object.Object, error) {
+	switch left := left.(type) {
+	case *object.Integer:
+		if right, ok := right.(*object.Integer); ok {
+			switch op {
+			case OpEqual:
+				return nativeBoolToBooleanObject(left.Value == right.Value), nil
+			case OpNotEqual:
+				return nativeBoolToBooleanObject(left.Value != right.Value), nil
+			default:
+				return nativeBoolToBooleanObject(left.Value > right.Value), nil
+			}
+		}
+	case *object.String:
+		if right, ok := right.(*object.String); ok {
+			switch op {
+			case OpEqual:
+				return nativeBoolToBooleanObject(left.Value == right.Value), nil
+			case OpNotEqual:
+				return nativeBoolToBooleanObject(left.Value != right.Value), nil
+			default:
+				return nil, fmt.Errorf("unknown operator: %d", op)
+			}
+		}
+	}
+
+	switch op {
+	case OpEqual:
+		return nativeBoolToBooleanObject(left == right), nil
+	case OpNotEqual:
+		return nativeBoolToBooleanObject(left != right), nil
+	default:
+		return nil, fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
+func executeIndexExpression(left, index object.Object) (object.Object, error) {
+	switch left := left.(type) {
+	case *object.Array:
+		i, ok := index.(*object.Integer)
+		if !ok {
+			break
+		}
+		if i.Value < 0 || i.Value >= int64(len(left.Elements)) {
+			return object.NULL, nil
+		}
+		return left.Elements[i.Value], nil
+	}
+
+	return nil, fmt.Errorf("index operator not supported: %s", left.Type())
+}
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return object.TRUE
+	}
+	return object.FALSE
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.Null:
+		return false
+	default:
+		return true
+	}
+}
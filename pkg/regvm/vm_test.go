@@ -0,0 +1,1002 @@
+package regvm
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
+	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+)
+
+type vmTestCase struct {
+	input    string
+	expected interface{}
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []vmTestCase{
+		{"1", 1},
+		{"2", 2},
+		{"1 + 2", 3},
+		{"1 - 2", -1},
+		{"1 * 2", 2},
+		{"4 / 2", 2},
+		{"50 / 2 * 2 + 10 - 5", 55},
+		{"5 + 5 + 5 + 5 - 10", 10},
+		{"2 * 2 * 2 * 2 * 2", 32},
+		{"5 * 2 + 10", 20},
+		{"5 + 2 * 10", 25},
+		{"5 * (2 + 10)", 60},
+		{"-5", -5},
+		{"-10", -10},
+		{"-50 + 100 + -50", 0},
+		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestBooleanExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"true", true},
+		{"false", false},
+		{"1 < 2", true},
+		{"1 > 2", false},
+		{"1 < 1", false},
+		{"1 > 1", false},
+		{"1 == 1", true},
+		{"1 != 1", false},
+		{"1 == 2", false},
+		{"1 != 2", true},
+		{"true == true", true},
+		{"false == false", true},
+		{"true == false", false},
+		{"true != false", true},
+		{"false != true", true},
+		{"(1 < 2) == true", true},
+		{"(1 < 2) == false", false},
+		{"(1 > 2) == true", false},
+		{"(1 > 2) == false", true},
+		{"!true", false},
+		{"!false", true},
+		{"!5", false},
+		{"!!true", true},
+		{"!!false", false},
+		{"!!5", true},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []vmTestCase{
+		{"if (true) { 10 }", 10},
+		{"if (true) { 10 } else { 20 }", 10},
+		{"if (false) { 10 } else { 20 } ", 20},
+		{"if (1) { 10 }", 10},
+		{"if (1 < 2) { 10 }", 10},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+		{"if (1 > 2) { 10 }", object.NULL},
+		{"if (false) { 10 }", object.NULL},
+		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []vmTestCase{
+		{"let one = 1; one", 1},
+		{"let one = 1; let two = 2; one + two", 3},
+		{"let one = 1; let two = one + one; one + two", 3},
+		{"let one = 1; let one = one + one; one", 2},
+		// like in the stack VM, lets result in the value they bind
+		{"let one = 1;", 1},
+		{"1; let two = fn() { let three = 3; three }();", 3},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestStringExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{`"monkey"`, "monkey"},
+		{`"mon" + "key"`, "monkey"},
+		{`"mon" + "key" + "banana"`, "monkeybanana"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestArrayLiterals(t *testing.T) {
+	tests := []vmTestCase{
+		{"[]", []int{}},
+		{"[1, 2, 3]", []int{1, 2, 3}},
+		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIndexExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][0 + 2]", 3},
+		{"[[1, 1, 1]][0][0]", 1},
+		{"[][0]", object.NULL},
+		{"[1, 2, 3][99]", object.NULL},
+		{"[1][-1]", object.NULL},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithoutArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let fivePlusTen = fn() { 5 + 10; };
+			fivePlusTen();
+			`,
+			expected: 15,
+		},
+		{
+			input: `
+	let one = fn() { 1; };
+	let two = fn() { 2; };
+	one() + two()
+	`,
+			expected: 3,
+		},
+		{
+			input: `
+	let a = fn() { 1 };
+	let b = fn() { a() + 1 };
+	let c = fn() { b() + 1 };
+	c();
+	`,
+			expected: 3,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctionsWithReturnStatement(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let earlyExit = fn() { return 99; 100; };
+			earlyExit();
+			`,
+			expected: 99,
+		},
+		{
+			input: `
+			let earlyExit = fn() { return 99; return 100; };
+			earlyExit();
+			`,
+			expected: 99,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFunctionsWithoutReturnValue(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let noReturn = fn() { };
+			noReturn();
+			`,
+			expected: object.NULL,
+		},
+		{
+			input: `
+			let noReturn = fn() { };
+			let noReturnTwo = fn() { noReturn(); };
+			noReturn();
+			noReturnTwo();
+			`,
+			expected: object.NULL,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestFirstClassFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let returnsOneReturner = fn() {
+				let returnsOne = fn() { 1; };
+				returnsOne;
+		};
+		returnsOneReturner()();
+			`,
+			expected: 1,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let one = fn() { let one = 1; one };
+			one();
+			`,
+			expected: 1,
+		},
+		{
+			input: `
+			let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+			oneAndTwo();
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+			let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+			let threeAndFour = fn() { let three = 3; let four = 4; three + four; };
+			oneAndTwo() + threeAndFour();
+			`,
+			expected: 10,
+		},
+		{
+			input: `
+			let firstFoobar = fn() { let foobar = 50; foobar; };
+			let secondFoobar = fn() { let foobar = 100; foobar; };
+			firstFoobar() + secondFoobar();
+			`,
+			expected: 150,
+		},
+		{
+			input: `
+			let globalSeed = 50;
+			let minusOne = fn() {
+					let num = 1;
+					globalSeed - num;
+			}
+			let minusTwo = fn() {
+					let num = 2;
+					globalSeed - num;
+			}
+			minusOne() + minusTwo();
+			`,
+			expected: 97,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let identity = fn(a) { a; };
+			identity(4);
+			`,
+			expected: 4,
+		},
+		{
+			input: `
+			let sum = fn(a, b) { a + b; };
+			sum(1, 2);
+			`,
+			expected: 3,
+		},
+		{
+			input: `
+	let sum = fn(a, b) {
+			let c = a + b;
+			c;
+	};
+	sum(1, 2);
+	`,
+			expected: 3,
+		},
+		{
+			input: `
+	let sum = fn(a, b) {
+			let c = a + b;
+			c;
+	};
+	sum(1, 2) + sum(3, 4);`,
+			expected: 10,
+		},
+		{
+			input: `
+	let sum = fn(a, b) {
+			let c = a + b;
+			c;
+	};
+	let outer = fn() {
+			sum(1, 2) + sum(3, 4);
+	};
+	outer();
+	`,
+			expected: 10,
+		},
+		// [...]
+		{
+			input: `
+	let globalNum = 10;
+
+	let sum = fn(a, b) {
+			let c = a + b;
+			c + globalNum;
+	};
+
+	let outer = fn() {
+			sum(1, 2) + sum(3, 4) + globalNum;
+	};
+
+	outer() + globalNum;
+	`,
+			expected: 50,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCallingFunctionsWithWrongArguments(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input:    `fn() { 1; }(1);`,
+			expected: `wrong number of arguments: want=0, got=1`,
+		},
+		{
+			input:    `fn(a) { a; }();`,
+			expected: `wrong number of arguments: want=1, got=0`,
+		},
+		{
+			input:    `fn(a, b) { a + b; }(1);`,
+			expected: `wrong number of arguments: want=2, got=1`,
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := NewCompiler()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil {
+			t.Fatalf("expected VM error but resulted in none.")
+		}
+
+		if err.Error() != tt.expected {
+			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
+		}
+	}
+}
+
+func TestSpawnWhileSettingGlobals(t *testing.T) {
+	// the task reads the globals while the VM spawning it sets them, so run
+	// with -race to check they are not shared unsynchronized
+	input := `
+	let x = 0;
+	let read = fn(n) { if (n == 0) { x } else { x; read(n - 1) } };
+	let task = spawn(read, 500);
+	` + strings.Repeat("let x = x + 1;\n", 500) + `
+	wait(task) < x + 1`
+
+	comp := NewCompiler()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, true, vm.LastPoppedStackElem())
+}
+
+func TestRuntimeDiagnostics(t *testing.T) {
+	tests := []struct {
+		input  string
+		line   int
+		column int
+		notes  []string
+	}{
+		{`1 + "a"`, 1, 3, nil},
+		{"let x = 0;\n10 / x", 2, 4, nil},
+		{"let add = fn(a, b) {\n  a + b\n};\nlet twice = fn(f) { f(1) };\ntwice(fn(x) { add(x, true) });", 2, 5, []string{
+			"in add, called at line 5, column 18",
+			"in anonymous function, called at line 4, column 22",
+			"in twice, called at line 5, column 6",
+		}},
+		// errors of calls are found at the call
+		{"let f = fn(a) { a };\nf()", 2, 2, nil},
+		{"let f = fn() { f() }; f();", 1, 17, []string{
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			fmt.Sprintf("and %d more calls", MaxFrames-1-maxCallNotes),
+		}},
+	}
+
+	for _, tt := range tests {
+		comp := NewCompiler()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		d, ok := err.(*diagnostic.Diagnostic)
+		if !ok {
+			t.Fatalf("error of %q is not a diagnostic. got=%T (%v)", tt.input, err, err)
+		}
+
+		if d.Code != diagnostic.RuntimeError || d.Start.Line != tt.line || d.Start.Column != tt.column {
+			t.Errorf("wrong diagnostic for %q. want=%d:%d, got=%s %d:%d",
+				tt.input, tt.line, tt.column, d.Code, d.Start.Line, d.Start.Column)
+		}
+		if strings.Join(d.Notes, "\n") != strings.Join(tt.notes, "\n") {
+			t.Errorf("wrong notes for %q.\nwant=%q\ngot=%q", tt.input, tt.notes, d.Notes)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{
+			`len(1)`,
+			&object.Error{
+				Message: "argument to `len` not supported, got INTEGER",
+			},
+		},
+		{
+			`len("one", "two")`,
+			&object.Error{
+				Message: "wrong number of arguments. got=2, want=1",
+			},
+		},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`puts("hello", "world!")`, object.NULL},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, object.NULL},
+		{
+			`first(1)`,
+			&object.Error{
+				Message: "argument to `first` must be ARRAY, got INTEGER",
+			},
+		},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, object.NULL},
+		{
+			`last(1)`,
+			&object.Error{
+				Message: "argument to `last` must be ARRAY, got INTEGER",
+			},
+		},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, object.NULL},
+		{`push([], 1)`, []int{1}},
+		{
+			`push(1, 1)`,
+			&object.Error{
+				Message: "argument to `push` must be ARRAY, got INTEGER",
+			},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`let y = 10; map([1, 2], fn(x) { x + y })`, []int{11, 12}},
+		{`map([[1], [1, 2]], len)`, []int{1, 2}},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []int{3, 4}},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`reduce([], 7, fn(acc, x) { acc + x })`, 7},
+		{`each([1, 2], fn(x) { x })`, object.NULL},
+		{`sort_by([3, 1, 2], fn(x) { x })`, []int{1, 2, 3}},
+		{`sort_by([3, 1, 2], fn(x) { -x })`, []int{3, 2, 1}},
+		{`sort_by([[1, 2, 3], [1], [1, 2]], len)`, [][]int{{1}, {1, 2}, {1, 2, 3}}},
+		{
+			`let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; map([3, 4], fact)`,
+			[]int{6, 24},
+		},
+		{
+			`map(1, fn(x) { x })`,
+			&object.Error{Message: "argument to `map` must be ARRAY, got INTEGER"},
+		},
+		{
+			`filter([1], 1)`,
+			&object.Error{Message: "second argument to `filter` must be a function, got INTEGER"},
+		},
+		{
+			`map([1], fn(x, y) { x })`,
+			&object.Error{Message: "wrong number of arguments: want=2, got=1"},
+		},
+		{
+			`sort_by([1, 2], fn(x) { true })`,
+			&object.Error{Message: "`sort_by` keys must be all INTEGER or all STRING, got BOOLEAN"},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConcurrencyBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`wait(spawn(fn(a, b) { a + b }, 1, 2))`, 3},
+		{
+			`let square = fn(x) { x * x };
+			wait(map([1, 2, 3], fn(x) { spawn(square, x) }))`,
+			[]int{1, 4, 9},
+		},
+		{
+			`let ch = chan();
+			spawn(fn() { each([1, 2, 3], fn(x) { send(ch, x) }); close(ch) });
+			let sum = fn(acc) { let v = recv(ch); if (v) { sum(acc + v) } else { acc } };
+			sum(0)`,
+			6,
+		},
+		{
+			`let ch = chan(1); send(ch, 5); recv(ch)`,
+			5,
+		},
+		{
+			`let a = chan(); let b = chan(1); send(b, 7); select([a, b])`,
+			[]int{1, 7},
+		},
+		{
+			`let ch = chan(); close(ch); recv(ch)`,
+			object.NULL,
+		},
+		{
+			`wait(spawn(fn() { len(1) }))`,
+			&object.Error{Message: "task failed: argument to `len` not supported, got INTEGER"},
+		},
+		{
+			`let ok = spawn(fn() { 1 });
+			let first = spawn(fn() { first(1) });
+			let second = spawn(fn() { last(1) });
+			wait([ok, first, second])`,
+			&object.Error{Message: "task failed: argument to `first` must be ARRAY, got INTEGER"},
+		},
+		{
+			`let ch = chan(); close(ch); close(ch)`,
+			&object.Error{Message: "close of closed channel"},
+		},
+		{
+			`let ch = chan(1); close(ch); send(ch, 1)`,
+			&object.Error{Message: "send on closed channel"},
+		},
+		{
+			`spawn(1)`,
+			&object.Error{Message: "argument to `spawn` must be a function, got INTEGER"},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIOBuiltins(t *testing.T) {
+	program := parse(`
+	let name = read_line();
+	puts("hello", name);
+	print("a", 1);
+	eprint("oops");
+	let rest = read_all();
+	print(rest);
+	read_line();
+	`)
+
+	comp := NewCompiler()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out, errOut bytes.Buffer
+
+	vm := New(comp.Bytecode())
+	vm.SetIO(object.NewIO(strings.NewReader("monkey\r\nline 2\nline 3"), &out, &errOut))
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if out.String() != "hello\nmonkey\na1line 2\nline 3" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	if errOut.String() != "oops" {
+		t.Errorf("wrong error output. got=%q", errOut.String())
+	}
+
+	if vm.LastPoppedStackElem() != object.NULL {
+		t.Errorf("read_line at end of input is not object.NULL. got=%+v", vm.LastPoppedStackElem())
+	}
+}
+
+func runVmTests(t *testing.T, tests []vmTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		comp := NewCompiler()
+		err := comp.Compile(program)
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err != nil {
+			if err.Error() != tt.expected {
+				t.Fatalf("vm error: %s", err)
+			}
+		}
+
+		stackElem := vm.LastPoppedStackElem()
+
+		testExpectedObject(t, tt.expected, stackElem)
+	}
+}
+
+func testExpectedObject(
+	t *testing.T,
+	expected interface{},
+	actual object.Object,
+) {
+	t.Helper()
+
+	switch expected := expected.(type) {
+	case int:
+		err := testIntegerObject(int64(expected), actual)
+		if err != nil {
+			t.Errorf("testIntegerObject failed: %s", err)
+		}
+	case bool:
+		err := testBooleanObject(bool(expected), actual)
+		if err != nil {
+			t.Errorf("testBooleanObject failed: %s", err)
+		}
+	case *object.Null:
+		if actual != object.NULL {
+			t.Errorf("object is not object.NULL: %T (%+v)", actual, actual)
+		}
+
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d",
+				len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			err := testIntegerObject(int64(expectedElem), array.Elements[i])
+			if err != nil {
+				t.Errorf("testIntegerObject failed: %s", err)
+			}
+		}
+	case [][]int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d",
+				len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			testExpectedObject(t, expectedElem, array.Elements[i])
+		}
+	case *object.Error:
+		errObj, ok := actual.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error: %T (%+v)", actual, actual)
+			return
+		}
+		if errObj.Message != expected.Message {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				expected.Message, errObj.Message)
+		}
+	}
+}
+
+func TestClosures(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let newClosure = fn(a) {
+					fn() { a; };
+			};
+			let closure = newClosure(99);
+			closure();
+			`,
+			expected: 99,
+		},
+		{
+			input: `
+	let newAdder = fn(a, b) {
+			fn(c) { a + b + c };
+	};
+	let adder = newAdder(1, 2);
+	adder(8);
+	`,
+			expected: 11,
+		},
+		{
+			input: `
+	let newAdder = fn(a, b) {
+			let c = a + b;
+			fn(d) { c + d };
+	};
+	let adder = newAdder(1, 2);
+	adder(8);
+	`,
+			expected: 11,
+		},
+		{
+			input: `
+	let newAdderOuter = fn(a, b) {
+			let c = a + b;
+			fn(d) {
+					let e = d + c;
+					fn(f) { e + f; };
+			};
+	};
+	let newAdderInner = newAdderOuter(1, 2)
+	let adder = newAdderInner(3);
+	adder(8);
+	`,
+			expected: 14,
+		},
+		{
+			input: `
+	let a = 1;
+	let newAdderOuter = fn(b) {
+			fn(c) {
+					fn(d) { a + b + c + d };
+			};
+	};
+	let newAdderInner = newAdderOuter(2)
+	let adder = newAdderInner(3);
+	adder(8);
+	`,
+			expected: 14,
+		},
+		{
+			input: `
+	let newClosure = fn(a, b) {
+			let one = fn() { a; };
+			let two = fn() { b; };
+			fn() { one() + two(); };
+	};
+	let closure = newClosure(9, 90);
+	closure();
+	`,
+			expected: 99,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveFunctions(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let countDown = fn(x) {
+					if (x == 0) {
+							return 0;
+					} else {
+							countDown(x - 1);
+					}
+			};
+			countDown(1);
+			`,
+			expected: 0,
+		},
+		{
+			input: `
+	let countDown = fn(x) {
+			if (x == 0) {
+					return 0;
+			} else {
+					countDown(x - 1);
+			}
+	};
+	let wrapper = fn() {
+			countDown(1);
+	};
+	wrapper();
+	`,
+			expected: 0,
+		},
+		{
+			input: `
+	let wrapper = fn() {
+			let countDown = fn(x) {
+					if (x == 0) {
+							return 0;
+					} else {
+							countDown(x - 1);
+					}
+			};
+			countDown(1);
+	};
+	wrapper();
+	`,
+			expected: 0,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestRecursiveFibonacci(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let fibonacci = fn(x) {
+					if (x == 0) {
+							return 0;
+					} else {
+							if (x == 1) {
+									return 1;
+							} else {
+									fibonacci(x - 1) + fibonacci(x - 2);
+							}
+					}
+			};
+			fibonacci(15);
+			`,
+			expected: 610,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestCall(t *testing.T) {
+	program := parse(`
+	let base = 10;
+	let makeAdder = fn(x) { fn(y) { base + x + y } };
+	let add = makeAdder(5);
+	let fail = fn(x) { x() };
+	add;
+	`)
+
+	comp := NewCompiler()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	add, ok := vm.LastPoppedStackElem().(*Closure)
+	if !ok {
+		t.Fatalf("object is not Closure: %T (%+v)", vm.LastPoppedStackElem(), vm.LastPoppedStackElem())
+	}
+
+	for i := int64(0); i < 3; i++ {
+		result, err := vm.Call(add, &object.Integer{Value: i})
+		if err != nil {
+			t.Fatalf("call error: %s", err)
+		}
+
+		err = testIntegerObject(15+i, result)
+		if err != nil {
+			t.Errorf("testIntegerObject failed: %s", err)
+		}
+	}
+
+	if vm.LastPoppedStackElem() != add {
+		t.Errorf("last popped element not restored. got=%+v", vm.LastPoppedStackElem())
+	}
+
+	_, err = vm.Call(add)
+	if err == nil || err.Error() != "wrong number of arguments: want=1, got=0" {
+		t.Errorf("wrong call error. got=%v", err)
+	}
+
+	fail := vm.globals[3].(*Closure)
+	_, err = vm.Call(fail, &object.Integer{Value: 1})
+	if err == nil || err.Error() != "calling non-function and non-built-in" {
+		t.Errorf("wrong call error. got=%v", err)
+	}
+
+	if vm.framesIndex != 1 {
+		t.Errorf("vm state not restored after error. framesIndex=%d", vm.framesIndex)
+	}
+
+	result, err := vm.Call(add, &object.Integer{Value: 1})
+	if err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+
+	err = testIntegerObject(16, result)
+	if err != nil {
+		t.Errorf("testIntegerObject failed: %s", err)
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func testIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d",
+			result.Value, expected)
+	}
+
+	return nil
+}
+
+func testBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not Boolean. got=%T (%+v)",
+			actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%t, want=%t",
+			result.Value, expected)
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/debugger"
+	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+)
+
+// DebugPrompt is the prompt of the debugger
+const DebugPrompt = "(debug) "
+
+const debugHelp = `Commands:
+  break LINE, b LINE   set a breakpoint at LINE
+  clear LINE           remove the breakpoint at LINE
+  breakpoints          list the breakpoints
+  continue, c          run until a breakpoint or the end of the program
+  next, n              step over calls to the next line
+  step, s              step into calls to the next line
+  out, o               step out of the current call
+  backtrace, bt        list the calls being run
+  locals               list the locals of the current call
+  free                 list the free variables of the current call
+  globals              list the globals
+  list                 show the lines around the current one
+  quit, q              stop debugging
+`
+
+// Debug debugs a file with commands read from in, on the stack VM, or on
+// the evaluator when compilation is disabled. The program starts stopped
+// before its first line.
+func Debug(filename string, in io.Reader, out io.Writer, options Options) {
+	f, err := os.ReadFile(filename)
+	if err != nil {
+		panic(err)
+	}
+	source := strings.Split(string(f), "\n")
+
+	p := parser.New(lexer.New(string(f)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(out, p.Diagnostics(), filename, string(f))
+		return
+	}
+	if err := expandMacros(program, object.NewEnvironment()); err != nil {
+		printError(out, err, filename, string(f))
+		return
+	}
+
+	scriptIO := object.NewIO(options.Stdin, out, options.Stderr)
+
+	var d *debugger.Debugger
+	if options.CompileEnabled {
+		d, err = debugger.NewVM(program, scriptIO)
+		if err != nil {
+			printError(out, err, filename, string(f))
+			return
+		}
+	} else {
+		d = debugger.NewEval(program, scriptIO)
+	}
+
+	stop := d.Start()
+	printStop(out, stop, filename, source)
+
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, DebugPrompt)
+		if !scanner.Scan() {
+			return
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "break", "b", "clear":
+			line, err := lineArgument(fields)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			if fields[0] == "clear" {
+				d.ClearBreakpoint(line)
+				fmt.Fprintf(out, "Breakpoint at line %d cleared\n", line)
+			} else {
+				d.SetBreakpoint(line)
+				fmt.Fprintf(out, "Breakpoint at line %d\n", line)
+			}
+		case "breakpoints":
+			for _, line := range d.Breakpoints() {
+				fmt.Fprintf(out, "line %d\n", line)
+			}
+		case "continue", "c":
+			stop = d.Continue()
+			printStop(out, stop, filename, source)
+		case "next", "n":
+			stop = d.StepOver()
+			printStop(out, stop, filename, source)
+		case "step", "s":
+			stop = d.StepInto()
+			printStop(out, stop, filename, source)
+		case "out", "o":
+			stop = d.StepOut()
+			printStop(out, stop, filename, source)
+		case "backtrace", "bt":
+			for i, frame := range d.Frames() {
+				fmt.Fprintf(out, "#%d %s at line %d\n", i, frame.Function, frame.Line)
+			}
+		case "locals", "free":
+			frames := d.Frames()
+			if len(frames) == 0 {
+				fmt.Fprintln(out, "The program is not running")
+				continue
+			}
+			if fields[0] == "locals" {
+				printVariables(out, frames[0].Locals)
+			} else {
+				printVariables(out, frames[0].Free)
+			}
+		case "globals":
+			printVariables(out, d.Globals())
+		case "list":
+			printSource(out, source, stop.Line, 2)
+		case "help", "h":
+			io.WriteString(out, debugHelp)
+		case "quit", "q":
+			return
+		default:
+			fmt.Fprintf(out, "Unknown command %q, type help to list the commands\n", fields[0])
+		}
+	}
+}
+
+func lineArgument(fields []string) (int, error) {
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("usage: %s LINE", fields[0])
+	}
+
+	line, err := strconv.Atoi(fields[1])
+	if err != nil || line < 1 {
+		return 0, fmt.Errorf("invalid line %q", fields[1])
+	}
+
+	return line, nil
+}
+
+func printStop(out io.Writer, stop debugger.Stop, filename string, source []string) {
+	switch {
+	case stop.Reason == debugger.Exited && stop.Err != nil:
+		io.WriteString(out, "Program failed:\n")
+		printError(out, stop.Err, filename, strings.Join(source, "\n"))
+	case stop.Reason == debugger.Exited:
+		fmt.Fprintf(out, "Program exited: %s\n", stop.Result.Inspect())
+	default:
+		fmt.Fprintf(out, "Stopped at line %d (%s)\n", stop.Line, stop.Reason)
+		printSource(out, source, stop.Line, 0)
+	}
+}
+
+// printSource prints the line and the ones around it, marking it
+func printSource(out io.Writer, source []string, line, around int) {
+	for i := max(line-around, 1); i <= min(line+around, len(source)); i++ {
+		marker := " "
+		if i == line {
+			marker = ">"
+		}
+		fmt.Fprintf(out, "%s%4d | %s\n", marker, i, source[i-1])
+	}
+}
+
+func printVariables(out io.Writer, vars []debugger.Variable) {
+	for _, v := range vars {
+		fmt.Fprintf(out, "%s = %s\n", v.Name, v.Value.Inspect())
+	}
+}
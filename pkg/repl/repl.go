@@ -6,11 +6,17 @@ import (
 	"io"
 	"os"
 
+	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
 	"github.com/jalopez/go-monkey-interpreter/pkg/compiler"
+	"github.com/jalopez/go-monkey-interpreter/pkg/coverage"
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
 	interpreter "github.com/jalopez/go-monkey-interpreter/pkg/eval"
+	"github.com/jalopez/go-monkey-interpreter/pkg/format"
 	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
 	"github.com/jalopez/go-monkey-interpreter/pkg/object"
 	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
+	"github.com/jalopez/go-monkey-interpreter/pkg/profile"
+	"github.com/jalopez/go-monkey-interpreter/pkg/regvm"
 	"github.com/jalopez/go-monkey-interpreter/pkg/token"
 	"github.com/jalopez/go-monkey-interpreter/pkg/vm"
 )
@@ -18,16 +24,47 @@ import (
 // PROMPT prompt
 const PROMPT = "> "
 
+// Engines that can run compiled programs
+const (
+	// StackEngine runs programs in the stack based VM
+	StackEngine = "vm"
+	// RegisterEngine runs programs in the register based VM
+	RegisterEngine = "regvm"
+)
+
 // Options options
 type Options struct {
 	Verbose        bool
 	CompileEnabled bool
+	// Engine runs compiled programs, defaults to StackEngine
+	Engine string
+	// Trace writes the instructions run by the stack VM to Stderr
+	Trace bool
+	// Superinstructions makes the compiler of the stack VM fuse common
+	// sequences of instructions, which run faster
+	Superinstructions bool
+	// Profile is the file a pprof profile of the script is written to, with
+	// a report written to Stderr. Only StartFile profiles, with the stack
+	// VM or the evaluator.
+	Profile string
+	// Coverage is the file the LCOV coverage of the script is written to,
+	// with a report written to Stderr. Only StartFile covers scripts, with
+	// the stack VM or the evaluator.
+	Coverage string
+
+	// Stdin is read by the read_line and read_all builtins, defaults to os.Stdin
+	Stdin io.Reader
+	// Stderr is written by the eprint builtin, defaults to os.Stderr
+	Stderr io.Writer
 }
 
 // Start starts the REPL
 func Start(in io.Reader, out io.Writer, options Options) {
 	scanner := bufio.NewScanner(in)
+	scriptIO := object.NewIO(options.Stdin, out, options.Stderr)
 	env := object.NewEnvironment()
+	env.SetIO(scriptIO)
+	macros := object.NewEnvironment()
 
 	constants := []object.Object{}
 	globals := make([]object.Object, vm.GlobalsSize)
@@ -56,55 +93,95 @@ func Start(in io.Reader, out io.Writer, options Options) {
 			if options.Verbose {
 				printLexerTokens(out, line)
 			}
-			printParserErrors(out, p.Errors())
+			printParserErrors(out, p.Diagnostics(), "", line)
+			continue
+		}
+
+		if err := expandMacros(program, macros); err != nil {
+			printError(out, err, "", line)
 			continue
 		}
 
 		if options.CompileEnabled {
-			comp := compiler.NewWithState(symbolTable, constants)
-			err := comp.Compile(program)
-			if err != nil {
-				fmt.Fprintf(out, "Compilation failed:\n %s\n", err)
-				continue
-			}
+			var (
+				result       object.Object
+				instructions fmt.Stringer
+			)
+
+			if options.Engine == RegisterEngine {
+				comp := regvm.NewCompilerWithState(symbolTable, constants)
+				err := comp.Compile(program)
+				if err != nil {
+					printError(out, err, "", line)
+					continue
+				}
 
-			code := comp.Bytecode()
-			constants = code.Constants
+				code := comp.Bytecode()
+				constants = code.Constants
+				instructions = code.Main.Instructions
 
-			machine := vm.NewWithGlobalsStore(code, globals)
-			err = machine.Run()
-			if err != nil {
-				fmt.Fprintf(out, "Executing bytecode failed:\n %s\n", err)
-				continue
+				machine := regvm.NewWithGlobalsStore(code, globals)
+				machine.SetIO(scriptIO)
+				err = machine.Run()
+				if err != nil {
+					printError(out, err, "", line)
+					continue
+				}
+
+				result = machine.LastPoppedStackElem()
+			} else {
+				comp := compiler.NewWithState(symbolTable, constants)
+				if options.Superinstructions {
+					comp.EnableSuperinstructions()
+				}
+				err := comp.Compile(program)
+				if err != nil {
+					printError(out, err, "", line)
+					continue
+				}
+
+				code := comp.Bytecode()
+				constants = code.Constants
+				instructions = code.Instructions
+
+				machine := vm.NewWithGlobalsStore(code, globals)
+				machine.SetIO(scriptIO)
+				if options.Trace {
+					machine.SetTracer(vm.NewTextTracer(scriptIO.Err))
+				}
+				err = machine.Run()
+				if err != nil {
+					printError(out, err, "", line)
+					continue
+				}
+
+				result = machine.LastPoppedStackElem()
 			}
 
-			stackTop := machine.LastPoppedStackElem()
-			io.WriteString(out, stackTop.Inspect())
-			io.WriteString(out, "\n")
+			printResult(out, result, "", line)
 
 			if options.Verbose {
 				io.WriteString(out, "----DEBUG\n")
+				io.WriteString(out, "Expanded:\n")
+				io.WriteString(out, format.Node(program))
 				io.WriteString(out, "Constants:\n")
 				for i, constant := range constants {
 					io.WriteString(out, fmt.Sprintf("%d: %s\n", i, constant.Inspect()))
 				}
 				io.WriteString(out, "Instructions:\n")
-				io.WriteString(out, comp.Bytecode().Instructions.String())
+				io.WriteString(out, instructions.String())
 			}
 		} else {
-			result := interpreter.Eval(program, env)
-			if result != nil {
-				io.WriteString(out, result.Inspect())
-				io.WriteString(out, "\n")
-			} else {
-				io.WriteString(out, "nil\n")
-			}
+			printResult(out, interpreter.Eval(program, env), "", line)
 
 			if options.Verbose {
 				io.WriteString(out, "----DEBUG\n")
 
 				printLexerTokens(out, line)
 
+				io.WriteString(out, " EXPANDED:\n")
+				io.WriteString(out, format.Node(program))
+
 				io.WriteString(out, " AST:\n")
 
 				_, err := fmt.Fprintf(out, "%s\n", program.ToJSON())
@@ -119,7 +196,9 @@ func Start(in io.Reader, out io.Writer, options Options) {
 
 // StartFile reads a file and executes it
 func StartFile(filename string, out io.Writer, options Options) {
+	scriptIO := object.NewIO(options.Stdin, out, options.Stderr)
 	env := object.NewEnvironment()
+	env.SetIO(scriptIO)
 
 	f, err := os.ReadFile(filename)
 	if err != nil {
@@ -136,45 +215,129 @@ func StartFile(filename string, out io.Writer, options Options) {
 		if options.Verbose {
 			printLexerTokens(out, fileContent)
 		}
-		printParserErrors(out, p.Errors())
+		printParserErrors(out, p.Diagnostics(), filename, fileContent)
+		return
+	}
+
+	if err := expandMacros(program, object.NewEnvironment()); err != nil {
+		printError(out, err, filename, fileContent)
+		return
+	}
+
+	// the engines have a single tracer, which tracing, profiling and
+	// coverage cannot share
+	if tracers(options) > 1 {
+		io.WriteString(out, "Only one of tracing, profiling and coverage can be enabled\n")
+		return
+	}
+	if (options.Profile != "" || options.Coverage != "") && options.CompileEnabled && options.Engine == RegisterEngine {
+		io.WriteString(out, "Profiling and coverage are only supported by the stack VM and the evaluator\n")
 		return
 	}
 
-	if options.CompileEnabled {
+	var profiler *profile.Profiler
+	if options.Profile != "" {
+		profiler = profile.New(filename, profile.DefaultInterval)
+	}
+	var cover *coverage.Coverage
+	if options.Coverage != "" {
+		cover = coverage.New(filename, fileContent, program)
+	}
+
+	if options.CompileEnabled && options.Engine == RegisterEngine {
+		comp := regvm.NewCompiler()
+		err := comp.Compile(program)
+		if err != nil {
+			printError(out, err, filename, fileContent)
+			return
+		}
+
+		machine := regvm.New(comp.Bytecode())
+		machine.SetIO(scriptIO)
+		err = machine.Run()
+		if err != nil {
+			printError(out, err, filename, fileContent)
+			return
+		}
+
+		printResult(out, machine.LastPoppedStackElem(), filename, fileContent)
+
+		if options.Verbose {
+			io.WriteString(out, "----DEBUG\n")
+			io.WriteString(out, "Expanded:\n")
+			io.WriteString(out, format.Node(program))
+			io.WriteString(out, comp.Bytecode().Main.Instructions.String())
+		}
+	} else if options.CompileEnabled {
 		comp := compiler.New()
+		if options.Superinstructions {
+			comp.EnableSuperinstructions()
+		}
 		err := comp.Compile(program)
 		if err != nil {
-			fmt.Fprintf(out, "Compilation failed:\n %s\n", err)
+			printError(out, err, filename, fileContent)
+			return
 		}
 
 		machine := vm.New(comp.Bytecode())
+		machine.SetIO(scriptIO)
+		// VMs have a single tracer, so at most one of them is enabled
+		switch {
+		case options.Trace:
+			machine.SetTracer(vm.NewTextTracer(scriptIO.Err))
+		case profiler != nil:
+			machine.SetTracer(profiler.VMTracer())
+			profiler.Start()
+		case cover != nil:
+			machine.SetTracer(cover.VMTracer())
+		}
 		err = machine.Run()
+		if profiler != nil {
+			profiler.Stop()
+			writeProfile(profiler, out, scriptIO, options)
+		}
+		if cover != nil {
+			writeCoverage(cover, out, scriptIO, options)
+		}
 		if err != nil {
-			fmt.Fprintf(out, "Executing bytecode failed:\n %s\n", err)
+			printError(out, err, filename, fileContent)
+			return
 		}
 
-		stackTop := machine.LastPoppedStackElem()
-		io.WriteString(out, stackTop.Inspect())
-		io.WriteString(out, "\n")
+		printResult(out, machine.LastPoppedStackElem(), filename, fileContent)
 
 		if options.Verbose {
 			io.WriteString(out, "----DEBUG\n")
+			io.WriteString(out, "Expanded:\n")
+			io.WriteString(out, format.Node(program))
 			io.WriteString(out, comp.Bytecode().Instructions.String())
 		}
 	} else {
+		switch {
+		case profiler != nil:
+			env.SetTracer(profiler.EvalTracer())
+			profiler.Start()
+		case cover != nil:
+			env.SetTracer(cover.EvalTracer())
+		}
 		result := interpreter.Eval(program, env)
-		if result != nil {
-			io.WriteString(out, result.Inspect())
-			io.WriteString(out, "\n")
-		} else {
-			io.WriteString(out, "nil\n")
+		if profiler != nil {
+			profiler.Stop()
+			writeProfile(profiler, out, scriptIO, options)
+		}
+		if cover != nil {
+			writeCoverage(cover, out, scriptIO, options)
 		}
+		printResult(out, result, filename, fileContent)
 
 		if options.Verbose {
 			io.WriteString(out, "----DEBUG\n")
 
 			printLexerTokens(out, fileContent)
 
+			io.WriteString(out, " EXPANDED:\n")
+			io.WriteString(out, format.Node(program))
+
 			io.WriteString(out, " AST:\n")
 
 			_, err := fmt.Fprintf(out, "%s\n", program.ToJSON())
@@ -185,9 +348,91 @@ func StartFile(filename string, out io.Writer, options Options) {
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	for _, msg := range errors {
-		io.WriteString(out, "Error: "+msg+"\n")
+// expandMacros binds the macros defined by a program in macros, and expands
+// their calls in it
+func expandMacros(program *ast.Program, macros *object.Environment) error {
+	interpreter.DefineMacros(program, macros)
+	return interpreter.ExpandMacros(program, macros)
+}
+
+// writeProfile writes the report of the profiler to Stderr and the profile
+// to its file
+func writeProfile(profiler *profile.Profiler, out io.Writer, scriptIO *object.IO, options Options) {
+	err := profiler.WriteReport(scriptIO.Err, 10)
+	if err != nil {
+		fmt.Fprintf(out, "Writing profile report failed:\n %s\n", err)
+	}
+
+	f, err := os.Create(options.Profile)
+	if err == nil {
+		err = profiler.WritePprof(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Writing profile failed:\n %s\n", err)
+	}
+}
+
+// writeCoverage writes the coverage report to Stderr and the LCOV coverage
+// to its file
+func writeCoverage(cover *coverage.Coverage, out io.Writer, scriptIO *object.IO, options Options) {
+	err := cover.WriteText(scriptIO.Err)
+	if err != nil {
+		fmt.Fprintf(out, "Writing coverage report failed:\n %s\n", err)
+	}
+
+	f, err := os.Create(options.Coverage)
+	if err == nil {
+		err = cover.WriteLCOV(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Writing coverage failed:\n %s\n", err)
+	}
+}
+
+// tracers returns the number of tracers of the script enabled
+func tracers(options Options) int {
+	n := 0
+	for _, enabled := range []bool{options.Trace, options.Profile != "", options.Coverage != ""} {
+		if enabled {
+			n++
+		}
+	}
+	return n
+}
+
+func printParserErrors(out io.Writer, diagnostics []*diagnostic.Diagnostic, filename, source string) {
+	for _, d := range diagnostics {
+		io.WriteString(out, d.Render(filename, source))
+	}
+}
+
+// printError writes an error of the compilers or the runtimes, rendered with
+// the source it is found in when it is a diagnostic
+func printError(out io.Writer, err error, filename, source string) {
+	d, ok := err.(*diagnostic.Diagnostic)
+	if !ok {
+		d = diagnostic.At(diagnostic.RuntimeError, 0, 0, "%s", err)
+	}
+	io.WriteString(out, d.Render(filename, source))
+}
+
+// printResult writes the result of running a program, rendering errors with
+// the source they are found in
+func printResult(out io.Writer, result object.Object, filename, source string) {
+	switch result := result.(type) {
+	case nil:
+		io.WriteString(out, "nil\n")
+	case *object.Error:
+		io.WriteString(out, result.Diagnostic().Render(filename, source))
+	default:
+		io.WriteString(out, result.Inspect())
+		io.WriteString(out, "\n")
 	}
 }
 
@@ -0,0 +1,446 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var engineOptions = []Options{
+	{CompileEnabled: true},
+	{CompileEnabled: true, Superinstructions: true},
+	{CompileEnabled: true, Engine: RegisterEngine},
+	{CompileEnabled: false},
+}
+
+func TestStartWritesBuiltinOutput(t *testing.T) {
+	for _, options := range engineOptions {
+		var out bytes.Buffer
+
+		in := strings.NewReader("puts(read_line())\nlet x = 2;\nx * 3\n")
+		options.Stdin = strings.NewReader("hello\n")
+		Start(in, &out, options)
+
+		expected := "> hello\nnull\n> "
+		if !strings.HasPrefix(out.String(), expected) {
+			t.Errorf("wrong output (engine=%q, compile=%t). want prefix=%q, got=%q", options.Engine, options.CompileEnabled, expected, out.String())
+		}
+
+		if !strings.Contains(out.String(), "> 6\n") {
+			t.Errorf("missing result (engine=%q, compile=%t). got=%q", options.Engine, options.CompileEnabled, out.String())
+		}
+	}
+}
+
+func TestStartFileWritesBuiltinOutput(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "script.monkey")
+
+	err := os.WriteFile(filename, []byte(`print("a", "b"); eprint("c"); 1`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, options := range engineOptions {
+		var out, errOut bytes.Buffer
+
+		options.Stderr = &errOut
+		StartFile(filename, &out, options)
+
+		if out.String() != "ab1\n" {
+			t.Errorf("wrong output (engine=%q, compile=%t). got=%q", options.Engine, options.CompileEnabled, out.String())
+		}
+
+		if errOut.String() != "c" {
+			t.Errorf("wrong error output (engine=%q, compile=%t). got=%q", options.Engine, options.CompileEnabled, errOut.String())
+		}
+	}
+}
+
+func TestStartFileDiagnostics(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = 1;\nlet y x;",
+			"error[E0001]: expected =, got IDENT instead\n" +
+				" --> script.monkey:2:7\n" +
+				"  |\n" +
+				"2 | let y x;\n" +
+				"  |       ^\n",
+		},
+		{
+			"let x = 1;\nx + -true;",
+			"error[E0201]: unknown operator: -BOOLEAN\n" +
+				" --> script.monkey:2:5\n" +
+				"  |\n" +
+				"2 | x + -true;\n" +
+				"  |     ^\n",
+		},
+	}
+
+	filename := filepath.Join(t.TempDir(), "script.monkey")
+	for _, tt := range tests {
+		err := os.WriteFile(filename, []byte(tt.input), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		StartFile(filename, &out, Options{CompileEnabled: false})
+
+		expected := strings.ReplaceAll(tt.expected, "script.monkey", filename)
+		if out.String() != expected {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot=%q", tt.input, expected, out.String())
+		}
+	}
+}
+
+func TestStartFileErrors(t *testing.T) {
+	// compiled scripts failing print their error, and neither run nor
+	// print a result
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"puts(1);\nfoo",
+			"error[E0101]: undefined variable foo\n" +
+				" --> script.monkey:2:1\n" +
+				"  |\n" +
+				"2 | foo\n" +
+				"  | ^^^\n",
+		},
+		{
+			"let x = 1;\nx + -true;",
+			"error[E0201]: unsupported type for negation: BOOLEAN\n" +
+				" --> script.monkey:2:5\n" +
+				"  |\n" +
+				"2 | x + -true;\n" +
+				"  |     ^\n",
+		},
+	}
+
+	filename := filepath.Join(t.TempDir(), "script.monkey")
+	for _, tt := range tests {
+		err := os.WriteFile(filename, []byte(tt.input), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, options := range engineOptions {
+			if !options.CompileEnabled {
+				continue
+			}
+
+			var out bytes.Buffer
+			StartFile(filename, &out, options)
+
+			expected := strings.ReplaceAll(tt.expected, "script.monkey", filename)
+			if out.String() != expected {
+				t.Errorf("wrong output for %q (engine=%q).\nwant=%q\ngot=%q", tt.input, options.Engine, expected, out.String())
+			}
+		}
+	}
+}
+
+func TestStartPrintsLets(t *testing.T) {
+	// both VMs print the value bound
+	for _, options := range engineOptions {
+		if !options.CompileEnabled {
+			continue
+		}
+
+		var out bytes.Buffer
+		Start(strings.NewReader("let x = 2;\n"), &out, options)
+
+		if out.String() != "> 2\n> " {
+			t.Errorf("wrong output (engine=%q). got=%q", options.Engine, out.String())
+		}
+	}
+}
+
+func TestStartDiagnostics(t *testing.T) {
+	// compiled programs fail to compile, evaluated ones to run
+	expected := map[bool]string{
+		true: "> error[E0101]: undefined variable foo\n" +
+			" --> 1:5\n" +
+			"  |\n" +
+			"1 | 1 + foo\n" +
+			"  |     ^^^\n" +
+			"> ",
+		false: "> error[E0201]: identifier not found: foo\n" +
+			" --> 1:5\n" +
+			"  |\n" +
+			"1 | 1 + foo\n" +
+			"  |     ^\n" +
+			"> ",
+	}
+
+	for _, options := range engineOptions {
+		var out bytes.Buffer
+		Start(strings.NewReader("1 + foo\n"), &out, options)
+
+		if out.String() != expected[options.CompileEnabled] {
+			t.Errorf("wrong output (engine=%q, compile=%t).\nwant=%q\ngot=%q",
+				options.Engine, options.CompileEnabled, expected[options.CompileEnabled], out.String())
+		}
+	}
+}
+
+func TestStartFileMacros(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "script.monkey")
+
+	script := `
+let unless = macro(condition, consequence, alternative) {
+  quote(if (!(unquote(condition))) { unquote(consequence) } else { unquote(alternative) })
+};
+let swap = macro(a, b) { quote(fn(tmp) { let x = tmp; [unquote(b), unquote(a), x] }(0)) };
+let x = 1;
+let tmp = 2;
+puts(unless(10 > 5, "not greater", "greater"));
+swap(x, tmp)
+`
+	err := os.WriteFile(filename, []byte(script), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, options := range engineOptions {
+		var out bytes.Buffer
+		StartFile(filename, &out, options)
+
+		if out.String() != "greater\n[2,1,0]\n" {
+			t.Errorf("wrong output (engine=%q, compile=%t). got=%q", options.Engine, options.CompileEnabled, out.String())
+		}
+	}
+}
+
+func TestStartFileQuote(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "script.monkey")
+
+	err := os.WriteFile(filename, []byte("quote(1 + 2)"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "error[E0104]: quote can only be used in macros\n" +
+		" --> " + filename + ":1:1\n" +
+		"  |\n" +
+		"1 | quote(1 + 2)\n" +
+		"  | ^^^^^\n"
+
+	for _, options := range engineOptions {
+		var out bytes.Buffer
+		StartFile(filename, &out, options)
+
+		if out.String() != expected {
+			t.Errorf("wrong output (engine=%q, compile=%t).\nwant=%q\ngot=%q", options.Engine, options.CompileEnabled, expected, out.String())
+		}
+	}
+}
+
+func TestStartMacros(t *testing.T) {
+	in := "let twice = macro(e) { quote(unquote(e) + unquote(e)) };\ntwice(2 * 3)\n"
+
+	for _, options := range engineOptions {
+		var out bytes.Buffer
+		options.Verbose = true
+		Start(strings.NewReader(in), &out, options)
+
+		if !strings.Contains(out.String(), "> 12\n") {
+			t.Errorf("missing result (engine=%q, compile=%t). got=%q", options.Engine, options.CompileEnabled, out.String())
+		}
+		if !strings.Contains(out.String(), "2 * 3 + 2 * 3;\n") {
+			t.Errorf("missing expanded program (engine=%q, compile=%t). got=%q", options.Engine, options.CompileEnabled, out.String())
+		}
+	}
+}
+
+func TestStartFileTrace(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "script.monkey")
+
+	err := os.WriteFile(filename, []byte(`1 + 2`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	StartFile(filename, &out, Options{CompileEnabled: true, Trace: true, Stderr: &errOut})
+
+	if out.String() != "3\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	for _, instruction := range []string{"0000 OpConstant 0", "0006 OpAdd", "0007 OpPop"} {
+		if !strings.Contains(errOut.String(), instruction) {
+			t.Errorf("missing %q in trace. got=%q", instruction, errOut.String())
+		}
+	}
+}
+
+func TestStartFileProfile(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "script.monkey")
+	profileFile := filepath.Join(dir, "profile.pb.gz")
+
+	err := os.WriteFile(filename, []byte("let double = fn(x) { x * 2 };\ndouble(2)"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, compileEnabled := range []bool{true, false} {
+		var out, errOut bytes.Buffer
+		StartFile(filename, &out, Options{CompileEnabled: compileEnabled, Profile: profileFile, Stderr: &errOut})
+
+		if out.String() != "4\n" {
+			t.Errorf("wrong output. got=%q", out.String())
+		}
+		if !strings.Contains(errOut.String(), "double "+filename+":1") {
+			t.Errorf("missing double in report. got=%q", errOut.String())
+		}
+
+		info, err := os.Stat(profileFile)
+		if err != nil || info.Size() == 0 {
+			t.Errorf("profile not written: %v", err)
+		}
+	}
+}
+
+func TestStartFileCoverage(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "script.monkey")
+	coverageFile := filepath.Join(dir, "coverage.info")
+
+	err := os.WriteFile(filename, []byte("let f = fn(x) { if (x) { 1 } else { 2 } };\nf(true)"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, compileEnabled := range []bool{true, false} {
+		var out, errOut bytes.Buffer
+		StartFile(filename, &out, Options{CompileEnabled: compileEnabled, Coverage: coverageFile, Stderr: &errOut})
+
+		if out.String() != "1\n" {
+			t.Errorf("wrong output. got=%q", out.String())
+		}
+		if !strings.Contains(errOut.String(), "100.0% of lines, 80.0% of statements, 50.0% of branches") {
+			t.Errorf("wrong coverage report. got=%q", errOut.String())
+		}
+
+		lcov, err := os.ReadFile(coverageFile)
+		if err != nil || !strings.Contains(string(lcov), "BRDA:1,0,1,0\n") {
+			t.Errorf("wrong LCOV coverage written: %q, %v", lcov, err)
+		}
+	}
+
+}
+
+func TestStartFileTracers(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "script.monkey")
+	coverageFile := filepath.Join(dir, "coverage.info")
+	profileFile := filepath.Join(dir, "profile.pb.gz")
+
+	err := os.WriteFile(filename, []byte("1 + 2"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	combinations := []Options{
+		{Coverage: coverageFile, Profile: profileFile},
+		{Trace: true, Profile: profileFile},
+		{Trace: true, Coverage: coverageFile},
+		{Trace: true, Coverage: coverageFile, Profile: profileFile},
+	}
+
+	for _, combination := range combinations {
+		for _, options := range engineOptions {
+			options.Trace = combination.Trace
+			options.Profile = combination.Profile
+			options.Coverage = combination.Coverage
+
+			var out, errOut bytes.Buffer
+			options.Stderr = &errOut
+			StartFile(filename, &out, options)
+
+			if out.String() != "Only one of tracing, profiling and coverage can be enabled\n" || errOut.Len() != 0 {
+				t.Errorf("combination %+v not rejected (engine=%q, compile=%t). got=%q, %q",
+					combination, options.Engine, options.CompileEnabled, out.String(), errOut.String())
+			}
+		}
+	}
+
+	for _, name := range []string{coverageFile, profileFile} {
+		if _, err := os.Stat(name); err == nil {
+			t.Errorf("%s written", name)
+		}
+	}
+}
+
+func TestDebug(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "script.monkey")
+
+	err := os.WriteFile(filename, []byte("let double = fn(x) {\n  x * 2\n};\nlet y = double(2);\ny"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commands := "break 2\ncontinue\nbt\nlocals\nout\nnext\nlist\nc\n"
+	expected := `Stopped at line 1 (entry)
+>   1 | let double = fn(x) {
+(debug) Breakpoint at line 2
+(debug) Stopped at line 2 (breakpoint)
+>   2 |   x * 2
+(debug) #0 double at line 2
+#1 main at line 4
+(debug) x = 2
+(debug) Stopped at line 4 (step)
+>   4 | let y = double(2);
+(debug) Stopped at line 5 (step)
+>   5 | y
+(debug)     3 | };
+    4 | let y = double(2);
+>   5 | y
+(debug) Program exited: 4
+(debug) `
+
+	for _, compileEnabled := range []bool{true, false} {
+		var out bytes.Buffer
+		Debug(filename, strings.NewReader(commands), &out, Options{CompileEnabled: compileEnabled})
+
+		if out.String() != expected {
+			t.Errorf("wrong output (compile=%t).\nwant=%q\ngot=%q", compileEnabled, expected, out.String())
+		}
+	}
+}
+
+func TestDebugRuntimeError(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "script.monkey")
+
+	err := os.WriteFile(filename, []byte("let x = 0;\n10 / x"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Stopped at line 1 (entry)\n" +
+		">   1 | let x = 0;\n" +
+		"(debug) Program failed:\n" +
+		"error[E0201]: division by zero\n" +
+		" --> " + filename + ":2:4\n" +
+		"  |\n" +
+		"2 | 10 / x\n" +
+		"  |    ^\n" +
+		"(debug) "
+
+	for _, compileEnabled := range []bool{true, false} {
+		var out bytes.Buffer
+		Debug(filename, strings.NewReader("c\n"), &out, Options{CompileEnabled: compileEnabled})
+
+		if out.String() != expected {
+			t.Errorf("wrong output (compile=%t).\nwant=%q\ngot=%q", compileEnabled, expected, out.String())
+		}
+	}
+}
@@ -5,10 +5,20 @@ type Type string
 
 // Token token
 type Token struct {
-	Type    Type
-	Literal string
-	Line    int // line number where the token is located
-	Column  int // column number where the first char of the token is located
+	Type    Type   `json:"type"`
+	Literal string `json:"literal"`
+	Line    int    `json:"line"`   // line number where the token is located
+	Column  int    `json:"column"` // column number where the first char of the token is located
+}
+
+// Comment is a line comment, which the parser skips and the lexer keeps as
+// trivia
+type Comment struct {
+	Text   string // the comment, including the leading //
+	Line   int
+	Column int
+	// Trailing is set when the comment follows a token on its line
+	Trailing bool
 }
 
 // All types of tokens
@@ -53,6 +63,7 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	MACRO    = "MACRO"
 )
 
 var keywords = map[string]Type{
@@ -63,6 +74,7 @@ var keywords = map[string]Type{
 	"if":     IF,
 	"else":   ELSE,
 	"return": RETURN,
+	"macro":  MACRO,
 }
 
 // LookupIdent lookup identifier
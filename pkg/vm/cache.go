@@ -0,0 +1,92 @@
+package vm
+
+import (
+	"github.com/jalopez/go-monkey-interpreter/pkg/code"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+)
+
+// inlineCache remembers what an instruction found the last time it ran, so
+// the next runs can skip the lookups and checks when it finds the same.
+type inlineCache struct {
+	// callee is the object last called by an OpCall, either closure or
+	// builtin, with the arguments already checked
+	callee  object.Object
+	closure *object.Closure
+	builtin *object.Builtin
+	// calleeCache holds the caches of the closure function
+	calleeCache *functionCache
+
+	// value is the shared global read by an OpGetGlobal when the globals
+	// were at version globalVersion-1, zero meaning empty
+	value         object.Object
+	globalVersion uint64
+}
+
+// functionCache holds the inline caches of the instructions of a function.
+// Caches are owned by a VM, while the sites of a function are shared by all
+// the VMs running its program.
+type functionCache struct {
+	sites  []int32
+	caches []inlineCache
+}
+
+// at returns the cache of the instruction at position ip
+func (c *functionCache) at(ip int) *inlineCache {
+	return &c.caches[c.sites[ip]]
+}
+
+// callSites are the positions of the cached instructions of a function
+type callSites struct {
+	// sites maps the position of every cached instruction to the index of
+	// its cache, or -1
+	sites []int32
+	count int
+}
+
+// findCallSites finds the instructions of a function looking up globals or
+// callees
+func findCallSites(ins code.Instructions) callSites {
+	sites := make([]int32, len(ins))
+	for i := range sites {
+		sites[i] = -1
+	}
+
+	count := 0
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			panic(err)
+		}
+
+		switch code.Opcode(ins[i]) {
+		case code.OpCall, code.OpGetGlobal:
+			sites[i] = int32(count)
+			count++
+		}
+
+		_, read := code.ReadOperands(def, ins[i+1:])
+		i += 1 + read
+	}
+
+	return callSites{sites: sites, count: count}
+}
+
+// functionCache returns the caches of the function in this VM, creating
+// them on its first call
+func (vm *VM) functionCache(fn *object.CompiledFunction) *functionCache {
+	cache, ok := vm.caches[fn]
+	if ok {
+		return cache
+	}
+
+	sites, ok := vm.program.callSites[fn]
+	if !ok {
+		// functions of other programs, called from the host
+		sites = findCallSites(fn.Instructions)
+	}
+
+	cache = &functionCache{sites: sites.sites, caches: make([]inlineCache, sites.count)}
+	vm.caches[fn] = cache
+
+	return cache
+}
@@ -0,0 +1,119 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/compiler"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+)
+
+func TestInlineCacheChangingCallees(t *testing.T) {
+	tests := []vmTestCase{
+		{
+			input: `
+			let apply = fn(f, x) { f(x) };
+			[apply(fn(x) { x + 1 }, 1), apply(len, [1, 2]), apply(fn(x) { x * 3 }, 2), apply(len, "")]
+			`,
+			expected: []int{2, 2, 6, 0},
+		},
+		{
+			input: `
+			let makeAdder = fn(n) { fn(x) { x + n } };
+			let apply = fn(f, x) { f(x) };
+			apply(makeAdder(1), 1) + apply(makeAdder(10), 1)
+			`,
+			expected: 13,
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestInlineCacheChecksArguments(t *testing.T) {
+	program := compileProgram(t, `
+	let apply = fn(f) { f(1) };
+	apply(fn(x) { x });
+	apply(fn(x, y) { x });
+	`)
+
+	err := program.NewVM().Run()
+	if err == nil || err.Error() != "wrong number of arguments: want=2, got=1" {
+		t.Errorf("wrong VM error. got=%v", err)
+	}
+}
+
+func TestInlineCacheRebindingGlobals(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	// constants are shared by the programs, like the REPL does
+	constants := []object.Object{}
+	compile := func(input string) *Program {
+		comp := compiler.NewWithState(symbolTable, constants)
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		constants = comp.Bytecode().Constants
+		return NewProgram(comp.Bytecode())
+	}
+
+	definitions := compile(`let f = fn() { 1 }; let g = fn() { 2 }; let h = fn(x) { x };`)
+	caller := compile(`let call = fn() { f() }; call`)
+
+	globals := NewSharedGlobals()
+	if err := definitions.NewVMWithSharedGlobals(globals).Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	vm := caller.NewVMWithSharedGlobals(globals)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	call := vm.LastPoppedStackElem()
+
+	f, _ := symbolTable.Resolve("f")
+	g, _ := symbolTable.Resolve("g")
+	h, _ := symbolTable.Resolve("h")
+
+	tests := []struct {
+		global   object.Object
+		expected interface{}
+	}{
+		{globals.Get(f.Index), 1},
+		{globals.Get(f.Index), 1},
+		{globals.Get(g.Index), 2},
+		{object.Builtins[0].Builtin, "wrong number of arguments. got=0, want=1"},
+		{globals.Get(h.Index), "wrong number of arguments: want=1, got=0"},
+		{globals.Get(f.Index), 1},
+	}
+
+	for i, tt := range tests {
+		globals.Set(f.Index, tt.global)
+
+		result, err := vm.Call(call)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			if err != nil {
+				t.Fatalf("call %d error: %s", i, err)
+			}
+			if err := testIntegerObject(int64(expected), result); err != nil {
+				t.Errorf("call %d: %s", i, err)
+			}
+		case string:
+			if errObj, ok := result.(*object.Error); ok {
+				err = errorString(errObj.Message)
+			}
+			if err == nil || err.Error() != expected {
+				t.Errorf("call %d: wrong error. want=%q, got=%v", i, expected, err)
+			}
+		}
+	}
+}
+
+type errorString string
+
+func (e errorString) Error() string { return string(e) }
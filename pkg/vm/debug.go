@@ -0,0 +1,39 @@
+package vm
+
+import "github.com/jalopez/go-monkey-interpreter/pkg/object"
+
+// StackFrame is a call being run by the VM, as seen by debuggers.
+type StackFrame struct {
+	Closure *object.Closure
+	// IP is the instruction being run, or the call being made by the
+	// frames of callers
+	IP int
+	// Locals are the slots of the locals of the call, from its base
+	// pointer. Locals not bound yet are nil.
+	Locals []object.Object
+}
+
+// StackFrames returns the calls being run, innermost first. It is only
+// accurate while the VM is stopped in a tracer, which keeps the frames up to
+// date.
+func (vm *VM) StackFrames() []StackFrame {
+	frames := make([]StackFrame, 0, vm.framesIndex)
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		f := &vm.frames[i]
+		fn := f.cl.Fn
+
+		frames = append(frames, StackFrame{
+			Closure: f.cl,
+			IP:      f.ip,
+			Locals:  vm.stack[f.basePointer : f.basePointer+fn.NumLocals],
+		})
+	}
+
+	return frames
+}
+
+// Global returns the value of the global at index, or nil when it is not
+// set.
+func (vm *VM) Global(index int) object.Object {
+	return vm.getGlobal(index)
+}
@@ -5,16 +5,18 @@ import (
 	"github.com/jalopez/go-monkey-interpreter/pkg/object"
 )
 
-// Frame holds the frame.
+// Frame holds the frame. Frames are stored by value in the VM, which reuses
+// them across calls.
 type Frame struct {
 	cl          *object.Closure
 	ip          int
 	basePointer int
+	cache       *functionCache
 }
 
 // NewFrame creates a new frame.
-func NewFrame(cl *object.Closure, basePointer int) *Frame {
-	return &Frame{
+func NewFrame(cl *object.Closure, basePointer int) Frame {
+	return Frame{
 		cl:          cl,
 		ip:          -1,
 		basePointer: basePointer,
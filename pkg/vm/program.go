@@ -0,0 +1,138 @@
+package vm
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/compiler"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+)
+
+// Program is a compiled program. It is immutable, so it can be compiled once
+// and run concurrently by many goroutines, each one with its own VM.
+type Program struct {
+	mainFn     *object.CompiledFunction
+	constants  []object.Object
+	numGlobals int
+	// closures holds, for every function constant, the closure created by
+	// OpClosure when it has no free variables
+	closures []*object.Closure
+	// callSites holds the cached instructions of every function
+	callSites map[*object.CompiledFunction]callSites
+}
+
+// NewProgram creates a program from the compiled bytecode.
+func NewProgram(bytecode *compiler.Bytecode) *Program {
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
+
+	closures := make([]*object.Closure, len(bytecode.Constants))
+	sites := map[*object.CompiledFunction]callSites{
+		mainFn: findCallSites(mainFn.Instructions),
+	}
+	for i, constant := range bytecode.Constants {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			closures[i] = &object.Closure{Fn: fn}
+			sites[fn] = findCallSites(fn.Instructions)
+		}
+	}
+
+	return &Program{
+		mainFn:     mainFn,
+		constants:  bytecode.Constants,
+		numGlobals: bytecode.NumGlobals,
+		closures:   closures,
+		callSites:  sites,
+	}
+}
+
+// NewVM creates a VM to run the program with its own stack, frames and
+// globals. VMs are lightweight and not safe for concurrent use: create one
+// per goroutine.
+func (p *Program) NewVM() *VM {
+	return p.newVM(make([]object.Object, p.numGlobals), nil)
+}
+
+// NewVMWithSharedGlobals creates a VM to run the program that reads and writes
+// the given globals, which can be shared by VMs running in other goroutines.
+func (p *Program) NewVMWithSharedGlobals(globals *SharedGlobals) *VM {
+	globals.grow(p.numGlobals)
+
+	return p.newVM(nil, globals)
+}
+
+func (p *Program) newVM(globals []object.Object, shared *SharedGlobals) *VM {
+	mainClosure := &object.Closure{Fn: p.mainFn}
+
+	vm := &VM{
+		program:   p,
+		constants: p.constants,
+
+		stack: make([]object.Object, StackSize),
+		sp:    0,
+
+		globals:       globals,
+		sharedGlobals: shared,
+
+		frames:      make([]Frame, MaxFrames),
+		framesIndex: 1,
+
+		caches: map[*object.CompiledFunction]*functionCache{},
+
+		io: object.DefaultIO(),
+	}
+
+	vm.frames[0] = NewFrame(mainClosure, 0)
+	vm.frames[0].cache = vm.functionCache(p.mainFn)
+
+	return vm
+}
+
+// SharedGlobals are globals that can be read and written by many VMs running
+// concurrently. Access to them is synchronized, so they are slower than the
+// globals owned by a single VM.
+type SharedGlobals struct {
+	mutex  sync.RWMutex
+	values []object.Object
+	// version changes whenever a global is set, invalidating the values
+	// cached by the VMs
+	version atomic.Uint64
+}
+
+// NewSharedGlobals creates an empty set of shared globals.
+func NewSharedGlobals() *SharedGlobals {
+	return &SharedGlobals{}
+}
+
+// Get returns the value of the global at index.
+func (g *SharedGlobals) Get(index int) object.Object {
+	g.mutex.RLock()
+	defer g.mutex.RUnlock()
+
+	if index >= len(g.values) {
+		return nil
+	}
+
+	return g.values[index]
+}
+
+// Set sets the value of the global at index.
+func (g *SharedGlobals) Set(index int, value object.Object) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if index >= len(g.values) {
+		g.values = append(g.values, make([]object.Object, index+1-len(g.values))...)
+	}
+
+	g.values[index] = value
+	g.version.Add(1)
+}
+
+func (g *SharedGlobals) grow(size int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if size > len(g.values) {
+		g.values = append(g.values, make([]object.Object, size-len(g.values))...)
+	}
+}
@@ -0,0 +1,149 @@
+package vm
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/compiler"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+)
+
+func compileProgram(t *testing.T, input string) *Program {
+	t.Helper()
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	return NewProgram(comp.Bytecode())
+}
+
+func TestProgramConcurrentRuns(t *testing.T) {
+	program := compileProgram(t, `
+	let fibonacci = fn(x) {
+		if (x < 2) { return x; }
+		fibonacci(x - 1) + fibonacci(x - 2);
+	};
+	let results = wait(map([10, 15], fn(n) { spawn(fibonacci, n) }));
+	results[0] + results[1];
+	`)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 16)
+
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			vm := program.NewVM()
+			err := vm.Run()
+			if err == nil {
+				err = testIntegerObject(55+610, vm.LastPoppedStackElem())
+			}
+			errs[i] = err
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("run %d failed: %s", i, err)
+		}
+	}
+}
+
+func TestProgramGlobalsAreNotShared(t *testing.T) {
+	program := compileProgram(t, `let x = 1; x`)
+
+	first := program.NewVM()
+	if err := first.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	second := program.NewVM()
+	if second.getGlobal(0) != nil {
+		t.Errorf("globals of a new VM are not empty. got=%+v", second.getGlobal(0))
+	}
+
+	if len(second.globals) != 1 {
+		t.Errorf("wrong number of globals. want=1, got=%d", len(second.globals))
+	}
+}
+
+func TestSpawnWhileSettingGlobals(t *testing.T) {
+	// the task reads the globals while the VM spawning it sets them, so run
+	// with -race to check they are not shared unsynchronized
+	input := `
+	let x = 0;
+	let read = fn(n) { if (n == 0) { x } else { x; read(n - 1) } };
+	let task = spawn(read, 500);
+	` + strings.Repeat("let x = x + 1;\n", 500) + `
+	wait(task) < x + 1`
+
+	vm := compileProgram(t, input).NewVM()
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	if err := testBooleanObject(true, vm.LastPoppedStackElem()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestProgramSharedGlobals(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	compile := func(input string) *Program {
+		comp := compiler.NewWithState(symbolTable, []object.Object{})
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		return NewProgram(comp.Bytecode())
+	}
+
+	writer := compile(`let counter = 21;`)
+	reader := compile(`counter * 2`)
+
+	globals := NewSharedGlobals()
+	if err := writer.NewVMWithSharedGlobals(globals).Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 16)
+
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			if i%2 == 0 {
+				errs[i] = writer.NewVMWithSharedGlobals(globals).Run()
+				return
+			}
+
+			vm := reader.NewVMWithSharedGlobals(globals)
+			err := vm.Run()
+			if err == nil {
+				err = testIntegerObject(42, vm.LastPoppedStackElem())
+			}
+			errs[i] = err
+		}(i)
+	}
+
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("run %d failed: %s", i, err)
+		}
+	}
+}
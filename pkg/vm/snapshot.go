@@ -0,0 +1,443 @@
+package vm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+)
+
+// snapshotVersion is increased whenever the snapshot format changes
+const snapshotVersion = 1
+
+// mainFunction identifies the main function of the program in a snapshot,
+// since it is not part of the constants
+const mainFunction = -1
+
+type objectKind uint8
+
+const (
+	nullKind objectKind = iota
+	integerKind
+	stringKind
+	booleanKind
+	arrayKind
+	errorKind
+	closureKind
+	builtinKind
+	compiledFunctionKind
+)
+
+// snapshot is the serialized state of a VM. Objects are stored once in a
+// table and referenced by their index, so objects shared by several values
+// (and cycles through closures) are restored with the same identity. Index 0
+// is reserved for nil.
+type snapshot struct {
+	Version     int
+	Fingerprint []byte
+
+	Objects []snapshotObject
+
+	Stack []int
+	SP    int
+
+	Globals    []int
+	NumGlobals int
+
+	Frames []snapshotFrame
+}
+
+type snapshotObject struct {
+	Kind objectKind
+
+	Integer int64
+	String  string
+	Line    int
+	Column  int
+
+	// Elements holds the elements of arrays and the free variables of
+	// closures
+	Elements []int
+}
+
+type snapshotFrame struct {
+	Closure     int
+	IP          int
+	BasePointer int
+}
+
+// Snapshot serializes the state of a paused or finished VM: stack, frames,
+// instruction pointers and globals. The compiled program is not included, so
+// the snapshot can only be restored with Program.Restore on the same program.
+func (vm *VM) Snapshot() ([]byte, error) {
+	enc := &snapshotEncoder{vm: vm, ids: map[object.Object]int{}}
+	s := snapshot{
+		Version:     snapshotVersion,
+		Fingerprint: vm.program.fingerprint(),
+		Objects:     []snapshotObject{{}},
+		SP:          vm.sp,
+	}
+	enc.snapshot = &s
+
+	stackTop := vm.sp
+	if stackTop < StackSize {
+		// keep the last popped element, returned by LastPoppedStackElem
+		stackTop++
+	}
+	for _, obj := range vm.stack[:stackTop] {
+		id, err := enc.encode(obj)
+		if err != nil {
+			return nil, err
+		}
+		s.Stack = append(s.Stack, id)
+	}
+
+	globals := vm.globals
+	if vm.sharedGlobals != nil {
+		vm.sharedGlobals.mutex.RLock()
+		globals = append([]object.Object{}, vm.sharedGlobals.values...)
+		vm.sharedGlobals.mutex.RUnlock()
+	}
+	s.Globals = make([]int, len(globals))
+	s.NumGlobals = len(globals)
+	last := 0
+	for i, obj := range globals {
+		id, err := enc.encode(obj)
+		if err != nil {
+			return nil, fmt.Errorf("global %d: %w", i, err)
+		}
+		s.Globals[i] = id
+		if id != 0 {
+			last = i + 1
+		}
+	}
+	// globals are preallocated, so drop the unused tail
+	s.Globals = s.Globals[:last]
+
+	for _, frame := range vm.frames[:vm.framesIndex] {
+		id, err := enc.encode(frame.cl)
+		if err != nil {
+			return nil, err
+		}
+		s.Frames = append(s.Frames, snapshotFrame{
+			Closure:     id,
+			IP:          frame.ip,
+			BasePointer: frame.basePointer,
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+		return nil, fmt.Errorf("encoding snapshot: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Restore creates a VM from a snapshot taken by VM.Snapshot while running
+// this program. Calling Run on the new VM resumes the execution where the
+// snapshot was taken.
+func (p *Program) Restore(data []byte) (*VM, error) {
+	var s snapshot
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s); err != nil {
+		return nil, fmt.Errorf("decoding snapshot: %w", err)
+	}
+
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d, want=%d", s.Version, snapshotVersion)
+	}
+	if !bytes.Equal(s.Fingerprint, p.fingerprint()) {
+		return nil, fmt.Errorf("snapshot was taken from a different program")
+	}
+	if len(s.Frames) == 0 || len(s.Frames) > MaxFrames {
+		return nil, fmt.Errorf("invalid number of frames in snapshot: %d", len(s.Frames))
+	}
+	if len(s.Stack) > StackSize || s.SP < 0 || s.SP > len(s.Stack) {
+		return nil, fmt.Errorf("invalid stack in snapshot")
+	}
+
+	dec := &snapshotDecoder{program: p, snapshot: &s}
+	if err := dec.decodeObjects(); err != nil {
+		return nil, err
+	}
+
+	if s.NumGlobals < len(s.Globals) || s.NumGlobals > GlobalsSize {
+		return nil, fmt.Errorf("invalid globals in snapshot")
+	}
+	globals := make([]object.Object, s.NumGlobals)
+	for i, id := range s.Globals {
+		obj, err := dec.object(id)
+		if err != nil {
+			return nil, err
+		}
+		globals[i] = obj
+	}
+
+	vm := p.newVM(globals, nil)
+	vm.sp = s.SP
+	for i, id := range s.Stack {
+		obj, err := dec.object(id)
+		if err != nil {
+			return nil, err
+		}
+		vm.stack[i] = obj
+	}
+
+	for i, f := range s.Frames {
+		obj, err := dec.object(f.Closure)
+		if err != nil {
+			return nil, err
+		}
+		cl, ok := obj.(*object.Closure)
+		if !ok {
+			return nil, fmt.Errorf("frame %d does not hold a closure", i)
+		}
+		if f.IP < -1 || f.IP >= len(cl.Fn.Instructions) || f.BasePointer < 0 || f.BasePointer > StackSize {
+			return nil, fmt.Errorf("invalid frame %d in snapshot", i)
+		}
+		vm.frames[i] = Frame{cl: cl, ip: f.IP, basePointer: f.BasePointer, cache: vm.functionCache(cl.Fn)}
+	}
+	vm.framesIndex = len(s.Frames)
+
+	return vm, nil
+}
+
+// fingerprint identifies the program, so snapshots cannot be restored with
+// a different one
+func (p *Program) fingerprint() []byte {
+	h := sha256.New()
+	h.Write(p.mainFn.Instructions)
+
+	for _, c := range p.constants {
+		switch c := c.(type) {
+		case *object.CompiledFunction:
+			fmt.Fprintf(h, "%s:%d:%d:", c.Type(), c.NumLocals, c.NumParameters)
+			h.Write(c.Instructions)
+		default:
+			fmt.Fprintf(h, "%s:%s", c.Type(), c.Inspect())
+		}
+		h.Write([]byte{0})
+	}
+
+	return h.Sum(nil)
+}
+
+type snapshotEncoder struct {
+	vm       *VM
+	snapshot *snapshot
+	ids      map[object.Object]int
+}
+
+func (e *snapshotEncoder) encode(obj object.Object) (int, error) {
+	if obj == nil {
+		return 0, nil
+	}
+	if id, ok := e.ids[obj]; ok {
+		return id, nil
+	}
+
+	// reserve the id before encoding children, so cycles reference it
+	id := len(e.snapshot.Objects)
+	e.ids[obj] = id
+	e.snapshot.Objects = append(e.snapshot.Objects, snapshotObject{})
+
+	var (
+		so  snapshotObject
+		err error
+	)
+	switch obj := obj.(type) {
+	case *object.Null:
+		so.Kind = nullKind
+	case *object.Integer:
+		so.Kind = integerKind
+		so.Integer = obj.Value
+	case *object.String:
+		so.Kind = stringKind
+		so.String = obj.Value
+	case *object.Boolean:
+		so.Kind = booleanKind
+		if obj.Value {
+			so.Integer = 1
+		}
+	case *object.Error:
+		so.Kind = errorKind
+		so.String = obj.Message
+		so.Line = obj.Line
+		so.Column = obj.Column
+	case *object.Array:
+		so.Kind = arrayKind
+		so.Elements, err = e.encodeAll(obj.Elements)
+	case *object.CompiledFunction:
+		so.Kind = compiledFunctionKind
+		so.Integer, err = e.functionIndex(obj)
+	case *object.Closure:
+		so.Kind = closureKind
+		so.Integer, err = e.functionIndex(obj.Fn)
+		if err == nil {
+			so.Elements, err = e.encodeAll(obj.Free)
+		}
+	case *object.Builtin:
+		so.Kind = builtinKind
+		so.Integer, err = builtinIndex(obj)
+	default:
+		err = fmt.Errorf("cannot snapshot %s", obj.Type())
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	e.snapshot.Objects[id] = so
+
+	return id, nil
+}
+
+func (e *snapshotEncoder) encodeAll(objs []object.Object) ([]int, error) {
+	ids := make([]int, len(objs))
+	for i, obj := range objs {
+		id, err := e.encode(obj)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+
+	return ids, nil
+}
+
+func (e *snapshotEncoder) functionIndex(fn *object.CompiledFunction) (int64, error) {
+	if fn == e.vm.program.mainFn {
+		return mainFunction, nil
+	}
+
+	for i, c := range e.vm.constants {
+		if c == fn {
+			return int64(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("cannot snapshot function not defined in the program")
+}
+
+func builtinIndex(builtin *object.Builtin) (int64, error) {
+	for i, b := range object.Builtins {
+		if b.Builtin == builtin {
+			return int64(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("cannot snapshot unknown builtin")
+}
+
+type snapshotDecoder struct {
+	program  *Program
+	snapshot *snapshot
+	objects  []object.Object
+}
+
+// decodeObjects restores the objects table in two passes: first every object
+// is created, then containers are filled, so references can point anywhere
+// in the table
+func (d *snapshotDecoder) decodeObjects() error {
+	d.objects = make([]object.Object, len(d.snapshot.Objects))
+
+	for id, so := range d.snapshot.Objects {
+		if id == 0 {
+			continue
+		}
+
+		switch so.Kind {
+		case nullKind:
+			d.objects[id] = object.NULL
+		case integerKind:
+			d.objects[id] = object.NewInteger(so.Integer)
+		case stringKind:
+			d.objects[id] = &object.String{Value: so.String}
+		case booleanKind:
+			d.objects[id] = nativeBoolToBooleanObject(so.Integer != 0)
+		case errorKind:
+			d.objects[id] = &object.Error{Message: so.String, Line: so.Line, Column: so.Column}
+		case arrayKind:
+			d.objects[id] = &object.Array{}
+		case compiledFunctionKind:
+			fn, err := d.function(so.Integer)
+			if err != nil {
+				return err
+			}
+			d.objects[id] = fn
+		case closureKind:
+			fn, err := d.function(so.Integer)
+			if err != nil {
+				return err
+			}
+			d.objects[id] = &object.Closure{Fn: fn}
+		case builtinKind:
+			if so.Integer < 0 || so.Integer >= int64(len(object.Builtins)) {
+				return fmt.Errorf("invalid builtin in snapshot: %d", so.Integer)
+			}
+			d.objects[id] = object.Builtins[so.Integer].Builtin
+		default:
+			return fmt.Errorf("invalid object kind in snapshot: %d", so.Kind)
+		}
+	}
+
+	for id, so := range d.snapshot.Objects {
+		if id == 0 {
+			continue
+		}
+
+		elements, err := d.objectList(so.Elements)
+		if err != nil {
+			return err
+		}
+
+		switch obj := d.objects[id].(type) {
+		case *object.Array:
+			obj.Elements = elements
+		case *object.Closure:
+			obj.Free = elements
+		}
+	}
+
+	return nil
+}
+
+func (d *snapshotDecoder) function(index int64) (*object.CompiledFunction, error) {
+	if index == mainFunction {
+		return d.program.mainFn, nil
+	}
+
+	if index >= 0 && index < int64(len(d.program.constants)) {
+		if fn, ok := d.program.constants[index].(*object.CompiledFunction); ok {
+			return fn, nil
+		}
+	}
+
+	return nil, fmt.Errorf("invalid function in snapshot: %d", index)
+}
+
+func (d *snapshotDecoder) object(id int) (object.Object, error) {
+	if id < 0 || id >= len(d.objects) {
+		return nil, fmt.Errorf("invalid object reference in snapshot: %d", id)
+	}
+
+	return d.objects[id], nil
+}
+
+func (d *snapshotDecoder) objectList(ids []int) ([]object.Object, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	objs := make([]object.Object, len(ids))
+	for i, id := range ids {
+		obj, err := d.object(id)
+		if err != nil {
+			return nil, err
+		}
+		objs[i] = obj
+	}
+
+	return objs, nil
+}
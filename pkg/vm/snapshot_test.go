@@ -0,0 +1,135 @@
+package vm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+)
+
+func TestSnapshotRestoreAtEveryPause(t *testing.T) {
+	tests := []vmTestCase{
+		{"len([1]) + 2 * 3", 7},
+		{`let a = [1, 2, 3]; let b = a; push(b, 4)[3] + len(a)`, 7},
+		{`
+		let newAdder = fn(a) { fn(b) { a + b } };
+		let addTwo = newAdder(2);
+		addTwo(3) + addTwo(4)
+		`, 11},
+		{`
+		let fibonacci = fn(x) {
+			if (x < 2) { return x; }
+			fibonacci(x - 1) + fibonacci(x - 2)
+		};
+		fibonacci(10)
+		`, 55},
+		{`
+		let countDown = fn(x) { if (x == 0) { return 0; } countDown(x - 1) };
+		let wrapper = fn() { countDown(3) };
+		wrapper()
+		`, 0},
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`if (len("monkey") > 3) { "long" } else { "short" }`, "long"},
+		{`let x = 1; let y = len([1, 2]); if (x > y) { 10 }`, Null},
+	}
+
+	for _, tt := range tests {
+		program := compileProgram(t, tt.input)
+
+		machine := program.NewVM()
+		steps := 0
+		for {
+			machine.Pause()
+			err := machine.Run()
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, ErrPaused) {
+				t.Fatalf("%q: vm error: %s", tt.input, err)
+			}
+
+			data, err := machine.Snapshot()
+			if err != nil {
+				t.Fatalf("%q: snapshot error: %s", tt.input, err)
+			}
+
+			machine, err = program.Restore(data)
+			if err != nil {
+				t.Fatalf("%q: restore error: %s", tt.input, err)
+			}
+			steps++
+		}
+
+		if steps == 0 {
+			t.Fatalf("%q: vm was never paused", tt.input)
+		}
+
+		testExpectedObject(t, tt.expected, machine.LastPoppedStackElem())
+	}
+}
+
+func TestSnapshotKeepsSharedReferences(t *testing.T) {
+	program := compileProgram(t, `
+	let a = [1];
+	let b = [a, a];
+	let f = fn() { push(b[0], 2) };
+	f()
+	`)
+
+	machine := program.NewVM()
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	data, err := machine.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot error: %s", err)
+	}
+
+	restored, err := program.Restore(data)
+	if err != nil {
+		t.Fatalf("restore error: %s", err)
+	}
+
+	b, ok := restored.globals[1].(*object.Array)
+	if !ok {
+		t.Fatalf("global b is not an array, got %T", restored.globals[1])
+	}
+	if b.Elements[0] != b.Elements[1] {
+		t.Errorf("shared array was restored as two different objects")
+	}
+	if b.Elements[0] != restored.globals[0] {
+		t.Errorf("array referenced from a global and from another array was duplicated")
+	}
+}
+
+func TestRestoreFromDifferentProgram(t *testing.T) {
+	machine := compileProgram(t, "len([1]) + 2").NewVM()
+	machine.Pause()
+	if err := machine.Run(); !errors.Is(err, ErrPaused) {
+		t.Fatalf("expected vm to be paused, got %v", err)
+	}
+
+	data, err := machine.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot error: %s", err)
+	}
+
+	_, err = compileProgram(t, "len([1]) + 3").Restore(data)
+	if err == nil || !strings.Contains(err.Error(), "different program") {
+		t.Fatalf("expected different program error, got %v", err)
+	}
+}
+
+func TestSnapshotUnsupportedObjects(t *testing.T) {
+	machine := compileProgram(t, "let c = chan(1); c").NewVM()
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	_, err := machine.Snapshot()
+	if err == nil || !strings.Contains(err.Error(), "cannot snapshot CHANNEL") {
+		t.Fatalf("expected unsupported object error, got %v", err)
+	}
+}
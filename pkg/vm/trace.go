@@ -0,0 +1,129 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/code"
+	"github.com/jalopez/go-monkey-interpreter/pkg/object"
+)
+
+// TraceEvent is the state of the VM passed to a Tracer.
+type TraceEvent struct {
+	// Op is the instruction being executed: the call instruction for calls
+	// and builtin returns, the return instruction for closure returns
+	Op code.Opcode
+	// Depth is the number of frames, 1 in the main program. For calls and
+	// returns it is the depth of the callee.
+	Depth int
+	// IP is the position of the instruction in the instructions of
+	// Function. Calls from the host have no instruction, so IP is -1 and
+	// Function is the callee.
+	IP           int
+	Instructions code.Instructions
+	// Function is the function running the instruction, with an empty
+	// name for the main program
+	Function *object.CompiledFunction
+	// StackTop is the top of the stack, nil when it is empty. For returns
+	// it is the returned value.
+	StackTop object.Object
+	// Callee is the closure or builtin called, only for calls
+	Callee object.Object
+}
+
+// Tracer observes the execution of a VM. It is called from the goroutine
+// running the VM, and VMs forked to run spawned tasks are not traced.
+type Tracer interface {
+	// OnInstruction is called before an instruction is executed
+	OnInstruction(e TraceEvent)
+	// OnCall is called before a closure or builtin is called, with the
+	// arguments on the stack
+	OnCall(e TraceEvent)
+	// OnReturn is called when a closure or builtin returns
+	OnReturn(e TraceEvent)
+	// OnError is called when the execution fails, with the instruction
+	// that failed
+	OnError(e TraceEvent, err error)
+}
+
+// SetTracer sets the tracer called during the execution, or removes it when
+// nil. Without a tracer, the execution is not slowed down.
+func (vm *VM) SetTracer(tracer Tracer) {
+	vm.tracer = tracer
+}
+
+// traceEvent creates the event of the instruction at ip of fn
+func (vm *VM) traceEvent(op code.Opcode, depth int, fn *object.CompiledFunction, ip int) TraceEvent {
+	return TraceEvent{
+		Op:           op,
+		Depth:        depth,
+		IP:           ip,
+		Instructions: fn.Instructions,
+		Function:     fn,
+		StackTop:     vm.StackTop(),
+	}
+}
+
+func (vm *VM) traceCall(fn *object.CompiledFunction, ip int, callee object.Object) {
+	e := vm.traceEvent(code.Opcode(fn.Instructions[ip]), vm.framesIndex+1, fn, ip)
+	e.Callee = callee
+
+	vm.tracer.OnCall(e)
+}
+
+// traceError traces the error of the last instruction traced
+func (vm *VM) traceError(err error) {
+	e := vm.traced
+	e.StackTop = vm.StackTop()
+
+	vm.tracer.OnError(e, err)
+}
+
+// TextTracer writes a readable trace of the execution, one line per event,
+// formatting instructions like code.Instructions.String and indenting them
+// by frame depth.
+type TextTracer struct {
+	w io.Writer
+}
+
+// NewTextTracer creates a tracer writing to w.
+func NewTextTracer(w io.Writer) *TextTracer {
+	return &TextTracer{w: w}
+}
+
+// OnInstruction writes the instruction with the top of the stack.
+func (t *TextTracer) OnInstruction(e TraceEvent) {
+	fmt.Fprintf(t.w, "%s%04d %-32s top=%s\n", indent(e.Depth), e.IP, e.Instructions.InstructionAt(e.IP), inspect(e.StackTop))
+}
+
+// OnCall writes the callee.
+func (t *TextTracer) OnCall(e TraceEvent) {
+	fmt.Fprintf(t.w, "%s-> call %s\n", indent(e.Depth), inspect(e.Callee))
+}
+
+// OnReturn writes the returned value.
+func (t *TextTracer) OnReturn(e TraceEvent) {
+	fmt.Fprintf(t.w, "%s<- return %s\n", indent(e.Depth), inspect(e.StackTop))
+}
+
+// OnError writes the error with the instruction that failed.
+func (t *TextTracer) OnError(e TraceEvent, err error) {
+	if e.Instructions == nil {
+		fmt.Fprintf(t.w, "!! %s\n", err)
+		return
+	}
+
+	fmt.Fprintf(t.w, "%s!! %04d %s: %s\n", indent(e.Depth), e.IP, e.Instructions.InstructionAt(e.IP), err)
+}
+
+func indent(depth int) string {
+	return strings.Repeat("  ", max(depth-1, 0))
+}
+
+func inspect(obj object.Object) string {
+	if obj == nil {
+		return "<empty>"
+	}
+	return obj.Inspect()
+}
@@ -0,0 +1,120 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jalopez/go-monkey-interpreter/pkg/code"
+)
+
+type recordingTracer struct {
+	events []string
+}
+
+func (r *recordingTracer) OnInstruction(e TraceEvent) {
+	r.events = append(r.events, fmt.Sprintf("%d %04d %s", e.Depth, e.IP, code.Definitions[e.Op].Name))
+}
+
+func (r *recordingTracer) OnCall(e TraceEvent) {
+	r.events = append(r.events, fmt.Sprintf("%d call %s", e.Depth, e.Callee.Inspect()))
+}
+
+func (r *recordingTracer) OnReturn(e TraceEvent) {
+	r.events = append(r.events, fmt.Sprintf("%d return %s", e.Depth, e.StackTop.Inspect()))
+}
+
+func (r *recordingTracer) OnError(e TraceEvent, err error) {
+	r.events = append(r.events, fmt.Sprintf("%d error %04d %s: %s", e.Depth, e.IP, code.Definitions[e.Op].Name, err))
+}
+
+func TestTracer(t *testing.T) {
+	program := compileProgram(t, `let f = fn(x) { len(x) - 1 }; f("ab"); f(1)`)
+
+	tracer := &recordingTracer{}
+	vm := program.NewVM()
+	vm.SetTracer(tracer)
+
+	err := vm.Run()
+	if err == nil {
+		t.Fatalf("expected VM error but resulted in none.")
+	}
+
+	expected := []string{
+		"1 0000 OpClosure",
+		"1 0004 OpSetGlobal",
+		"1 0007 OpGetGlobal",
+		"1 0010 OpConstant",
+		"1 0013 OpCall",
+		"2 call Closure",
+		"2 0000 OpGetBuiltin",
+		"2 0002 OpGetLocal",
+		"2 0004 OpCall",
+		"3 call builtin function",
+		"3 return 2",
+		"2 0006 OpConstant",
+		"2 0009 OpSub",
+		"2 0010 OpReturnValue",
+		"2 return 1",
+		"1 0015 OpPop",
+		"1 0016 OpGetGlobal",
+		"1 0019 OpConstant",
+		"1 0022 OpCall",
+		"2 call Closure",
+		"2 0000 OpGetBuiltin",
+		"2 0002 OpGetLocal",
+		"2 0004 OpCall",
+		"3 call builtin function",
+		"3 return Error: argument to `len` not supported, got INTEGER",
+		"2 0006 OpConstant",
+		"2 0009 OpSub",
+		"2 error 0009 OpSub: unsupported types for binary operation: ERROR INTEGER",
+	}
+
+	events := make([]string, len(tracer.events))
+	for i, event := range tracer.events {
+		// closures are inspected with their address
+		events[i], _, _ = strings.Cut(event, "[")
+	}
+
+	if strings.Join(events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong events.\nwant=\n%s\ngot=\n%s", strings.Join(expected, "\n"), strings.Join(events, "\n"))
+	}
+}
+
+func TestTextTracer(t *testing.T) {
+	program := compileProgram(t, `let f = fn() { 1 }; f()`)
+
+	var out bytes.Buffer
+	vm := program.NewVM()
+	vm.SetTracer(NewTextTracer(&out))
+
+	err := vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	expected := []string{
+		"0000 OpClosure 1 0",
+		"0004 OpSetGlobal 0",
+		"0007 OpGetGlobal 0",
+		"0010 OpCall 0",
+		"  -> call Closure",
+		"  0000 OpConstant 0",
+		"  0003 OpReturnValue",
+		"  <- return 1",
+		"0012 OpPop",
+	}
+
+	if len(lines) != len(expected)+1 {
+		t.Fatalf("wrong number of lines. want=%d, got=%d:\n%s", len(expected)+1, len(lines), out.String())
+	}
+
+	for i, prefix := range expected {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("wrong line %d. want prefix %q, got=%q", i, prefix, lines[i])
+		}
+	}
+}
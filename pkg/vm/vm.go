@@ -1,21 +1,24 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
+	"sync/atomic"
 
 	"github.com/jalopez/go-monkey-interpreter/pkg/code"
 	"github.com/jalopez/go-monkey-interpreter/pkg/compiler"
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
 	"github.com/jalopez/go-monkey-interpreter/pkg/object"
 )
 
 // True is the true object.
-var True = &object.Boolean{Value: true}
+var True = object.TRUE
 
 // False is the false object.
-var False = &object.Boolean{Value: false}
+var False = object.FALSE
 
 // Null is the null object.
-var Null = &object.Null{}
+var Null = object.NULL
 
 // StackSize is the size of the stack.
 const StackSize = 2048
@@ -26,44 +29,68 @@ const GlobalsSize = 65536
 // MaxFrames is the maximum number of frames.
 const MaxFrames = 1024
 
-// VM is the virtual machine.
+// VM is the virtual machine. It holds the state of a single execution of a
+// Program and is not safe for concurrent use.
 type VM struct {
+	program   *Program
 	constants []object.Object
 	stack     []object.Object
-	globals   []object.Object
 	sp        int // Always points to the next value. Top of stack is stack[sp-1].
 
-	frames      []*Frame
+	globals       []object.Object
+	sharedGlobals *SharedGlobals
+
+	frames      []Frame
 	framesIndex int
+
+	caches map[*object.CompiledFunction]*functionCache
+
+	io *object.IO
+
+	pauseRequested atomic.Bool
+
+	tracer Tracer
+	// traced is the last instruction traced
+	traced TraceEvent
 }
 
 // New creates a new VM.
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
-	mainClosure := &object.Closure{Fn: mainFn}
-	mainFrame := NewFrame(mainClosure, 0)
-
-	frames := make([]*Frame, MaxFrames)
-	frames[0] = mainFrame
+	return NewProgram(bytecode).newVM(make([]object.Object, GlobalsSize), nil)
+}
 
-	return &VM{
-		constants: bytecode.Constants,
+// NewWithGlobalsStore creates a new VM with a global store. The store is not
+// synchronized, so it can only be reused by VMs running one after the other,
+// as the REPL does; use Program.NewVMWithSharedGlobals for concurrent VMs.
+func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
+	return NewProgram(bytecode).newVM(s, nil)
+}
 
-		stack: make([]object.Object, StackSize),
-		sp:    0,
+// SetIO sets the streams used by the builtins run by the VM.
+func (vm *VM) SetIO(io *object.IO) {
+	vm.io = io
+}
 
-		globals: make([]object.Object, GlobalsSize),
+// IO returns the streams used by the builtins run by the VM.
+func (vm *VM) IO() *object.IO {
+	return vm.io
+}
 
-		frames:      frames,
-		framesIndex: 1,
+// Fork returns a new VM running the same program, sharing the streams of
+// this one, with its own stack and frames, to run spawned tasks concurrently.
+// Shared globals stay shared; otherwise, as they are not synchronized, the new
+// VM gets a copy of them, which tasks only read, as functions set no globals.
+func (vm *VM) Fork() object.ExecutionContext {
+	var globals []object.Object
+	if vm.sharedGlobals == nil {
+		globals = make([]object.Object, vm.program.numGlobals)
+		copy(globals, vm.globals)
 	}
-}
 
-// NewWithGlobalsStore creates a new VM with a global store.
-func NewWithGlobalsStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
-	vm := New(bytecode)
-	vm.globals = s
-	return vm
+	forked := vm.program.newVM(globals, vm.sharedGlobals)
+	forked.io = vm.io
+
+	return forked
 }
 
 // StackTop returns the top of the stack.
@@ -74,50 +101,207 @@ func (vm *VM) StackTop() object.Object {
 	return vm.stack[vm.sp-1]
 }
 
-// LastPoppedStackElem returns the last popped stack element.
+// LastPoppedStackElem returns the last popped stack element, or null if
+// there was none.
 func (vm *VM) LastPoppedStackElem() object.Object {
+	if vm.stack[vm.sp] == nil {
+		return Null
+	}
 	return vm.stack[vm.sp]
 }
 
-// Run runs the VM.
+// ErrPaused is returned by Run when the execution is paused.
+var ErrPaused = errors.New("execution paused")
+
+// Run runs the VM. If it returns ErrPaused, calling Run again resumes the
+// execution where it was paused.
 func (vm *VM) Run() error {
-	var ip int
-	var instructions code.Instructions
-	var op code.Opcode
+	return vm.run(0)
+}
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
-		vm.currentFrame().ip++
+// Pause asks the VM to stop at the next call or backward jump of Run, which
+// then returns ErrPaused. As programs run for long only by calling functions
+// or looping, the VM does not need to check on every instruction. It is safe
+// to call from other goroutines, even before Run.
+func (vm *VM) Pause() {
+	vm.pauseRequested.Store(true)
+}
 
-		ip = vm.currentFrame().ip
-		instructions = vm.currentFrame().Instructions()
-		op = code.Opcode(instructions[ip])
+// Call calls a closure or builtin, usually one returned by a script, with the
+// given arguments and returns its result. The state of the VM, including the
+// last popped element, is restored afterwards, so it can be used after Run to
+// implement callbacks in Monkey. It also makes the VM the execution context of
+// the builtins it runs.
+func (vm *VM) Call(fn object.Object, args ...object.Object) (object.Object, error) {
+	switch fn := fn.(type) {
+	case *object.Closure:
+		return vm.callClosureFromHost(fn, args)
+	case *object.Builtin:
+		result, err := fn.Fn(vm, args...)
+		if err != nil {
+			return nil, err
+		}
+		if result == nil {
+			return Null, nil
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("calling non-function and non-built-in")
+	}
+}
 
-		switch op {
+func (vm *VM) callClosureFromHost(cl *object.Closure, args []object.Object) (object.Object, error) {
+	sp := vm.sp
+	framesIndex := vm.framesIndex
+
+	if sp >= StackSize {
+		return nil, fmt.Errorf("stack overflow")
+	}
+	lastPopped := vm.stack[sp]
+
+	restore := func() {
+		vm.sp = sp
+		vm.framesIndex = framesIndex
+		vm.stack[sp] = lastPopped
+	}
+
+	err := vm.push(cl)
+	for i := 0; err == nil && i < len(args); i++ {
+		err = vm.push(args[i])
+	}
+
+	if err == nil {
+		err = vm.callClosure(cl, len(args))
+	}
+
+	if err == nil && vm.tracer != nil {
+		e := vm.traceEvent(code.OpCall, vm.framesIndex, cl.Fn, -1)
+		e.Callee = cl
+		vm.tracer.OnCall(e)
+	}
+
+	if err == nil {
+		err = vm.run(framesIndex)
+	}
+
+	if err != nil {
+		restore()
+		return nil, err
+	}
+
+	result := vm.pop()
+	restore()
+
+	return result, nil
+}
+
+// run executes instructions until the frame at the given depth returns, or
+// until the main frame runs out of instructions when depth is 0.
+func (vm *VM) run(depth int) error {
+	err := vm.execute(depth)
+	if err != nil && err != ErrPaused {
+		err = vm.diagnose(err)
+		if vm.tracer != nil {
+			vm.traceError(err)
+		}
+	}
+
+	return err
+}
+
+// maxCallNotes is the number of calls noted in the diagnostics of runtime
+// errors
+const maxCallNotes = 8
+
+// diagnose turns a runtime error into a diagnostic at the source of the
+// instruction of the current frame, noting the calls leading to it. Errors
+// of the runs of callbacks already are diagnostics.
+func (vm *VM) diagnose(err error) error {
+	if _, ok := err.(*diagnostic.Diagnostic); ok {
+		return err
+	}
+
+	frame := vm.currentFrame()
+	line, column := frame.cl.Fn.SourceMap.Lookup(frame.ip)
+	d := diagnostic.At(diagnostic.RuntimeError, line, column, "%s", err)
+
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		if len(d.Notes) == maxCallNotes {
+			d.Notes = append(d.Notes, fmt.Sprintf("and %d more calls", i))
+			break
+		}
+
+		name := vm.frames[i].cl.Fn.Name
+		if name == "" {
+			name = "anonymous function"
+		}
+		caller := vm.frames[i-1]
+		line, column := caller.cl.Fn.SourceMap.Lookup(caller.ip)
+		d.Notes = append(d.Notes, fmt.Sprintf("in %s, called at line %d, column %d", name, line, column))
+	}
+
+	return d
+}
+
+func (vm *VM) execute(depth int) (err error) {
+	// the current frame, its instructions and instruction pointer are kept in
+	// locals, and the ip is only written back to the frame when other code
+	// may read it: on calls, returns, pauses and errors
+	frame := vm.currentFrame()
+	ins := frame.Instructions()
+	ip := frame.ip
+
+	defer func() {
+		if err != nil {
+			frame.ip = ip
+		}
+	}()
+
+	tracer := vm.tracer
+
+	for ip < len(ins)-1 {
+		ip++
+
+		if tracer != nil {
+			// tracers may inspect the frames
+			frame.ip = ip
+			vm.traced = vm.traceEvent(code.Opcode(ins[ip]), vm.framesIndex, frame.cl.Fn, ip)
+			tracer.OnInstruction(vm.traced)
+		}
+
+		switch code.Opcode(ins[ip]) {
 		case code.OpSetGlobal:
-			globalIndex := code.ReadUint16(instructions[ip+1:])
+			globalIndex := code.ReadUint16(ins[ip+1:])
+			ip += 2
 
-			vm.globals[globalIndex] = vm.pop()
-			vm.currentFrame().ip += 2
+			vm.setGlobal(int(globalIndex), vm.pop())
 
 		case code.OpGetGlobal:
-			globalIndex := code.ReadUint16(instructions[ip+1:])
-			vm.currentFrame().ip += 2
+			globalIndex := int(code.ReadUint16(ins[ip+1:]))
 
-			err := vm.push(vm.globals[globalIndex])
+			var value object.Object
+			if vm.sharedGlobals != nil {
+				value = vm.getSharedGlobal(globalIndex, frame.cache.at(ip))
+			} else {
+				value = vm.globals[globalIndex]
+			}
+			ip += 2
+
+			err := vm.push(value)
 			if err != nil {
 				return err
 			}
 
 		case code.OpConstant:
-			constIndex := code.ReadUint16(instructions[ip+1:])
-			vm.currentFrame().ip += 2
+			constIndex := code.ReadUint16(ins[ip+1:])
+			ip += 2
 
 			err := vm.push(vm.constants[constIndex])
 			if err != nil {
 				return err
 			}
 		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
-			err := vm.executeBinaryOperation(op)
+			err := vm.executeBinaryOperation(code.Opcode(ins[ip]))
 			if err != nil {
 				return err
 			}
@@ -134,7 +318,7 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
-			err := vm.executeComparison(op)
+			err := vm.executeComparison(code.Opcode(ins[ip]))
 			if err != nil {
 				return err
 			}
@@ -149,15 +333,21 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpJump:
-			pos := int(code.ReadUint16(instructions[ip+1:]))
-			vm.currentFrame().ip = pos - 1
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			backward := pos <= ip
+			ip = pos - 1
+
+			if backward && vm.pauses(depth) {
+				frame.ip = ip
+				return ErrPaused
+			}
 		case code.OpJumpNotTruthy:
-			pos := int(code.ReadUint16(instructions[ip+1:]))
-			vm.currentFrame().ip += 2
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			ip += 2
 
 			condition := vm.pop()
 			if !isTruthy(condition) {
-				vm.currentFrame().ip = pos - 1
+				ip = pos - 1
 			}
 		case code.OpNull:
 			err := vm.push(Null)
@@ -165,8 +355,8 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpArray:
-			numElements := int(code.ReadUint16(instructions[ip+1:]))
-			vm.currentFrame().ip += 2
+			numElements := int(code.ReadUint16(ins[ip+1:]))
+			ip += 2
 			array := vm.buildArray(vm.sp-numElements, vm.sp)
 
 			vm.sp -= numElements
@@ -183,53 +373,74 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpCall:
-			numArgs := code.ReadUint8(instructions[ip+1:])
-			vm.currentFrame().ip++
+			numArgs := code.ReadUint8(ins[ip+1:])
+			cache := frame.cache.at(ip)
+			if tracer != nil {
+				vm.traceCall(frame.cl.Fn, ip, vm.stack[vm.sp-1-int(numArgs)])
+			}
+			ip++
 
-			err := vm.executeCall(int(numArgs))
+			frame.ip = ip
+			err := vm.executeCall(int(numArgs), cache)
 			if err != nil {
 				return err
 			}
 
-		case code.OpSetLocal:
-			localIndex := code.ReadUint8(instructions[ip+1:])
-			vm.currentFrame().ip++
+			if tracer != nil && vm.currentFrame() == frame {
+				// builtins return right away
+				tracer.OnReturn(vm.traceEvent(code.OpCall, vm.framesIndex+1, frame.cl.Fn, ip-1))
+			}
 
-			frame := vm.currentFrame()
+			frame = vm.currentFrame()
+			ins = frame.Instructions()
+			ip = frame.ip
+
+			if vm.pauses(depth) {
+				return ErrPaused
+			}
+
+		case code.OpSetLocal:
+			localIndex := code.ReadUint8(ins[ip+1:])
+			ip++
 
 			vm.stack[frame.basePointer+int(localIndex)] = vm.pop()
 
 		case code.OpGetLocal:
-			localIndex := code.ReadUint8(instructions[ip+1:])
-			vm.currentFrame().ip++
-
-			frame := vm.currentFrame()
+			localIndex := code.ReadUint8(ins[ip+1:])
+			ip++
 
 			err := vm.push(vm.stack[frame.basePointer+int(localIndex)])
 			if err != nil {
 				return err
 			}
-		case code.OpReturnValue:
-			returnValue := vm.pop()
+		case code.OpReturnValue, code.OpReturn:
+			var returnValue object.Object = Null
+			if code.Opcode(ins[ip]) == code.OpReturnValue {
+				returnValue = vm.pop()
+			}
 
-			frame := vm.popFrame()
+			vm.framesIndex--
 			vm.sp = frame.basePointer - 1
 
 			err := vm.push(returnValue)
 			if err != nil {
 				return err
 			}
-		case code.OpReturn:
-			frame := vm.popFrame()
-			vm.sp = frame.basePointer - 1
 
-			err := vm.push(Null)
-			if err != nil {
-				return err
+			if tracer != nil {
+				tracer.OnReturn(vm.traceEvent(code.Opcode(ins[ip]), vm.framesIndex+1, frame.cl.Fn, ip))
 			}
+
+			if vm.framesIndex <= depth {
+				return nil
+			}
+
+			frame = vm.currentFrame()
+			ins = frame.Instructions()
+			ip = frame.ip
 		case code.OpGetBuiltin:
-			builtinIndex := code.ReadUint8(instructions[ip+1:])
-			vm.currentFrame().ip++
+			builtinIndex := code.ReadUint8(ins[ip+1:])
+			ip++
 
 			definition := object.Builtins[builtinIndex]
 			err := vm.push(definition.Builtin)
@@ -237,47 +448,160 @@ func (vm *VM) Run() error {
 				return err
 			}
 		case code.OpClosure:
-			constIndex := code.ReadUint16(instructions[ip+1:])
-			numFree := code.ReadUint8(instructions[ip+3:])
-			vm.currentFrame().ip += 3
+			constIndex := code.ReadUint16(ins[ip+1:])
+			numFree := code.ReadUint8(ins[ip+3:])
+			ip += 3
 
 			err := vm.pushClosure(int(constIndex), int(numFree))
 			if err != nil {
 				return err
 			}
 		case code.OpGetFree:
-			freeIndex := code.ReadUint8(instructions[ip+1:])
-			vm.currentFrame().ip++
+			freeIndex := code.ReadUint8(ins[ip+1:])
+			ip++
 
-			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure.Free[freeIndex])
+			err := vm.push(frame.cl.Free[freeIndex])
 			if err != nil {
 				return err
 			}
 		case code.OpCurrentClosure:
-			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure)
+			err := vm.push(frame.cl)
+			if err != nil {
+				return err
+			}
+
+		case code.OpGetLocalConstantAdd, code.OpGetLocalConstantSub:
+			op := code.OpAdd
+			if code.Opcode(ins[ip]) == code.OpGetLocalConstantSub {
+				op = code.OpSub
+			}
+			localIndex := code.ReadUint8(ins[ip+1:])
+			constIndex := code.ReadUint16(ins[ip+2:])
+			ip += 3
+
+			err := vm.executeFusedBinaryOperation(
+				op,
+				vm.stack[frame.basePointer+int(localIndex)],
+				vm.constants[constIndex],
+			)
+			if err != nil {
+				return err
+			}
+		case code.OpGetLocalGetLocal:
+			first := code.ReadUint8(ins[ip+1:])
+			second := code.ReadUint8(ins[ip+2:])
+			ip += 2
+
+			err := vm.push(vm.stack[frame.basePointer+int(first)])
+			if err == nil {
+				err = vm.push(vm.stack[frame.basePointer+int(second)])
+			}
 			if err != nil {
 				return err
 			}
+		case code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy, code.OpGreaterThanJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+1:]))
+			op := code.Opcode(ins[ip])
+			ip += 2
+
+			result, err := vm.executeFusedComparison(op)
+			if err != nil {
+				return err
+			}
+			if !result {
+				ip = pos - 1
+			}
+		case code.OpGetBuiltinGetLocalCall:
+			builtin := object.Builtins[ins[ip+1]].Builtin
+			localIndex := code.ReadUint8(ins[ip+2:])
+			position := ip
+			ip += 2
+
+			err := vm.push(builtin)
+			if err == nil {
+				err = vm.push(vm.stack[frame.basePointer+int(localIndex)])
+			}
+			if err == nil {
+				if tracer != nil {
+					vm.traceCall(frame.cl.Fn, position, builtin)
+				}
+				frame.ip = ip
+				err = vm.callBuiltin(builtin, 1)
+			}
+			if err != nil {
+				return err
+			}
+
+			if tracer != nil {
+				tracer.OnReturn(vm.traceEvent(code.OpGetBuiltinGetLocalCall, vm.framesIndex+1, frame.cl.Fn, position))
+			}
+
+			if vm.pauses(depth) {
+				frame.ip = ip
+				return ErrPaused
+			}
 		}
 	}
 
+	frame.ip = ip
+
 	return nil
 }
 
+// pauses reports whether Run must pause, consuming the request
+func (vm *VM) pauses(depth int) bool {
+	if depth == 0 && vm.pauseRequested.Load() {
+		vm.pauseRequested.Store(false)
+		return true
+	}
+	return false
+}
+
+func (vm *VM) getGlobal(index int) object.Object {
+	if vm.sharedGlobals != nil {
+		return vm.sharedGlobals.Get(index)
+	}
+
+	return vm.globals[index]
+}
+
+// getSharedGlobal reads a shared global through the cache of the
+// instruction, which is valid until any global is set
+func (vm *VM) getSharedGlobal(index int, cache *inlineCache) object.Object {
+	version := vm.sharedGlobals.version.Load() + 1
+	if cache.globalVersion == version {
+		return cache.value
+	}
+
+	value := vm.sharedGlobals.Get(index)
+	cache.value = value
+	cache.globalVersion = version
+
+	return value
+}
+
+func (vm *VM) setGlobal(index int, value object.Object) {
+	if vm.sharedGlobals != nil {
+		vm.sharedGlobals.Set(index, value)
+		return
+	}
+
+	vm.globals[index] = value
+}
+
 func (vm *VM) currentFrame() *Frame {
-	return vm.frames[vm.framesIndex-1]
+	return &vm.frames[vm.framesIndex-1]
 }
 
-func (vm *VM) pushFrame(f *Frame) {
+func (vm *VM) pushFrame(f Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("stack overflow")
+	}
+
 	vm.frames[vm.framesIndex] = f
 	vm.framesIndex++
-}
 
-func (vm *VM) popFrame() *Frame {
-	vm.framesIndex--
-	return vm.frames[vm.framesIndex]
+	return nil
 }
 
 func (vm *VM) pushClosure(constIndex, numFree int) error {
@@ -287,6 +611,11 @@ func (vm *VM) pushClosure(constIndex, numFree int) error {
 		return fmt.Errorf("not a function: %+v", constant)
 	}
 
+	// closures without free variables cannot change, so they are shared
+	if numFree == 0 {
+		return vm.push(vm.program.closures[constIndex])
+	}
+
 	free := make([]object.Object, numFree)
 	for i := 0; i < numFree; i++ {
 		free[i] = vm.stack[vm.sp-numFree+i]
@@ -315,12 +644,29 @@ func (vm *VM) pop() object.Object {
 	return o
 }
 
-func (vm *VM) executeCall(numArgs int) error {
+// executeCall calls the callee below the arguments. When it is the callee
+// of the last call from the same instruction, the lookups and checks done
+// then are skipped. Rebinding the global holding the callee changes the
+// callee, so the cache is refilled on the next call.
+func (vm *VM) executeCall(numArgs int, cache *inlineCache) error {
 	callee := vm.stack[vm.sp-1-numArgs]
+	if callee == cache.callee {
+		if cache.closure != nil {
+			return vm.pushClosureFrame(cache.closure, cache.calleeCache, numArgs)
+		}
+		return vm.callBuiltin(cache.builtin, numArgs)
+	}
+
 	switch callee := callee.(type) {
 	case *object.Closure:
-		return vm.callClosure(callee, numArgs)
+		err := vm.callClosure(callee, numArgs)
+		if err != nil {
+			return err
+		}
+		*cache = inlineCache{callee: callee, closure: callee, calleeCache: vm.currentFrame().cache}
+		return nil
 	case *object.Builtin:
+		*cache = inlineCache{callee: callee, builtin: callee}
 		return vm.callBuiltin(callee, numArgs)
 	default:
 		return fmt.Errorf("calling non-function and non-built-in")
@@ -333,10 +679,25 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 			cl.Fn.NumParameters, numArgs)
 	}
 
-	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
+	return vm.pushClosureFrame(cl, vm.functionCache(cl.Fn), numArgs)
+}
+
+// pushClosureFrame pushes the frame of a closure whose arguments were
+// already checked
+func (vm *VM) pushClosureFrame(cl *object.Closure, cache *functionCache, numArgs int) error {
+	basePointer := vm.sp - numArgs
+	frame := NewFrame(cl, basePointer)
+	frame.cache = cache
+
+	err := vm.pushFrame(frame)
+	if err != nil {
+		return err
+	}
 
-	vm.sp = frame.basePointer + cl.Fn.NumLocals
+	// the slots of the locals not bound yet may hold values of earlier
+	// calls, which debuggers would show
+	vm.sp = basePointer + cl.Fn.NumLocals
+	clear(vm.stack[basePointer+numArgs : vm.sp])
 
 	return nil
 }
@@ -344,7 +705,7 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
 
-	result, err := builtin.Fn(args...)
+	result, err := builtin.Fn(vm, args...)
 
 	vm.sp = vm.sp - numArgs - 1
 
@@ -389,12 +750,15 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 	case code.OpMul:
 		result = leftVal * rightVal
 	case code.OpDiv:
+		if rightVal == 0 {
+			return fmt.Errorf("division by zero")
+		}
 		result = leftVal / rightVal
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
 
-	return vm.push(&object.Integer{Value: result})
+	return vm.push(object.NewInteger(result))
 }
 
 func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
@@ -413,6 +777,60 @@ func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Ob
 	return vm.push(&object.String{Value: result})
 }
 
+// executeFusedBinaryOperation runs the operation of a superinstruction,
+// whose operands were not pushed to the stack
+func (vm *VM) executeFusedBinaryOperation(op code.Opcode, left, right object.Object) error {
+	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
+		return vm.executeBinaryIntegerOperation(op, left, right)
+	}
+
+	err := vm.push(left)
+	if err == nil {
+		err = vm.push(right)
+	}
+	if err != nil {
+		return err
+	}
+
+	return vm.executeBinaryOperation(op)
+}
+
+// executeFusedComparison pops and compares the operands of a fused
+// compare-and-jump instruction, without pushing the result
+func (vm *VM) executeFusedComparison(fused code.Opcode) (bool, error) {
+	var op code.Opcode
+	switch fused {
+	case code.OpEqualJumpNotTruthy:
+		op = code.OpEqual
+	case code.OpNotEqualJumpNotTruthy:
+		op = code.OpNotEqual
+	default:
+		op = code.OpGreaterThan
+	}
+
+	right, rightOk := vm.stack[vm.sp-1].(*object.Integer)
+	left, leftOk := vm.stack[vm.sp-2].(*object.Integer)
+	if leftOk && rightOk {
+		vm.sp -= 2
+
+		switch op {
+		case code.OpEqual:
+			return left.Value == right.Value, nil
+		case code.OpNotEqual:
+			return left.Value != right.Value, nil
+		default:
+			return left.Value > right.Value, nil
+		}
+	}
+
+	err := vm.executeComparison(op)
+	if err != nil {
+		return false, err
+	}
+
+	return isTruthy(vm.pop()), nil
+}
+
 func (vm *VM) executeComparison(op code.Opcode) error {
 	right := vm.pop()
 	left := vm.pop()
@@ -493,7 +911,7 @@ func (vm *VM) executeMinusOperator() error {
 	}
 
 	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+	return vm.push(object.NewInteger(-value))
 }
 
 func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
@@ -1,11 +1,14 @@
 package vm
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/jalopez/go-monkey-interpreter/pkg/ast"
 	"github.com/jalopez/go-monkey-interpreter/pkg/compiler"
+	"github.com/jalopez/go-monkey-interpreter/pkg/diagnostic"
 	"github.com/jalopez/go-monkey-interpreter/pkg/lexer"
 	"github.com/jalopez/go-monkey-interpreter/pkg/object"
 	"github.com/jalopez/go-monkey-interpreter/pkg/parser"
@@ -384,6 +387,80 @@ func TestCallingFunctionsWithWrongArguments(t *testing.T) {
 	}
 }
 
+func TestStackOverflow(t *testing.T) {
+	inputs := []string{
+		// runs out of frames before running out of stack
+		`let f = fn() { f() }; f();`,
+		`let f = fn(a, b, c) { let d = 1; f(a, b, c) }; f(1, 2, 3);`,
+	}
+
+	for _, input := range inputs {
+		comp := compiler.New()
+		err := comp.Compile(parse(input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		vm := New(comp.Bytecode())
+		err = vm.Run()
+		if err == nil || err.Error() != "stack overflow" {
+			t.Errorf("%q: wrong VM error. got=%v", input, err)
+		}
+	}
+}
+
+func TestRuntimeDiagnostics(t *testing.T) {
+	tests := []struct {
+		input  string
+		line   int
+		column int
+		notes  []string
+	}{
+		{`1 + "a"`, 1, 3, nil},
+		{"let x = 0;\n10 / x", 2, 4, nil},
+		{"let add = fn(a, b) {\n  a + b\n};\nlet twice = fn(f) { f(1) };\ntwice(fn(x) { add(x, true) });", 2, 5, []string{
+			"in add, called at line 5, column 18",
+			"in anonymous function, called at line 4, column 22",
+			"in twice, called at line 5, column 6",
+		}},
+		// errors of calls are found at the call
+		{"let f = fn(a) { a };\nf()", 2, 2, nil},
+		{"let f = fn() { f() }; f();", 1, 17, []string{
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			"in f, called at line 1, column 17",
+			fmt.Sprintf("and %d more calls", MaxFrames-1-maxCallNotes),
+		}},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		err := comp.Compile(parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		err = New(comp.Bytecode()).Run()
+		d, ok := err.(*diagnostic.Diagnostic)
+		if !ok {
+			t.Fatalf("error of %q is not a diagnostic. got=%T (%v)", tt.input, err, err)
+		}
+
+		if d.Code != diagnostic.RuntimeError || d.Start.Line != tt.line || d.Start.Column != tt.column {
+			t.Errorf("wrong diagnostic for %q. want=%d:%d, got=%s %d:%d",
+				tt.input, tt.line, tt.column, d.Code, d.Start.Line, d.Start.Column)
+		}
+		if strings.Join(d.Notes, "\n") != strings.Join(tt.notes, "\n") {
+			t.Errorf("wrong notes for %q.\nwant=%q\ngot=%q", tt.input, tt.notes, d.Notes)
+		}
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []vmTestCase{
 		{`len("")`, 0},
@@ -434,29 +511,165 @@ func TestBuiltinFunctions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestHigherOrderBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`map([1, 2, 3], fn(x) { x * 2 })`, []int{2, 4, 6}},
+		{`let y = 10; map([1, 2], fn(x) { x + y })`, []int{11, 12}},
+		{`map([[1], [1, 2]], len)`, []int{1, 2}},
+		{`filter([1, 2, 3, 4], fn(x) { x > 2 })`, []int{3, 4}},
+		{`reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })`, 10},
+		{`reduce([], 7, fn(acc, x) { acc + x })`, 7},
+		{`each([1, 2], fn(x) { x })`, Null},
+		{`sort_by([3, 1, 2], fn(x) { x })`, []int{1, 2, 3}},
+		{`sort_by([3, 1, 2], fn(x) { -x })`, []int{3, 2, 1}},
+		{`sort_by([[1, 2, 3], [1], [1, 2]], len)`, [][]int{{1}, {1, 2}, {1, 2, 3}}},
+		{
+			`let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } }; map([3, 4], fact)`,
+			[]int{6, 24},
+		},
+		{
+			`map(1, fn(x) { x })`,
+			&object.Error{Message: "argument to `map` must be ARRAY, got INTEGER"},
+		},
+		{
+			`filter([1], 1)`,
+			&object.Error{Message: "second argument to `filter` must be a function, got INTEGER"},
+		},
+		{
+			`map([1], fn(x, y) { x })`,
+			&object.Error{Message: "wrong number of arguments: want=2, got=1"},
+		},
+		{
+			`sort_by([1, 2], fn(x) { true })`,
+			&object.Error{Message: "`sort_by` keys must be all INTEGER or all STRING, got BOOLEAN"},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestConcurrencyBuiltins(t *testing.T) {
+	tests := []vmTestCase{
+		{`wait(spawn(fn(a, b) { a + b }, 1, 2))`, 3},
+		{
+			`let square = fn(x) { x * x };
+			wait(map([1, 2, 3], fn(x) { spawn(square, x) }))`,
+			[]int{1, 4, 9},
+		},
+		{
+			`let ch = chan();
+			spawn(fn() { each([1, 2, 3], fn(x) { send(ch, x) }); close(ch) });
+			let sum = fn(acc) { let v = recv(ch); if (v) { sum(acc + v) } else { acc } };
+			sum(0)`,
+			6,
+		},
+		{
+			`let ch = chan(1); send(ch, 5); recv(ch)`,
+			5,
+		},
+		{
+			`let a = chan(); let b = chan(1); send(b, 7); select([a, b])`,
+			[]int{1, 7},
+		},
+		{
+			`let ch = chan(); close(ch); recv(ch)`,
+			Null,
+		},
+		{
+			`wait(spawn(fn() { len(1) }))`,
+			&object.Error{Message: "task failed: argument to `len` not supported, got INTEGER"},
+		},
+		{
+			`let ok = spawn(fn() { 1 });
+			let first = spawn(fn() { first(1) });
+			let second = spawn(fn() { last(1) });
+			wait([ok, first, second])`,
+			&object.Error{Message: "task failed: argument to `first` must be ARRAY, got INTEGER"},
+		},
+		{
+			`let ch = chan(); close(ch); close(ch)`,
+			&object.Error{Message: "close of closed channel"},
+		},
+		{
+			`let ch = chan(1); close(ch); send(ch, 1)`,
+			&object.Error{Message: "send on closed channel"},
+		},
+		{
+			`spawn(1)`,
+			&object.Error{Message: "argument to `spawn` must be a function, got INTEGER"},
+		},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestIOBuiltins(t *testing.T) {
+	program := parse(`
+	let name = read_line();
+	puts("hello", name);
+	print("a", 1);
+	eprint("oops");
+	let rest = read_all();
+	print(rest);
+	read_line();
+	`)
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var out, errOut bytes.Buffer
+
+	vm := New(comp.Bytecode())
+	vm.SetIO(object.NewIO(strings.NewReader("monkey\r\nline 2\nline 3"), &out, &errOut))
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	if out.String() != "hello\nmonkey\na1line 2\nline 3" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	if errOut.String() != "oops" {
+		t.Errorf("wrong error output. got=%q", errOut.String())
+	}
+
+	if vm.LastPoppedStackElem() != Null {
+		t.Errorf("read_line at end of input is not Null. got=%+v", vm.LastPoppedStackElem())
+	}
+}
+
 func runVmTests(t *testing.T, tests []vmTestCase) {
 	t.Helper()
 
-	for _, tt := range tests {
-		program := parse(tt.input)
+	for _, superinstructions := range []bool{false, true} {
+		for _, tt := range tests {
+			program := parse(tt.input)
 
-		comp := compiler.New()
-		err := comp.Compile(program)
-		if err != nil {
-			t.Fatalf("compiler error: %s", err)
-		}
+			comp := compiler.New()
+			if superinstructions {
+				comp.EnableSuperinstructions()
+			}
+			err := comp.Compile(program)
+			if err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
 
-		vm := New(comp.Bytecode())
-		err = vm.Run()
-		if err != nil {
-			if err.Error() != tt.expected {
-				t.Fatalf("vm error: %s", err)
+			vm := New(comp.Bytecode())
+			err = vm.Run()
+			if err != nil {
+				if err.Error() != tt.expected {
+					t.Fatalf("vm error (superinstructions=%t): %s", superinstructions, err)
+				}
 			}
-		}
 
-		stackElem := vm.LastPoppedStackElem()
+			stackElem := vm.LastPoppedStackElem()
 
-		testExpectedObject(t, tt.expected, stackElem)
+			testExpectedObject(t, tt.expected, stackElem)
+		}
 	}
 }
 
@@ -502,6 +715,22 @@ func testExpectedObject(
 				t.Errorf("testIntegerObject failed: %s", err)
 			}
 		}
+	case [][]int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: %T (%+v)", actual, actual)
+			return
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements. want=%d, got=%d",
+				len(expected), len(array.Elements))
+			return
+		}
+
+		for i, expectedElem := range expected {
+			testExpectedObject(t, expectedElem, array.Elements[i])
+		}
 	case *object.Error:
 		errObj, ok := actual.(*object.Error)
 		if !ok {
@@ -670,6 +899,171 @@ func TestRecursiveFibonacci(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestCall(t *testing.T) {
+	program := parse(`
+	let base = 10;
+	let makeAdder = fn(x) { fn(y) { base + x + y } };
+	let add = makeAdder(5);
+	let fail = fn(x) { x() };
+	add;
+	`)
+
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	add, ok := vm.LastPoppedStackElem().(*object.Closure)
+	if !ok {
+		t.Fatalf("object is not Closure: %T (%+v)", vm.LastPoppedStackElem(), vm.LastPoppedStackElem())
+	}
+
+	for i := int64(0); i < 3; i++ {
+		result, err := vm.Call(add, &object.Integer{Value: i})
+		if err != nil {
+			t.Fatalf("call error: %s", err)
+		}
+
+		err = testIntegerObject(15+i, result)
+		if err != nil {
+			t.Errorf("testIntegerObject failed: %s", err)
+		}
+	}
+
+	if vm.LastPoppedStackElem() != add {
+		t.Errorf("last popped element not restored. got=%+v", vm.LastPoppedStackElem())
+	}
+
+	_, err = vm.Call(add)
+	if err == nil || err.Error() != "wrong number of arguments: want=1, got=0" {
+		t.Errorf("wrong call error. got=%v", err)
+	}
+
+	fail := vm.globals[3].(*object.Closure)
+	_, err = vm.Call(fail, &object.Integer{Value: 1})
+	if err == nil || err.Error() != "calling non-function and non-built-in" {
+		t.Errorf("wrong call error. got=%v", err)
+	}
+
+	if vm.sp != 0 || vm.framesIndex != 1 {
+		t.Errorf("vm state not restored after error. sp=%d, framesIndex=%d", vm.sp, vm.framesIndex)
+	}
+
+	result, err := vm.Call(add, &object.Integer{Value: 1})
+	if err != nil {
+		t.Fatalf("call error: %s", err)
+	}
+
+	err = testIntegerObject(16, result)
+	if err != nil {
+		t.Errorf("testIntegerObject failed: %s", err)
+	}
+}
+
+func BenchmarkIntegerArithmetic(b *testing.B) {
+	minCached, maxCached := object.SmallIntegerRange()
+	defer object.SetSmallIntegerRange(minCached, maxCached)
+
+	benchmarks := []struct {
+		name     string
+		min, max int64
+		a, b     int64
+	}{
+		{"small cached", object.DefaultSmallIntegerMin, object.DefaultSmallIntegerMax, 7, 3},
+		{"small uncached", 1, 0, 7, 3},
+		{"large", object.DefaultSmallIntegerMin, object.DefaultSmallIntegerMax, 100000, 3},
+	}
+
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			object.SetSmallIntegerRange(bm.min, bm.max)
+
+			vm, fn := compileFunction(b, `fn(a, b) { (a + b) * (a - b) + a / b - b * 2 }`)
+			a := object.NewInteger(bm.a)
+			c := object.NewInteger(bm.b)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := vm.Call(fn, a, c)
+				if err != nil {
+					b.Fatalf("call error: %s", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFunctionCall(b *testing.B) {
+	vm, fn := compileFunction(b, callsInput)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, err := vm.Call(fn)
+		if err != nil {
+			b.Fatalf("call error: %s", err)
+		}
+	}
+}
+
+// callsInput makes recursive calls and creates closures without free
+// variables, none of which should allocate. The host call takes no
+// arguments, whose variadic slice would be allocated by the caller.
+const callsInput = `
+let countdown = fn(n) {
+	let step = fn(x) { x - 1 };
+	if (n == 0) { 0 } else { countdown(step(n)) }
+};
+fn() { countdown(50) }
+`
+
+func TestFunctionCallsDoNotAllocate(t *testing.T) {
+	vm, fn := compileFunction(t, callsInput)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_, err := vm.Call(fn)
+		if err != nil {
+			t.Fatalf("call error: %s", err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("calls allocate. got=%v allocs per run", allocs)
+	}
+}
+
+// compileFunction runs a program whose last expression is a function and
+// returns it with the VM to call it
+func compileFunction(tb testing.TB, input string) (*VM, *object.Closure) {
+	tb.Helper()
+
+	comp := compiler.New()
+	err := comp.Compile(parse(input))
+	if err != nil {
+		tb.Fatalf("compiler error: %s", err)
+	}
+
+	vm := New(comp.Bytecode())
+	err = vm.Run()
+	if err != nil {
+		tb.Fatalf("vm error: %s", err)
+	}
+
+	fn, ok := vm.LastPoppedStackElem().(*object.Closure)
+	if !ok {
+		tb.Fatalf("object is not Closure: %T (%+v)", vm.LastPoppedStackElem(), vm.LastPoppedStackElem())
+	}
+
+	return vm, fn
+}
+
 func parse(input string) *ast.Program {
 	l := lexer.New(input)
 	p := parser.New(l)